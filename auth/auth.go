@@ -2,53 +2,215 @@ package auth
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
 // Client 认证客户端
+// 会话字段（Token、RefreshToken、RequestSecret、LeaseExpiry）由互斥锁保护，心跳协程运行时
+// 应通过 Session、Resume、GetToken、Lease 读写，不要直接访问
 type Client struct {
 	ServerURL  string
 	HTTPClient *http.Client
-	Token      string
+	Token      string // 短期访问令牌
+
+	// RefreshToken 用于换取新的访问令牌，每次刷新后轮换
+	// 旧刷新令牌不可重复使用，服务器检测到重用会吊销整个令牌族
+	RefreshToken string
+
+	// RequestSecret 激活时服务器下发的请求签名密钥，用于签名心跳和解绑请求
+	RequestSecret string
+
+	// PublicKeys 用于在本地验证令牌和服务器响应的签名，默认取自嵌入的 auth.PublicKey
+	// 密钥轮换期间可同时包含新旧公钥；为空时拒绝所有响应（除非设置了 InsecureSkipVerify）
+	PublicKeys []ed25519.PublicKey
+
+	// InsecureSkipVerify 不验证服务器响应和令牌签名（见 WithInsecureSkipVerify），仅用于本地测试服务器
+	InsecureSkipVerify bool
+
+	// Fingerprint 结构化硬件指纹（组件名 -> 哈希，见 hwid.GetFingerprint），激活时发送（可选）
+	// 部分硬件更换导致 HWID 变化时，服务器据此识别为同一台设备而不占用新的设备槽位
+	Fingerprint map[string]string
+
+	// PreviousHWID 客户端升级前的硬件ID（见 hwid.PreviousHardwareID），激活时发送（可选）
+	// 硬件ID算法变化后，服务器据此将原设备绑定迁移到新的硬件ID
+	PreviousHWID string
+
+	// Environment 运行环境检测结果（见 hwid.DetectEnvironment），激活时发送（可选）
+	// 服务器按产品策略允许、标记或拒绝虚拟机和容器中的激活；未发送时 flag 和 reject 策略下设备会被标记待审查
+	Environment *Environment
+
+	// LeaseExpiry 浮动许可证席位租约的到期时间，激活和每次心跳后更新；节点锁定许可证为零值
+	// 租约到期前没有成功心跳时席位被释放，Heartbeat 自动重新借出席位（席位已满时返回 ErrNoSeats）
+	LeaseExpiry time.Time
+
+	UserAgent string      // 为空时使用 DefaultUserAgent
+	Retry     RetryPolicy // 网络错误时的重试策略
+	Logger    Logger      // 可选，记录重试和令牌刷新
+
+	// OnSessionChange 激活、刷新、解绑后调用（可选），用于持久化会话
+	// 刷新令牌每次刷新都会轮换，未保存新令牌会导致下次启动时被判定为重用
+	OnSessionChange func(Session)
+
+	tlsOptions *TLSOptions // WithTLS 设置，在其他选项之后应用
+	optionErr  error       // 选项应用失败的原因，由 New 返回
+
+	mu        sync.Mutex // 保护会话字段
+	refreshMu sync.Mutex // 串行化刷新，避免并发刷新重复使用同一刷新令牌而触发重用检测
+}
+
+// Session 可持久化的客户端会话
+type Session struct {
+	Token         string
+	RefreshToken  string
+	RequestSecret string
 }
 
 // ActivateRequest 激活请求结构
 type ActivateRequest struct {
-	Key  string `json:"key"`
-	HWID string `json:"hwid"`
+	Key          string            `json:"key"`
+	HWID         string            `json:"hwid"`
+	Fingerprint  map[string]string `json:"fingerprint,omitempty"`
+	PreviousHWID string            `json:"previous_hwid,omitempty"`
+	Environment  *Environment      `json:"environment,omitempty"`
+	UpgradeFrom  string            `json:"upgrade_from,omitempty"` // 试用许可证密钥（见 Upgrade）
+}
+
+// Environment 客户端运行环境
+// 分类由客户端自行检测，服务器无法验证，只用于执行策略和供管理员审查
+type Environment struct {
+	Type    string   `json:"type"`              // physical、vm 或 container
+	Vendor  string   `json:"vendor,omitempty"`  // 虚拟化平台，如 kvm、docker
+	Signals []string `json:"signals,omitempty"` // 命中的检测项
 }
 
 // ActivateResponse 激活响应结构
 type ActivateResponse struct {
-	Status string `json:"status"`
-	Token  string `json:"token"`
-	Error  string `json:"error,omitempty"`
+	Status        string `json:"status"`
+	Token         string `json:"token"`
+	RefreshToken  string `json:"refresh_token,omitempty"`
+	RequestSecret string `json:"request_secret,omitempty"` // 后续请求的签名密钥
+	ExpiresIn     int64  `json:"expires_in,omitempty"`     // 访问令牌剩余秒数
+	Devices       int    `json:"devices,omitempty"`        // 已占用的设备槽位
+	MaxDevices    int    `json:"max_devices,omitempty"`    // 设备槽位总数
+	Error         string `json:"error,omitempty"`
+	Code          string `json:"code,omitempty"` // 失败原因（错误码）
+
+	LeaseExpiresIn int64 `json:"lease_expires_in,omitempty"` // 浮动许可证席位租约剩余秒数
+	SeatsInUse     int   `json:"seats_in_use,omitempty"`     // 席位已满时当前占用的席位数
+	MaxSeats       int   `json:"max_seats,omitempty"`        // 席位已满时的席位总数
+}
+
+// RefreshResponse 刷新令牌响应结构
+type RefreshResponse struct {
+	Status       string `json:"status"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error,omitempty"`
+	Code         string `json:"code,omitempty"`
 }
 
+// refreshMargin 访问令牌剩余有效期小于该值时提前刷新
+const refreshMargin = time.Minute
+
 // HeartbeatResponse 心跳响应结构
 type HeartbeatResponse struct {
-	Status string `json:"status"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+	Code           string `json:"code,omitempty"`
+	LeaseExpiresIn int64  `json:"lease_expires_in,omitempty"` // 浮动许可证续期后的席位租约剩余秒数
+}
+
+// RejectedError 服务器明确拒绝许可证（吊销、封禁、过期或设备已解绑）
+// 与网络错误不同，收到该错误说明许可证确实已失效，不应继续离线宽限
+// 具体原因可通过 errors.Is(err, auth.ErrBanned) 等判断
+type RejectedError struct {
+	StatusCode int
+	Status     string
+	Code       string // 错误码，旧版本服务器为空
+}
+
+func (e *RejectedError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("license invalidated by server (status: %d, code: %s)", e.StatusCode, e.Code)
+	}
+	if e.Status != "" {
+		return fmt.Sprintf("license invalidated by server (status: %d, %s)", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("license invalidated by server (status: %d)", e.StatusCode)
+}
+
+// Is 支持 errors.Is(err, auth.ErrBanned) 等判断
+func (e *RejectedError) Is(target error) bool {
+	sentinel := codeError(e.Code, e.StatusCode)
+	return sentinel != nil && sentinel == target
+}
+
+// Revoked 实现 heartbeat 包用于区分服务器拒绝和网络故障的接口
+// 浮动许可证租约过期只说明离线期间席位被释放，许可证本身仍然有效，不算吊销
+func (e *RejectedError) Revoked() bool {
+	return e.Code != CodeLeaseExpired
 }
 
-// NewClient 创建新的认证客户端
+// NewClient 使用默认设置创建认证客户端
+// 为兼容旧版保留，不返回错误：嵌入的公钥缺失或无效时客户端仍会创建，但所有响应验证都返回 ErrNoPublicKey；
+// 需要设置选项或在创建时检查配置时使用 New
 func NewClient(serverURL string) *Client {
+	c := newClient(serverURL)
+	if publicKeys, err := ParsePublicKeys(PublicKey); err == nil {
+		c.PublicKeys = publicKeys
+	}
+	return c
+}
+
+// New 创建新的认证客户端，可通过 Option 调整超时、代理、重试、TLS 等设置
+// 嵌入的公钥格式错误时返回错误；没有任何公钥且未设置 WithInsecureSkipVerify 时返回 ErrNoPublicKey
+func New(serverURL string, opts ...Option) (*Client, error) {
+	publicKeys, err := ParsePublicKeys(PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded public key: %w", err)
+	}
+
+	c := newClient(serverURL)
+	c.PublicKeys = publicKeys
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.optionErr != nil {
+		return nil, c.optionErr
+	}
+
+	// TLS 设置在 WithHTTPClient、WithProxy 之后应用，与选项顺序无关
+	if c.tlsOptions != nil {
+		if err := c.ConfigureTLS(*c.tlsOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// 无法验证响应的客户端会接受任何服务器（包括伪造的）的激活结果
+	if len(c.PublicKeys) == 0 && !c.InsecureSkipVerify {
+		return nil, ErrNoPublicKey
+	}
+	return c, nil
+}
+
+// newClient 返回默认设置的客户端（不含公钥）
+func newClient(serverURL string) *Client {
 	return &Client{
 		ServerURL: serverURL,
+		UserAgent: DefaultUserAgent,
+		// 生产环境应通过 WithTLS 启用证书固定
 		HTTPClient: &http.Client{
-			Timeout: 10 * time.Second,
-			// TODO: 生产环境中应启用SSL Pinning
-			// 使用自定义Transport配置TLS证书验证
-			// Transport: &http.Transport{
-			//     TLSClientConfig: &tls.Config{
-			//         RootCAs:      certPool,          // 固定证书池
-			//         MinVersion:   tls.VersionTLS12,  // 最低TLS版本
-			//         CipherSuites: secureCiphers,     // 安全的加密套件
-			//     },
-			// }
+			Timeout: DefaultTimeout,
 		},
 	}
 }
@@ -57,10 +219,24 @@ func NewClient(serverURL string) *Client {
 // 发送许可证密钥和硬件ID到服务器进行验证
 // 成功时返回JWT令牌并存储在客户端实例中
 func (c *Client) Activate(licenseKey, hwid string) error {
+	return c.ActivateContext(context.Background(), licenseKey, hwid)
+}
+
+// ActivateContext 激活许可证，ctx 取消或超时时中止请求（包括重试等待）
+func (c *Client) ActivateContext(ctx context.Context, licenseKey, hwid string) error {
+	return c.activate(ctx, licenseKey, hwid, "")
+}
+
+// activate 发送激活请求，upgradeFrom 为要结束的试用许可证密钥（可为空）
+func (c *Client) activate(ctx context.Context, licenseKey, hwid, upgradeFrom string) error {
 	// 构建请求体
 	reqBody := ActivateRequest{
-		Key:  licenseKey,
-		HWID: hwid,
+		Key:          licenseKey,
+		HWID:         hwid,
+		Fingerprint:  c.Fingerprint,
+		PreviousHWID: c.PreviousHWID,
+		Environment:  c.Environment,
+		UpgradeFrom:  upgradeFrom,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -68,21 +244,19 @@ func (c *Client) Activate(licenseKey, hwid string) error {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// 创建HTTP请求
+	// 发送请求
 	url := fmt.Sprintf("%s/api/activate", c.ServerURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "SecureClient/1.0")
-
-	// TODO: 添加请求签名以防止中间人攻击
-	// req.Header.Set("X-Request-Signature", generateHMAC(jsonData, secret))
+	resp, nonce, err := c.send(ctx, func(ctx context.Context) (*http.Request, string, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
 
-	// 发送请求
-	resp, err := c.HTTPClient.Do(req)
+		// 激活前还没有设备密钥，使用许可证密钥签名
+		nonce, err := signRequest(req, licenseKey, jsonData)
+		return req, nonce, err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send activation request: %w", err)
 	}
@@ -94,6 +268,11 @@ func (c *Client) Activate(licenseKey, hwid string) error {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
+	// 确认响应来自真正的许可证服务器
+	if err := c.verifyServerResponse(resp, body, nonce); err != nil {
+		return fmt.Errorf("untrusted activation response: %w", err)
+	}
+
 	// 解析响应
 	var activateResp ActivateResponse
 	if err := json.Unmarshal(body, &activateResp); err != nil {
@@ -102,10 +281,10 @@ func (c *Client) Activate(licenseKey, hwid string) error {
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		if activateResp.Error != "" {
-			return fmt.Errorf("activation failed: %s", activateResp.Error)
-		}
-		return fmt.Errorf("activation failed with status code: %d", resp.StatusCode)
+		return fmt.Errorf("activation failed: %w", &ServerError{
+			StatusCode: resp.StatusCode, Code: activateResp.Code, Message: activateResp.Error,
+			SeatsInUse: activateResp.SeatsInUse, MaxSeats: activateResp.MaxSeats,
+		})
 	}
 
 	// 验证响应
@@ -117,37 +296,204 @@ func (c *Client) Activate(licenseKey, hwid string) error {
 		return fmt.Errorf("no token received from server")
 	}
 
+	// 验证令牌确实由服务器签发且绑定当前设备
+	if !c.InsecureSkipVerify {
+		claims, err := VerifyToken(activateResp.Token, c.PublicKeys...)
+		if err != nil {
+			return fmt.Errorf("received invalid token: %w", err)
+		}
+		if claims.LicenseKey != licenseKey || claims.HWID != hwid {
+			return fmt.Errorf("received token does not match this license or device")
+		}
+	}
+
 	// 存储令牌
+	c.mu.Lock()
 	c.Token = activateResp.Token
+	c.RefreshToken = activateResp.RefreshToken
+	c.RequestSecret = activateResp.RequestSecret
+	c.LeaseExpiry = leaseExpiry(activateResp.LeaseExpiresIn)
+	c.mu.Unlock()
+	c.sessionChanged()
+	return nil
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌
+// 服务器拒绝（刷新令牌失效、被重用、许可证失效）时返回 *RejectedError
+func (c *Client) Refresh() error {
+	return c.RefreshContext(context.Background())
+}
+
+// RefreshContext 刷新令牌，ctx 取消或超时时中止请求
+func (c *Client) RefreshContext(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	session := c.Session()
+	if session.RefreshToken == "" {
+		return fmt.Errorf("no refresh token available, please activate first")
+	}
+
+	jsonData, err := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/refresh", c.ServerURL)
+	resp, nonce, err := c.send(ctx, func(ctx context.Context) (*http.Request, string, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create refresh request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// 使用设备的请求密钥签名，只截获刷新令牌无法换取新令牌
+		nonce, err := signRequest(req, session.RequestSecret, jsonData)
+		return req, nonce, err
+	})
+	if err != nil {
+		return fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read refresh response: %w", err)
+	}
+
+	// 伪造的服务器不能下发令牌，也不能以拒绝响应让客户端丢弃会话
+	if err := c.verifyServerResponse(resp, body, nonce); err != nil {
+		return fmt.Errorf("untrusted refresh response: %w", err)
+	}
+
+	var refreshResp RefreshResponse
+	json.Unmarshal(body, &refreshResp)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &RejectedError{StatusCode: resp.StatusCode, Status: refreshResp.Error, Code: refreshResp.Code}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("refresh failed: %w",
+			&ServerError{StatusCode: resp.StatusCode, Code: refreshResp.Code, Message: refreshResp.Error})
+	}
+
+	if refreshResp.Status != "success" || refreshResp.Token == "" {
+		return fmt.Errorf("refresh unsuccessful: %s", refreshResp.Status)
+	}
+
+	if !c.InsecureSkipVerify {
+		if _, err := VerifyToken(refreshResp.Token, c.PublicKeys...); err != nil {
+			return fmt.Errorf("received invalid token: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.Token = refreshResp.Token
+	c.RefreshToken = refreshResp.RefreshToken
+	c.mu.Unlock()
+	c.logf("[Auth] Access token refreshed")
+	c.sessionChanged()
 	return nil
 }
 
+// ensureFreshToken 访问令牌即将过期时先刷新
+func (c *Client) ensureFreshToken(ctx context.Context) error {
+	session := c.Session()
+	if session.RefreshToken == "" {
+		return nil
+	}
+
+	expiry := tokenExpiry(session.Token)
+	if expiry.IsZero() || time.Until(expiry) > refreshMargin {
+		return nil
+	}
+
+	return c.RefreshContext(ctx)
+}
+
 // Heartbeat 发送心跳请求
 // 向服务器发送心跳以验证许可证仍然有效
-// 返回错误表示许可证已失效或连接失败
+// 访问令牌即将过期或被服务器以 401 拒绝时，自动使用刷新令牌续期后重试一次
+// 浮动许可证的席位租约已过期时，自动重新借出席位后重试一次
+// 服务器明确拒绝时返回 *RejectedError，其他错误表示连接失败或服务器暂时不可用
 func (c *Client) Heartbeat() error {
-	if c.Token == "" {
+	return c.HeartbeatContext(context.Background())
+}
+
+// HeartbeatContext 发送心跳请求，ctx 取消或超时时中止请求
+func (c *Client) HeartbeatContext(ctx context.Context) error {
+	if !c.IsAuthenticated() {
 		return fmt.Errorf("no token available, please activate first")
 	}
 
-	// 创建心跳请求
-	url := fmt.Sprintf("%s/api/heartbeat", c.ServerURL)
-	req, err := http.NewRequest("POST", url, nil)
+	if err := c.ensureFreshToken(ctx); err != nil {
+		return err
+	}
+
+	err := c.sendHeartbeat(ctx)
+
+	var rejected *RejectedError
+	if errors.As(err, &rejected) && rejected.StatusCode == http.StatusUnauthorized && c.Session().RefreshToken != "" {
+		if err := c.RefreshContext(ctx); err != nil {
+			return err
+		}
+		return c.sendHeartbeat(ctx)
+	}
+
+	// 离线时间超过租约时长后席位已被释放，重新借出即可恢复
+	if errors.As(err, &rejected) && rejected.Code == CodeLeaseExpired {
+		if err := c.checkoutSeat(ctx); err != nil {
+			return err
+		}
+		return c.sendHeartbeat(ctx)
+	}
+
+	return err
+}
+
+// checkoutSeat 使用当前令牌中的许可证密钥和硬件ID重新激活，借出新的浮动席位
+// 席位已被其他设备占满时返回 ErrNoSeats（*ServerError），心跳监控按连接失败处理，宽限期内持续重试
+func (c *Client) checkoutSeat(ctx context.Context) error {
+	claims, err := c.sessionClaims()
 	if err != nil {
-		return fmt.Errorf("failed to create heartbeat request: %w", err)
+		return fmt.Errorf("cannot check out a new seat: %w", err)
 	}
 
-	// 设置Authorization头
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
-	req.Header.Set("User-Agent", "SecureClient/1.0")
+	c.logf("[Auth] Seat lease expired, checking out a new seat")
+	return c.activate(ctx, claims.LicenseKey, claims.HWID, "")
+}
 
-	// TODO: 添加请求时间戳和签名防止重放攻击
-	// timestamp := time.Now().Unix()
-	// req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
-	// req.Header.Set("X-Signature", generateSignature(c.Token, timestamp))
+// sessionClaims 读取当前令牌中的许可证密钥和硬件ID
+// 验证签名但不检查有效期：租约过期时访问令牌通常也已过期
+func (c *Client) sessionClaims() (*Claims, error) {
+	if c.InsecureSkipVerify {
+		token := c.GetToken()
+		if token == "" {
+			return nil, fmt.Errorf("no token available, please activate first")
+		}
+		return decodeClaims(token)
+	}
+	return c.verifiedClaims()
+}
 
-	// 发送请求
-	resp, err := c.HTTPClient.Do(req)
+// sendHeartbeat 使用当前访问令牌发送一次心跳
+func (c *Client) sendHeartbeat(ctx context.Context) error {
+	session := c.Session()
+
+	// 发送心跳请求
+	url := fmt.Sprintf("%s/api/heartbeat", c.ServerURL)
+	resp, nonce, err := c.send(ctx, func(ctx context.Context) (*http.Request, string, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create heartbeat request: %w", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Token))
+
+		// 时间戳、随机数和签名防止重放和篡改
+		nonce, err := signRequest(req, session.RequestSecret, nil)
+		return req, nonce, err
+	})
 	if err != nil {
 		return fmt.Errorf("network error: %w", err)
 	}
@@ -159,35 +505,209 @@ func (c *Client) Heartbeat() error {
 		return fmt.Errorf("failed to read heartbeat response: %w", err)
 	}
 
+	// 未签名或签名错误的响应（包括拒绝）一律不可信，按连接失败处理
+	// 伪造的服务器因此无法维持许可证有效，离线宽限期结束后仍会执行失效处理
+	if err := c.verifyServerResponse(resp, body, nonce); err != nil {
+		return fmt.Errorf("untrusted heartbeat response: %w", err)
+	}
+
+	// 解析响应（错误响应同样带有错误码）
+	var heartbeatResp HeartbeatResponse
+	parseErr := json.Unmarshal(body, &heartbeatResp)
+
 	// 检查状态码
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return fmt.Errorf("license invalidated by server (status: %d)", resp.StatusCode)
+		return &RejectedError{StatusCode: resp.StatusCode, Status: heartbeatResp.Status, Code: heartbeatResp.Code}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("heartbeat failed with status code: %d", resp.StatusCode)
+		return fmt.Errorf("heartbeat failed: %w",
+			&ServerError{StatusCode: resp.StatusCode, Code: heartbeatResp.Code, Message: heartbeatResp.Error})
 	}
 
-	// 解析响应
-	var heartbeatResp HeartbeatResponse
-	if err := json.Unmarshal(body, &heartbeatResp); err != nil {
-		return fmt.Errorf("failed to parse heartbeat response: %w", err)
+	if parseErr != nil {
+		return fmt.Errorf("failed to parse heartbeat response: %w", parseErr)
 	}
 
 	// 验证心跳状态
 	if heartbeatResp.Status != "alive" {
-		return fmt.Errorf("license is no longer active: %s", heartbeatResp.Status)
+		return &RejectedError{StatusCode: resp.StatusCode, Status: heartbeatResp.Status}
 	}
 
+	c.mu.Lock()
+	c.LeaseExpiry = leaseExpiry(heartbeatResp.LeaseExpiresIn)
+	c.mu.Unlock()
 	return nil
 }
 
+// leaseExpiry 将席位租约剩余秒数换算为到期时间，未返回租约（节点锁定许可证）时为零值
+func leaseExpiry(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+// DeactivateResponse 解绑响应结构
+type DeactivateResponse struct {
+	Status        string `json:"status"`
+	Devices       int    `json:"devices"`
+	TransfersLeft int    `json:"transfers_left"`
+	Error         string `json:"error,omitempty"`
+	Code          string `json:"code,omitempty"`
+}
+
+// Deactivate 解除当前设备的许可证绑定
+// 使用激活时获得的令牌释放设备槽位，之后可在新设备上重新激活
+// 成功后清除客户端中存储的令牌
+func (c *Client) Deactivate() (*DeactivateResponse, error) {
+	return c.DeactivateContext(context.Background())
+}
+
+// DeactivateContext 解除设备绑定，ctx 取消或超时时中止请求
+func (c *Client) DeactivateContext(ctx context.Context) (*DeactivateResponse, error) {
+	if !c.IsAuthenticated() {
+		return nil, fmt.Errorf("no token available, please activate first")
+	}
+
+	if err := c.ensureFreshToken(ctx); err != nil {
+		return nil, err
+	}
+	session := c.Session()
+
+	url := fmt.Sprintf("%s/api/deactivate", c.ServerURL)
+	resp, nonce, err := c.send(ctx, func(ctx context.Context) (*http.Request, string, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create deactivation request: %w", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Token))
+
+		nonce, err := signRequest(req, session.RequestSecret, nil)
+		return req, nonce, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send deactivation request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// 未经验证的响应不能清除会话，否则伪造的服务器可以让客户端丢弃有效的授权
+	if err := c.verifyServerResponse(resp, body, nonce); err != nil {
+		return nil, fmt.Errorf("untrusted deactivation response: %w", err)
+	}
+
+	var deactivateResp DeactivateResponse
+	if err := json.Unmarshal(body, &deactivateResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("deactivation failed: %w",
+			&ServerError{StatusCode: resp.StatusCode, Code: deactivateResp.Code, Message: deactivateResp.Error})
+	}
+
+	if deactivateResp.Status != "success" {
+		return nil, fmt.Errorf("deactivation unsuccessful: %s", deactivateResp.Status)
+	}
+
+	// 设备已解绑，旧令牌不再可用
+	c.mu.Lock()
+	c.Token = ""
+	c.RefreshToken = ""
+	c.RequestSecret = ""
+	c.LeaseExpiry = time.Time{}
+	c.mu.Unlock()
+	c.sessionChanged()
+	return &deactivateResp, nil
+}
+
+// Session 返回当前会话，保存后可通过 Resume 恢复
+func (c *Client) Session() Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Session{
+		Token:         c.Token,
+		RefreshToken:  c.RefreshToken,
+		RequestSecret: c.RequestSecret,
+	}
+}
+
+// Resume 恢复之前保存的会话，无需重新激活即可发送心跳（访问令牌过期时自动刷新）
+func (c *Client) Resume(session Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Token = session.Token
+	c.RefreshToken = session.RefreshToken
+	c.RequestSecret = session.RequestSecret
+}
+
+// sessionChanged 通知会话变化
+func (c *Client) sessionChanged() {
+	if c.OnSessionChange != nil {
+		c.OnSessionChange(c.Session())
+	}
+}
+
 // GetToken 获取当前存储的令牌
 func (c *Client) GetToken() string {
-	return c.Token
+	return c.Session().Token
+}
+
+// Lease 返回浮动许可证席位租约的到期时间，节点锁定许可证为零值
+func (c *Client) Lease() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.LeaseExpiry
+}
+
+// VerifyToken 在本地验证当前令牌的签名和有效期
+// 可用于离线启动时确认已保存的令牌仍然有效
+func (c *Client) VerifyToken() (*Claims, error) {
+	token := c.GetToken()
+	if token == "" {
+		return nil, fmt.Errorf("no token available, please activate first")
+	}
+	return VerifyToken(token, c.PublicKeys...)
+}
+
+// HasFeature 检查当前令牌是否包含指定功能，未激活或令牌无法验证（包括没有公钥）时返回 false
+// 令牌在每次刷新时重新签发，管理员修改的授权内容随之生效
+func (c *Client) HasFeature(feature string) bool {
+	claims, err := c.verifiedClaims()
+	return err == nil && claims.HasFeature(feature)
+}
+
+// Limit 返回当前令牌中的数值限制（如 max_projects），令牌中没有该限制或令牌无法验证时返回 0, false
+func (c *Client) Limit(name string) (limit int64, ok bool) {
+	claims, err := c.verifiedClaims()
+	if err != nil {
+		return 0, false
+	}
+	return claims.Limit(name)
+}
+
+// verifiedClaims 读取并验证当前令牌中的声明，没有公钥或签名无效时返回错误
+// 未经验证的声明可以随意修改，不能用于开启功能（InsecureSkipVerify 时同样如此）
+// 不检查有效期：许可证是否仍然有效由心跳决定，离线宽限期内功能保持不变
+func (c *Client) verifiedClaims() (*Claims, error) {
+	token := c.GetToken()
+	if token == "" {
+		return nil, fmt.Errorf("no token available, please activate first")
+	}
+
+	var claims Claims
+	if err := verifySignedToken(token, "JWT", c.PublicKeys, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
 }
 
 // IsAuthenticated 检查是否已认证
 func (c *Client) IsAuthenticated() bool {
-	return c.Token != ""
+	return c.GetToken() != ""
 }
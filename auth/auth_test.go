@@ -0,0 +1,570 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer 模拟许可证服务器：签发令牌并按服务器的格式签名响应
+type testServer struct {
+	*httptest.Server
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+
+	mu             sync.Mutex
+	refreshTokens  map[string]bool // 刷新令牌 -> 是否已使用
+	refreshCounter int
+	handlers       map[string]http.HandlerFunc
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	s := &testServer{
+		privateKey:    privateKey,
+		publicKey:     publicKey,
+		refreshTokens: map[string]bool{"rt_0": false},
+		handlers:      map[string]http.HandlerFunc{},
+	}
+	s.handlers["/api/heartbeat"] = func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, http.StatusOK, map[string]interface{}{"status": "alive", "lease_expires_in": 300})
+	}
+	s.handlers["/api/refresh"] = s.handleRefresh
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		handler := s.handlers[r.URL.Path]
+		s.mu.Unlock()
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// handle 替换指定路径的处理函数
+func (s *testServer) handle(path string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[path] = handler
+}
+
+// handleRefresh 轮换刷新令牌，重复使用已轮换的令牌时返回 refresh_token_reused
+func (s *testServer) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	used, known := s.refreshTokens[req.RefreshToken]
+	if !known || used {
+		s.mu.Unlock()
+		s.respond(w, r, http.StatusUnauthorized, map[string]interface{}{"error": "refresh token reused", "code": CodeRefreshReused})
+		return
+	}
+	s.refreshTokens[req.RefreshToken] = true
+	s.refreshCounter++
+	next := fmt.Sprintf("rt_%d", s.refreshCounter)
+	s.refreshTokens[next] = false
+	s.mu.Unlock()
+
+	s.respond(w, r, http.StatusOK, map[string]interface{}{
+		"status":        "success",
+		"token":         s.token(Claims{LicenseKey: "KEY-1", HWID: "hwid-a", ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+		"refresh_token": next,
+	})
+}
+
+// token 签发 EdDSA 令牌
+func (s *testServer) token(claims Claims) string {
+	header, _ := json.Marshal(tokenHeader{Alg: "EdDSA", Typ: "JWT", Kid: KeyID(s.publicKey)})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.privateKey, []byte(signingInput)))
+}
+
+// respond 写入 JSON 响应并按 verifyResponse 的格式签名
+func (s *testServer) respond(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	data, _ := json.Marshal(body)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	bodyHash := sha256.Sum256(data)
+	message := strconv.Itoa(status) + "\n" + r.URL.Path + "\n" + r.Header.Get(HeaderNonce) + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(HeaderServerTimestamp, timestamp)
+	w.Header().Set(HeaderServerKeyID, KeyID(s.publicKey))
+	w.Header().Set(HeaderServerSignature, base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.privateKey, []byte(message))))
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// client 创建信任该服务器公钥并已恢复会话的客户端
+func (s *testServer) client(t *testing.T) *Client {
+	t.Helper()
+	c, err := New(s.URL, WithPublicKeys(s.publicKey))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.Resume(Session{
+		Token:         s.token(Claims{LicenseKey: "KEY-1", HWID: "hwid-a", ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+		RefreshToken:  "rt_0",
+		RequestSecret: "secret",
+	})
+	return c
+}
+
+func TestClientConcurrentSessionAccess(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client(t)
+
+	var saved sync.Mutex
+	var sessions []Session
+	c.OnSessionChange = func(session Session) {
+		saved.Lock()
+		sessions = append(sessions, session)
+		saved.Unlock()
+	}
+
+	// 心跳协程、应用刷新令牌和读取会话同时进行
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := c.Heartbeat(); err != nil {
+				t.Errorf("Heartbeat: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := c.Refresh(); err != nil {
+				t.Errorf("Refresh: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c.Session()
+			c.Lease()
+			c.IsAuthenticated()
+			c.HasFeature("premium")
+		}()
+	}
+	wg.Wait()
+
+	// 刷新串行执行，每次都使用上一次轮换得到的刷新令牌，不会触发重用检测
+	if got := c.Session().RefreshToken; got != "rt_8" {
+		t.Fatalf("refresh token = %q, want rt_8", got)
+	}
+	if len(sessions) != 8 {
+		t.Fatalf("session saved %d times, want 8", len(sessions))
+	}
+	if c.Lease().IsZero() {
+		t.Fatal("lease expiry not recorded")
+	}
+}
+
+func TestNewRequiresPublicKey(t *testing.T) {
+	defer func(embedded string) { PublicKey = embedded }(PublicKey)
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	PublicKey = ""
+	if _, err := New("http://localhost"); !errors.Is(err, ErrNoPublicKey) {
+		t.Fatalf("no public key: %v, want ErrNoPublicKey", err)
+	}
+	if c, err := New("http://localhost", WithInsecureSkipVerify()); err != nil || !c.InsecureSkipVerify {
+		t.Fatalf("insecure client: %v", err)
+	}
+	if _, err := New("http://localhost", WithPublicKeys(publicKey)); err != nil {
+		t.Fatalf("explicit public key: %v", err)
+	}
+
+	// 嵌入的公钥格式错误是编译错误，不能静默退化为不验证
+	PublicKey = "not-a-key"
+	if _, err := New("http://localhost", WithInsecureSkipVerify()); err == nil {
+		t.Fatal("malformed embedded public key accepted")
+	}
+
+	PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+	c, err := New("http://localhost")
+	if err != nil || len(c.PublicKeys) != 1 {
+		t.Fatalf("embedded public key: %v", err)
+	}
+}
+
+// NewClient 保留旧版签名：不返回错误，没有公钥时在验证响应时失败
+func TestNewClient(t *testing.T) {
+	defer func(embedded string) { PublicKey = embedded }(PublicKey)
+	s := newTestServer(t)
+
+	heartbeat := func(c *Client) error {
+		c.Resume(Session{
+			Token:         s.token(Claims{LicenseKey: "KEY-1", HWID: "hwid-a", ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+			RefreshToken:  "rt_0",
+			RequestSecret: "secret",
+		})
+		return c.Heartbeat()
+	}
+
+	for _, embedded := range []string{"", "not-a-key"} {
+		PublicKey = embedded
+		c := NewClient(s.URL)
+		if c == nil || c.HTTPClient == nil || len(c.PublicKeys) != 0 {
+			t.Fatalf("NewClient with embedded key %q: %+v", embedded, c)
+		}
+		if err := heartbeat(c); !errors.Is(err, ErrNoPublicKey) {
+			t.Fatalf("heartbeat with embedded key %q: %v, want ErrNoPublicKey", embedded, err)
+		}
+	}
+
+	PublicKey = base64.StdEncoding.EncodeToString(s.publicKey)
+	if err := heartbeat(NewClient(s.URL)); err != nil {
+		t.Fatalf("heartbeat with embedded key: %v", err)
+	}
+}
+
+func TestClientRejectsUntrustedResponses(t *testing.T) {
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		handler func(s *testServer) http.HandlerFunc
+		client  func(c *Client)
+	}{
+		{
+			name: "unsigned",
+			handler: func(s *testServer) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					json.NewEncoder(w).Encode(map[string]interface{}{"status": "alive"})
+				}
+			},
+		},
+		{
+			name: "signed by another key",
+			handler: func(s *testServer) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					// 声称使用服务器的 kid，但由另一把私钥签名
+					forged := &testServer{privateKey: otherKey, publicKey: s.publicKey}
+					forged.respond(w, r, http.StatusOK, map[string]interface{}{"status": "alive"})
+				}
+			},
+		},
+		{
+			name: "client without public keys",
+			handler: func(s *testServer) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					s.respond(w, r, http.StatusOK, map[string]interface{}{"status": "alive"})
+				}
+			},
+			client: func(c *Client) { c.PublicKeys = nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			c := s.client(t)
+			s.handle("/api/heartbeat", tt.handler(s))
+			if tt.client != nil {
+				tt.client(c)
+			}
+
+			err := c.Heartbeat()
+			if err == nil {
+				t.Fatal("untrusted heartbeat response accepted")
+			}
+			// 不可信的响应按连接失败处理，不能被当作服务器的拒绝
+			var rejected *RejectedError
+			if errors.As(err, &rejected) {
+				t.Fatalf("untrusted response treated as rejection: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientAcrossSigningKeyRotation(t *testing.T) {
+	s := newTestServer(t)
+	oldKey := s.publicKey
+	nextPublic, nextPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	newClient := func(publicKeys ...ed25519.PublicKey) *Client {
+		c, err := New(s.URL, WithPublicKeys(publicKeys...))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		c.Resume(Session{
+			Token:         s.token(Claims{LicenseKey: "KEY-1", HWID: "hwid-a", ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+			RefreshToken:  "rt_0",
+			RequestSecret: "secret",
+		})
+		return c
+	}
+	// 生成待启用密钥后发布的客户端同时嵌入新旧公钥，更早的客户端只有旧公钥
+	released := newClient(oldKey, nextPublic)
+	outdated := newClient(oldKey)
+
+	if err := released.Heartbeat(); err != nil {
+		t.Fatalf("released client before rotation: %v", err)
+	}
+
+	// 服务器提升新密钥，此后的令牌和响应都由新密钥签名
+	s.privateKey, s.publicKey = nextPrivate, nextPublic
+
+	if err := released.Heartbeat(); err != nil {
+		t.Fatalf("released client after rotation: %v", err)
+	}
+	if err := released.Refresh(); err != nil {
+		t.Fatalf("released client refresh after rotation: %v", err)
+	}
+	if _, err := VerifyToken(released.GetToken(), nextPublic); err != nil {
+		t.Fatalf("refreshed token not signed by the new key: %v", err)
+	}
+
+	// 提前轮换的代价：旧客户端把所有响应当作伪造，离线宽限期结束后停止运行
+	err := outdated.Heartbeat()
+	if err == nil {
+		t.Fatal("client without the new public key accepted a response signed by it")
+	}
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		t.Fatalf("untrusted response treated as rejection: %v", err)
+	}
+}
+
+func TestDeactivateRequiresVerifiedResponse(t *testing.T) {
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name      string
+		respond   func(s *testServer, w http.ResponseWriter, r *http.Request)
+		wantClear bool
+	}{
+		{
+			name: "signed success",
+			respond: func(s *testServer, w http.ResponseWriter, r *http.Request) {
+				s.respond(w, r, http.StatusOK, map[string]interface{}{"status": "success"})
+			},
+			wantClear: true,
+		},
+		{
+			name: "unsigned success",
+			respond: func(s *testServer, w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+			},
+		},
+		{
+			name: "signed by another key",
+			respond: func(s *testServer, w http.ResponseWriter, r *http.Request) {
+				forged := &testServer{privateKey: otherKey, publicKey: s.publicKey}
+				forged.respond(w, r, http.StatusOK, map[string]interface{}{"status": "success"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			c := s.client(t)
+			s.handle("/api/deactivate", func(w http.ResponseWriter, r *http.Request) {
+				tt.respond(s, w, r)
+			})
+
+			var saved int
+			c.OnSessionChange = func(Session) { saved++ }
+
+			_, err := c.Deactivate()
+			if tt.wantClear {
+				if err != nil || c.IsAuthenticated() || saved != 1 {
+					t.Fatalf("Deactivate: %v, authenticated %v, saved %d", err, c.IsAuthenticated(), saved)
+				}
+				return
+			}
+
+			// 伪造的服务器不能让客户端丢弃有效会话
+			if err == nil {
+				t.Fatal("untrusted deactivation response accepted")
+			}
+			if c.Session().RefreshToken != "rt_0" || saved != 0 {
+				t.Fatalf("session cleared by untrusted response: %+v", c.Session())
+			}
+		})
+	}
+}
+
+func TestHeartbeatRechecksOutExpiredLease(t *testing.T) {
+	tests := []struct {
+		name         string
+		activate     func(s *testServer) http.HandlerFunc
+		wantErr      error
+		wantActivate int
+	}{
+		{
+			name: "seat available",
+			activate: func(s *testServer) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					var req ActivateRequest
+					json.NewDecoder(r.Body).Decode(&req)
+					s.respond(w, r, http.StatusOK, map[string]interface{}{
+						"status":           "success",
+						"token":            s.token(Claims{LicenseKey: req.Key, HWID: req.HWID, ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+						"refresh_token":    "rt_new",
+						"request_secret":   "secret_new",
+						"lease_expires_in": 300,
+					})
+				}
+			},
+			wantActivate: 1,
+		},
+		{
+			name: "seats taken",
+			activate: func(s *testServer) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					s.respond(w, r, http.StatusForbidden, map[string]interface{}{
+						"error": "No seats available", "code": CodeNoSeats, "seats_in_use": 5, "max_seats": 5,
+					})
+				}
+			},
+			wantErr:      ErrNoSeats,
+			wantActivate: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			c := s.client(t)
+
+			// 离线超过租约时长：第一次心跳返回 lease_expired，重新借出席位后恢复
+			var heartbeats int
+			s.handle("/api/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+				heartbeats++
+				if heartbeats == 1 {
+					s.respond(w, r, http.StatusForbidden, map[string]interface{}{"status": "dead", "code": CodeLeaseExpired})
+					return
+				}
+				s.respond(w, r, http.StatusOK, map[string]interface{}{"status": "alive", "lease_expires_in": 300})
+			})
+			var activations int
+			activate := tt.activate(s)
+			s.handle("/api/activate", func(w http.ResponseWriter, r *http.Request) {
+				activations++
+				activate(w, r)
+			})
+
+			err := c.Heartbeat()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Heartbeat: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Heartbeat error = %v, want %v", err, tt.wantErr)
+			}
+			if activations != tt.wantActivate {
+				t.Fatalf("activations = %d, want %d", activations, tt.wantActivate)
+			}
+
+			// 无论能否重新借出席位，都不能被心跳监控当作吊销而立即终止程序
+			var rejected *RejectedError
+			if errors.As(err, &rejected) && rejected.Revoked() {
+				t.Fatalf("lease expiry treated as revocation: %v", err)
+			}
+			if tt.wantErr == nil && (c.Session().RefreshToken != "rt_new" || c.Lease().IsZero()) {
+				t.Fatalf("new seat session not stored: %+v", c.Session())
+			}
+		})
+	}
+}
+
+func TestRejectedErrorRevoked(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{CodeBanned, true},
+		{CodeExpired, true},
+		{CodeHWIDMismatch, true},
+		{CodeTokenRevoked, true},
+		{"", true},
+		{CodeLeaseExpired, false},
+	}
+	for _, tt := range tests {
+		err := &RejectedError{StatusCode: http.StatusForbidden, Code: tt.code}
+		if got := err.Revoked(); got != tt.want {
+			t.Errorf("RejectedError{Code: %q}.Revoked() = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestClientEntitlementsRequireVerifiedToken(t *testing.T) {
+	s := newTestServer(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forger := &testServer{privateKey: otherKey, publicKey: s.publicKey}
+
+	entitled := Claims{
+		LicenseKey: "KEY-1",
+		HWID:       "hwid-a",
+		Features:   []string{"premium"},
+		Limits:     map[string]int64{"max_projects": 10},
+		ExpiresAt:  time.Now().Add(time.Hour).Unix(),
+	}
+	expired := entitled
+	expired.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+
+	// tamper 修改已签名令牌的载荷而保留原签名
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(Claims{LicenseKey: "KEY-1", HWID: "hwid-a", Features: []string{"premium"}, Limits: map[string]int64{"max_projects": 1000}})
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		insecure  bool
+		wantOK    bool
+		wantLimit int64
+	}{
+		{"signed token", s.token(entitled), false, true, 10},
+		{"expired token keeps entitlements during grace", s.token(expired), false, true, 10},
+		{"signed by another key", forger.token(entitled), false, false, 0},
+		{"tampered payload", tamper(s.token(Claims{LicenseKey: "KEY-1", HWID: "hwid-a"})), false, false, 0},
+		{"no public keys", s.token(entitled), true, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *Client
+			if tt.insecure {
+				var err error
+				if c, err = New(s.URL, WithInsecureSkipVerify(), WithPublicKeys()); err != nil {
+					t.Fatalf("New: %v", err)
+				}
+			} else {
+				c = s.client(t)
+			}
+			c.Resume(Session{Token: tt.token, RefreshToken: "rt_0", RequestSecret: "secret"})
+
+			if got := c.HasFeature("premium"); got != tt.wantOK {
+				t.Errorf("HasFeature(premium) = %v, want %v", got, tt.wantOK)
+			}
+			limit, ok := c.Limit("max_projects")
+			if ok != tt.wantOK || limit != tt.wantLimit {
+				t.Errorf("Limit(max_projects) = %d, %v, want %d, %v", limit, ok, tt.wantLimit, tt.wantOK)
+			}
+		})
+	}
+}
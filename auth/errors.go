@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 服务器错误码，与服务器保持一致
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeBanned           = "banned"
+	CodeExpired          = "expired"
+	CodeInactive         = "inactive"
+	CodeHWIDMismatch     = "hwid_mismatch"
+	CodeDeviceLimit      = "device_limit"
+	CodeTransferLimit    = "transfer_limit"
+	CodeRateLimited      = "rate_limited"
+	CodeTokenInvalid     = "token_invalid"
+	CodeTokenRevoked     = "token_revoked"
+	CodeRefreshInvalid   = "refresh_invalid"
+	CodeRefreshReused    = "refresh_reused"
+	CodeInternal         = "internal_error"
+	CodeSignatureMissing = "signature_missing"
+	CodeRequestStale     = "request_stale"
+	CodeRequestReplayed  = "request_replayed"
+	CodeSignatureInvalid = "signature_invalid"
+
+	CodeVirtualizationDenied = "virtualization_denied"
+
+	CodeNoSeats      = "no_seats"
+	CodeLeaseExpired = "lease_expired"
+
+	CodeTrialUnavailable = "trial_unavailable"
+	CodeTrialUsed        = "trial_used"
+)
+
+// 服务器返回的失败原因，通过 errors.Is 判断，例如 errors.Is(err, auth.ErrBanned)
+var (
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrNotFound         = errors.New("license not found")
+	ErrBanned           = errors.New("license banned")
+	ErrExpired          = errors.New("license expired")
+	ErrInactive         = errors.New("license not active")
+	ErrHWIDMismatch     = errors.New("device not registered to this license")
+	ErrDeviceLimit      = errors.New("device limit reached")
+	ErrTransferLimit    = errors.New("device transfer limit reached")
+	ErrRateLimited      = errors.New("too many requests")
+	ErrTokenInvalid     = errors.New("access token invalid")
+	ErrTokenRevoked     = errors.New("access token revoked")
+	ErrRefreshInvalid   = errors.New("refresh token invalid")
+	ErrRefreshReused    = errors.New("refresh token reuse detected")
+	ErrServer           = errors.New("license server error")
+	ErrSignatureMissing = errors.New("request signature missing")
+	ErrRequestStale     = errors.New("request timestamp outside allowed window, check system clock")
+	ErrRequestReplayed  = errors.New("request replayed")
+	ErrSignatureInvalid = errors.New("request signature invalid")
+
+	ErrVirtualizationDenied = errors.New("activation in virtual machines or containers is not allowed")
+
+	ErrNoSeats      = errors.New("no seats available")
+	ErrLeaseExpired = errors.New("floating license seat lease expired")
+
+	ErrTrialUnavailable = errors.New("no trial available for this product")
+	ErrTrialUsed        = errors.New("trial already used on this device")
+)
+
+// codeErrors 错误码对应的哨兵错误
+var codeErrors = map[string]error{
+	CodeInvalidRequest:   ErrInvalidRequest,
+	CodeNotFound:         ErrNotFound,
+	CodeBanned:           ErrBanned,
+	CodeExpired:          ErrExpired,
+	CodeInactive:         ErrInactive,
+	CodeHWIDMismatch:     ErrHWIDMismatch,
+	CodeDeviceLimit:      ErrDeviceLimit,
+	CodeTransferLimit:    ErrTransferLimit,
+	CodeRateLimited:      ErrRateLimited,
+	CodeTokenInvalid:     ErrTokenInvalid,
+	CodeTokenRevoked:     ErrTokenRevoked,
+	CodeRefreshInvalid:   ErrRefreshInvalid,
+	CodeRefreshReused:    ErrRefreshReused,
+	CodeInternal:         ErrServer,
+	CodeSignatureMissing: ErrSignatureMissing,
+	CodeRequestStale:     ErrRequestStale,
+	CodeRequestReplayed:  ErrRequestReplayed,
+	CodeSignatureInvalid: ErrSignatureInvalid,
+
+	CodeVirtualizationDenied: ErrVirtualizationDenied,
+
+	CodeNoSeats:      ErrNoSeats,
+	CodeLeaseExpired: ErrLeaseExpired,
+
+	CodeTrialUnavailable: ErrTrialUnavailable,
+	CodeTrialUsed:        ErrTrialUsed,
+}
+
+// codeError 返回错误码对应的哨兵错误
+// 旧版本服务器不返回错误码，此时按 HTTP 状态码推断（无法推断时返回 nil）
+func codeError(code string, statusCode int) error {
+	if err, ok := codeErrors[code]; ok {
+		return err
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+	return nil
+}
+
+// ServerError 服务器返回的错误响应
+// 可通过 errors.Is 与哨兵错误比较，或通过 errors.As 读取状态码和原始说明
+type ServerError struct {
+	StatusCode int
+	Code       string // 错误码，旧版本服务器为空
+	Message    string // 服务器返回的说明文字
+
+	// 浮动许可证席位已满（ErrNoSeats）时为当前占用的席位数和席位总数
+	SeatsInUse int
+	MaxSeats   int
+}
+
+func (e *ServerError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.Code == CodeNoSeats {
+		message = fmt.Sprintf("%s (%d/%d in use)", message, e.SeatsInUse, e.MaxSeats)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s (status: %d, code: %s)", message, e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("%s (status: %d)", message, e.StatusCode)
+}
+
+// Is 支持 errors.Is(err, auth.ErrBanned) 等判断
+func (e *ServerError) Is(target error) bool {
+	sentinel := codeError(e.Code, e.StatusCode)
+	return sentinel != nil && sentinel == target
+}
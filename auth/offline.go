@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LicenseFileType 离线许可证文件的 JWT 头部 typ，与在线令牌区分
+const LicenseFileType = "license"
+
+// OfflineRequest 离线激活请求文件
+// 由无法联网的客户端生成，交给管理员通过 /api/admin/offline-license 换取许可证文件
+// 请求以许可证密钥为 HMAC 密钥签名：不知道许可证密钥的人修改文件（如替换 HWID）会被服务器发现
+// 持有许可证密钥的人可以重新签名，但只能为自己的许可证生成请求
+type OfflineRequest struct {
+	LicenseKey string `json:"license_key"`
+	HWID       string `json:"hwid"`
+	CreatedAt  int64  `json:"created_at"`
+	Signature  string `json:"signature"` // base64(HMAC-SHA256(license_key, 签名内容))
+}
+
+// LicenseClaims 离线许可证文件中的声明
+type LicenseClaims struct {
+	LicenseKey string           `json:"license_key"`
+	HWID       string           `json:"hwid"`
+	Product    string           `json:"product"`
+	Features   []string         `json:"features"`
+	Limits     map[string]int64 `json:"limits,omitempty"`
+	ExpiresAt  int64            `json:"exp"`
+	IssuedAt   int64            `json:"iat"`
+}
+
+// Expiry 返回许可证过期时间
+func (c *LicenseClaims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// HasFeature 检查许可证是否包含指定功能
+func (c *LicenseClaims) HasFeature(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit 返回许可证中指定的数值限制，没有该限制时 ok 为 false
+func (c *LicenseClaims) Limit(name string) (limit int64, ok bool) {
+	limit, ok = c.Limits[name]
+	return limit, ok
+}
+
+// signOfflineRequest 计算离线请求的签名，签名内容和算法必须与服务器保持一致
+func signOfflineRequest(licenseKey, hwid string, createdAt int64) string {
+	mac := hmac.New(sha256.New, []byte(licenseKey))
+	fmt.Fprintf(mac, "%s\n%s\n%d", licenseKey, hwid, createdAt)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewOfflineRequest 生成签名的离线激活请求
+func NewOfflineRequest(licenseKey, hwid string) (*OfflineRequest, error) {
+	if licenseKey == "" || hwid == "" {
+		return nil, fmt.Errorf("license key and hwid are required")
+	}
+
+	createdAt := time.Now().Unix()
+	return &OfflineRequest{
+		LicenseKey: licenseKey,
+		HWID:       hwid,
+		CreatedAt:  createdAt,
+		Signature:  signOfflineRequest(licenseKey, hwid, createdAt),
+	}, nil
+}
+
+// WriteOfflineRequest 生成离线激活请求并写入文件
+func WriteOfflineRequest(path, licenseKey, hwid string) error {
+	req, err := NewOfflineRequest(licenseKey, hwid)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write request file: %w", err)
+	}
+	return nil
+}
+
+// VerifyLicenseFile 在本地验证离线许可证文件（无需联网）
+// 检查签名、文件类型、有效期以及是否绑定当前设备
+func VerifyLicenseFile(data []byte, hwid string, publicKeys ...ed25519.PublicKey) (*LicenseClaims, error) {
+	var claims LicenseClaims
+	if err := verifySignedToken(strings.TrimSpace(string(data)), LicenseFileType, publicKeys, &claims); err != nil {
+		return nil, err
+	}
+
+	if claims.HWID != hwid {
+		return nil, fmt.Errorf("license file is bound to a different device")
+	}
+
+	if claims.ExpiresAt != 0 && time.Now().After(claims.Expiry()) {
+		return nil, fmt.Errorf("license expired at %s", claims.Expiry().Format(time.RFC3339))
+	}
+
+	return &claims, nil
+}
+
+// LoadLicenseFile 读取并验证离线许可证文件
+func (c *Client) LoadLicenseFile(path, hwid string) (*LicenseClaims, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license file: %w", err)
+	}
+	return VerifyLicenseFile(data, hwid, c.PublicKeys...)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// offlineRequestVector 服务器测试中使用相同的签名向量，保证双方签名格式一致
+const offlineRequestVector = "HSICwerB7+wB9OaIHn9HCWY5wzDee/dzhO0/VlER3Io="
+
+func TestOfflineRequestSignature(t *testing.T) {
+	if got := signOfflineRequest("KEY-1", "hwid-a", 1700000000); got != offlineRequestVector {
+		t.Fatalf("signature = %s, want %s", got, offlineRequestVector)
+	}
+
+	path := filepath.Join(t.TempDir(), "request.json")
+	if err := WriteOfflineRequest(path, "KEY-1", "hwid-a"); err != nil {
+		t.Fatalf("WriteOfflineRequest: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var req OfflineRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("request file: %v", err)
+	}
+	if req.LicenseKey != "KEY-1" || req.HWID != "hwid-a" || req.Signature != signOfflineRequest("KEY-1", "hwid-a", req.CreatedAt) {
+		t.Fatalf("request = %+v", req)
+	}
+
+	if _, err := NewOfflineRequest("KEY-1", ""); err == nil {
+		t.Fatal("request without hwid accepted")
+	}
+}
+
+func TestVerifyLicenseFile(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	kid := KeyID(publicKey)
+
+	claims := func(exp time.Time) LicenseClaims {
+		return LicenseClaims{
+			LicenseKey: "KEY-1",
+			HWID:       "hwid-a",
+			Product:    "Pro",
+			Features:   []string{"export"},
+			Limits:     map[string]int64{"max_projects": 5},
+			ExpiresAt:  exp.Unix(),
+		}
+	}
+	valid := signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: LicenseFileType, Kid: kid}, claims(time.Now().AddDate(1, 0, 0)))
+
+	tests := []struct {
+		name    string
+		file    string
+		hwid    string
+		wantErr bool
+	}{
+		{"valid", valid, "hwid-a", false},
+		{"trailing newline", valid + "\n", "hwid-a", false},
+		{"other device", valid, "hwid-b", true},
+		{"expired", signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: LicenseFileType, Kid: kid}, claims(time.Now().Add(-time.Hour))), "hwid-a", true},
+		{"untrusted key", signToken(otherKey, tokenHeader{Alg: "EdDSA", Typ: LicenseFileType, Kid: kid}, claims(time.Now().AddDate(1, 0, 0))), "hwid-a", true},
+		{"online token", signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: "JWT", Kid: kid}, claims(time.Now().AddDate(1, 0, 0))), "hwid-a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyLicenseFile([]byte(tt.file), tt.hwid, publicKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("VerifyLicenseFile accepted the file: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyLicenseFile: %v", err)
+			}
+			if !got.HasFeature("export") || got.HasFeature("beta") {
+				t.Fatalf("features = %v", got.Features)
+			}
+			if limit, ok := got.Limit("max_projects"); !ok || limit != 5 {
+				t.Fatalf("max_projects = %d %v", limit, ok)
+			}
+		})
+	}
+
+	// 离线许可证文件不能当作在线令牌使用
+	if _, err := VerifyToken(valid, publicKey); err == nil {
+		t.Fatal("license file accepted as an access token")
+	}
+
+	path := filepath.Join(t.TempDir(), "app.lic")
+	os.WriteFile(path, []byte(valid), 0644)
+	c, _ := New("http://localhost", WithPublicKeys(publicKey))
+	if _, err := c.LoadLicenseFile(path, "hwid-a"); err != nil {
+		t.Fatalf("LoadLicenseFile: %v", err)
+	}
+}
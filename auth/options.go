@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 客户端默认设置
+const (
+	DefaultTimeout   = 10 * time.Second
+	DefaultUserAgent = "SecureClient/1.0"
+)
+
+// Logger 客户端日志接口，*log.Logger 即满足
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// RetryPolicy 网络错误时的重试策略
+// 只重试连接失败等网络错误，服务器的明确响应（包括拒绝）不会重试
+type RetryPolicy struct {
+	MaxAttempts int           // 总尝试次数，小于等于1表示不重试
+	Delay       time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 等待时间上限，0 表示不限制
+}
+
+// backoff 返回第 attempt 次重试（从1开始）前的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Option 客户端配置选项
+type Option func(*Client)
+
+// WithTimeout 设置单次 HTTP 请求的超时时间（默认10秒）
+// 需要按调用设置截止时间时使用带 context 的方法
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.HTTPClient.Timeout = timeout
+	}
+}
+
+// WithUserAgent 设置请求的 User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithProxy 通过指定代理连接服务器，传入 nil 则不使用任何代理（包括环境变量中的代理）
+// HTTP 客户端使用自定义 RoundTripper 时 New 返回 ErrCustomTransport
+func WithProxy(proxyURL *url.URL) Option {
+	return func(c *Client) {
+		transport, err := c.transport()
+		if err != nil {
+			c.setOptionErr(err)
+			return
+		}
+		if proxyURL == nil {
+			transport.Proxy = nil
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+}
+
+// WithTLS 启用证书固定、最低 TLS 版本、自定义根证书和客户端证书（见 TLSOptions）
+// 在其他选项之后应用，与 WithHTTPClient 的先后顺序无关；设置无效时 New 返回错误
+func WithTLS(opts TLSOptions) Option {
+	return func(c *Client) {
+		c.tlsOptions = &opts
+	}
+}
+
+// WithRetryPolicy 设置网络错误时的重试策略（默认不重试）
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.Retry = policy
+	}
+}
+
+// WithLogger 设置日志输出（默认不输出）
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.Logger = logger
+	}
+}
+
+// WithOnSessionChange 设置会话变化回调，用于持久化令牌
+func WithOnSessionChange(fn func(Session)) Option {
+	return func(c *Client) {
+		c.OnSessionChange = fn
+	}
+}
+
+// WithFingerprint 激活时附带结构化硬件指纹，硬件部分变化后仍识别为同一台设备
+func WithFingerprint(fingerprint map[string]string) Option {
+	return func(c *Client) {
+		c.Fingerprint = fingerprint
+	}
+}
+
+// WithPreviousHWID 激活时附带升级前的硬件ID，硬件ID算法变化后迁移原设备绑定
+func WithPreviousHWID(hwid string) Option {
+	return func(c *Client) {
+		c.PreviousHWID = hwid
+	}
+}
+
+// WithEnvironment 激活时上报运行环境，服务器据此执行虚拟化策略
+func WithEnvironment(env Environment) Option {
+	return func(c *Client) {
+		c.Environment = &env
+	}
+}
+
+// WithHTTPClient 使用自定义的 HTTP 客户端（例如测试时使用 httptest 服务器的客户端）
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithInsecureSkipVerify 不验证服务器响应和令牌签名，任何人都能冒充许可证服务器
+// 仅用于连接本地测试服务器（test-server.go），发布版本必须嵌入公钥
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.InsecureSkipVerify = true
+	}
+}
+
+// WithPublicKeys 使用指定的公钥代替嵌入的 auth.PublicKey
+func WithPublicKeys(publicKeys ...ed25519.PublicKey) Option {
+	return func(c *Client) {
+		c.PublicKeys = publicKeys
+	}
+}
+
+// ErrCustomTransport HTTP 客户端使用了自定义 RoundTripper，无法应用 TLS 或代理设置
+// 替换它会丢掉调用方的包装（如日志、鉴权），需直接在该 RoundTripper 内部配置
+var ErrCustomTransport = errors.New("HTTP client uses a custom RoundTripper, configure TLS and proxy on it directly")
+
+// transport 返回客户端专用的 Transport，未设置时复制默认 Transport，避免修改全局设置
+func (c *Client) transport() (*http.Transport, error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	switch transport := c.HTTPClient.Transport.(type) {
+	case nil:
+		cloned := http.DefaultTransport.(*http.Transport).Clone()
+		c.HTTPClient.Transport = cloned
+		return cloned, nil
+	case *http.Transport:
+		return transport, nil
+	default:
+		return nil, fmt.Errorf("%w (%T)", ErrCustomTransport, transport)
+	}
+}
+
+// setOptionErr 记录第一个应用失败的选项
+func (c *Client) setOptionErr(err error) {
+	if c.optionErr == nil {
+		c.optionErr = err
+	}
+}
+
+// logf 输出日志（未设置 Logger 时忽略）
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+	}
+}
+
+// requestBuilder 创建一次请求并返回签名使用的随机数
+type requestBuilder func(ctx context.Context) (*http.Request, string, error)
+
+// send 发送请求，网络错误时按重试策略重试
+// 每次尝试都重新创建请求，保证签名随机数不重复
+func (c *Client) send(ctx context.Context, build requestBuilder) (*http.Response, string, error) {
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := c.Retry.backoff(attempt - 1)
+			c.logf("[Auth] Request failed (%v), retrying in %s (attempt %d/%d)", lastErr, delay, attempt, attempts)
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, "", ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		req, nonce, err := build(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		userAgent := c.UserAgent
+		if userAgent == "" {
+			userAgent = DefaultUserAgent
+		}
+		req.Header.Set("User-Agent", userAgent)
+
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil {
+			return resp, nonce, nil
+		}
+
+		// 调用方取消或超过截止时间时不再重试
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+		lastErr = err
+	}
+
+	return nil, "", lastErr
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 请求签名头，与服务器保持一致
+const (
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// 响应签名头，与服务器保持一致
+const (
+	HeaderServerTimestamp = "X-Server-Timestamp"
+	HeaderServerKeyID     = "X-Server-Key-ID"
+	HeaderServerSignature = "X-Server-Signature"
+)
+
+// responseMaxSkew 服务器响应时间戳允许的最大偏差
+const responseMaxSkew = 5 * time.Minute
+
+// ErrUnsignedResponse 响应缺少服务器签名，可能连接到了伪造的许可证服务器
+var ErrUnsignedResponse = errors.New("server response is not signed")
+
+// setNonce 为请求添加随机数，服务器签名响应时包含该随机数，返回值用于验证响应
+func setNonce(req *http.Request) (string, error) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	req.Header.Set(HeaderNonce, nonce)
+	return nonce, nil
+}
+
+// signRequest 为请求添加时间戳、随机数和 HMAC-SHA256 签名，返回随机数用于验证响应
+// 签名内容为 "METHOD\nPATH\nTIMESTAMP\nNONCE\nSHA256(BODY)"，服务器据此拒绝过期、重放或被篡改的请求
+func signRequest(req *http.Request, secret string, body []byte) (string, error) {
+	nonce, err := setNonce(req)
+	if err != nil {
+		return "", err
+	}
+	timestamp := time.Now().Unix()
+
+	bodyHash := sha256.Sum256(body)
+	message := req.Method + "\n" + req.URL.Path + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+	return nonce, nil
+}
+
+// verifyServerResponse 验证服务器响应签名，只有显式设置 InsecureSkipVerify 时跳过
+func (c *Client) verifyServerResponse(resp *http.Response, body []byte, nonce string) error {
+	if c.InsecureSkipVerify {
+		return nil
+	}
+	return verifyResponse(resp, body, nonce, c.PublicKeys)
+}
+
+// verifyResponse 验证响应由持有签名私钥的服务器针对本次请求（nonce）生成
+// 签名内容为 "STATUS\nPATH\nNONCE\nTIMESTAMP\nSHA256(BODY)"，没有公钥时无法验证，一律拒绝
+func verifyResponse(resp *http.Response, body []byte, nonce string, publicKeys []ed25519.PublicKey) error {
+	if len(publicKeys) == 0 {
+		return ErrNoPublicKey
+	}
+
+	timestampHeader := resp.Header.Get(HeaderServerTimestamp)
+	kid := resp.Header.Get(HeaderServerKeyID)
+	signatureHeader := resp.Header.Get(HeaderServerSignature)
+	if timestampHeader == "" || signatureHeader == "" {
+		return ErrUnsignedResponse
+	}
+
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid server response timestamp: %w", err)
+	}
+
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > responseMaxSkew || skew < -responseMaxSkew {
+		return fmt.Errorf("server response timestamp outside allowed window (skew %s)", skew.Round(time.Second))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signatureHeader)
+	if err != nil {
+		return fmt.Errorf("malformed server response signature: %w", err)
+	}
+
+	bodyHash := sha256.Sum256(body)
+	message := strconv.Itoa(resp.StatusCode) + "\n" + resp.Request.URL.Path + "\n" + nonce + "\n" + timestampHeader + "\n" + hex.EncodeToString(bodyHash[:])
+
+	for _, publicKey := range publicKeys {
+		if len(publicKey) != ed25519.PublicKeySize {
+			continue
+		}
+		if kid != "" && KeyID(publicKey) != kid {
+			continue
+		}
+		if ed25519.Verify(publicKey, []byte(message), signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("server response signature verification failed")
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// requestSignature 按服务器文档的格式计算请求签名
+func requestSignature(secret, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignRequest(t *testing.T) {
+	// 与服务器测试中的签名向量相同，保证客户端和服务器的签名格式一致
+	const vector = "aebad7e23f0444f1f21d4d1dbc0576cdd55d48fab21546066c816536fd6479fe"
+	if got := requestSignature("secret", http.MethodPost, "/api/heartbeat", "1700000000", "nonce-1", []byte(`{"a":1}`)); got != vector {
+		t.Fatalf("signature format = %s, want %s", got, vector)
+	}
+
+	body := []byte(`{"hwid":"hwid-a"}`)
+	nonces := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost/api/heartbeat", bytes.NewReader(body))
+		nonce, err := signRequest(req, "secret", body)
+		if err != nil {
+			t.Fatalf("signRequest: %v", err)
+		}
+
+		timestamp := req.Header.Get(HeaderTimestamp)
+		if ts, _ := strconv.ParseInt(timestamp, 10, 64); time.Since(time.Unix(ts, 0)) > time.Minute {
+			t.Fatalf("timestamp %q is not the current time", timestamp)
+		}
+		if nonce == "" || req.Header.Get(HeaderNonce) != nonce || nonces[nonce] {
+			t.Fatalf("nonce %q missing or reused", nonce)
+		}
+		nonces[nonce] = true
+
+		want := requestSignature("secret", req.Method, req.URL.Path, timestamp, nonce, body)
+		if got := req.Header.Get(HeaderSignature); got != want {
+			t.Fatalf("signature = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestClientSignsDeviceRequests(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client(t)
+
+	nonces := map[string]bool{}
+	s.handle("/api/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		nonce := r.Header.Get(HeaderNonce)
+		want := requestSignature("secret", r.Method, r.URL.Path, r.Header.Get(HeaderTimestamp), nonce, body)
+		if r.Header.Get(HeaderSignature) != want || nonces[nonce] {
+			s.respond(w, r, http.StatusBadRequest, map[string]interface{}{"status": "dead", "code": "signature_invalid"})
+			return
+		}
+		nonces[nonce] = true
+		s.respond(w, r, http.StatusOK, map[string]interface{}{"status": "alive"})
+	})
+
+	// 每次请求使用新的随机数，服务器不会当作重放拒绝
+	for i := 0; i < 2; i++ {
+		if err := c.Heartbeat(); err != nil {
+			t.Fatalf("heartbeat %d: %v", i+1, err)
+		}
+	}
+}
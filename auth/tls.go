@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// pinPrefix 公钥指纹前缀（与 HPKP 格式一致）
+const pinPrefix = "sha256/"
+
+// TLSOptions 客户端 TLS 设置
+type TLSOptions struct {
+	// Pins 允许的服务器公钥指纹（SPKI SHA-256，格式 "sha256/<base64>"），证书链中任一证书匹配即通过
+	// 配置时至少需要两个：当前密钥和备用密钥，只固定一个密钥时更换证书会让所有已发布的客户端失联
+	Pins []string
+
+	// MinVersion 最低 TLS 版本，默认且不低于 TLS 1.2
+	MinVersion uint16
+
+	// RootCAs 自定义根证书（如私有 CA），为空时使用系统根证书
+	RootCAs *x509.CertPool
+
+	// ClientCertificate 双向 TLS 的客户端证书（可选）
+	ClientCertificate *tls.Certificate
+}
+
+// PinMismatchError 服务器证书链与配置的指纹都不匹配
+// 说明连接可能被中间人拦截，或服务器更换了未预先固定的密钥
+type PinMismatchError struct {
+	Host string   // TLS 服务器名称，使用 IP 连接时为空
+	Got  []string // 服务器证书链的指纹
+}
+
+func (e *PinMismatchError) Error() string {
+	host := e.Host
+	if host == "" {
+		host = "server"
+	}
+	return fmt.Sprintf("certificate pin mismatch for %s: server presented [%s], none match the configured pins",
+		host, strings.Join(e.Got, ", "))
+}
+
+// SPKIPin 计算证书公钥指纹，可用于生成 TLSOptions.Pins
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// LoadCertPool 从 PEM 文件加载根证书
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// NewTLSConfig 根据选项创建 tls.Config
+// 配置了指纹时，在常规证书验证通过后再检查证书链是否包含固定的公钥
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	pins, err := parsePins(opts.Pins)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion := opts.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	if minVersion < tls.VersionTLS12 {
+		return nil, fmt.Errorf("minimum TLS version must be at least TLS 1.2")
+	}
+
+	config := &tls.Config{
+		MinVersion: minVersion,
+		RootCAs:    opts.RootCAs,
+	}
+
+	if opts.ClientCertificate != nil {
+		config.Certificates = []tls.Certificate{*opts.ClientCertificate}
+	}
+
+	if len(pins) > 0 {
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(state, pins)
+		}
+	}
+
+	return config, nil
+}
+
+// ConfigureTLS 为客户端启用证书固定、最低 TLS 版本、自定义根证书和客户端证书
+// 创建客户端时使用 WithTLS；HTTP 客户端使用自定义 RoundTripper 时返回 ErrCustomTransport
+func (c *Client) ConfigureTLS(opts TLSOptions) error {
+	config, err := NewTLSConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	// 保留 WithProxy 等选项对 Transport 的设置
+	transport, err := c.transport()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig = config
+	return nil
+}
+
+// minPins 启用证书固定时至少需要的指纹数（当前密钥 + 备用密钥）
+const minPins = 2
+
+// parsePins 解析指纹列表，接受带或不带 "sha256/" 前缀的 base64
+// 不配置指纹表示不固定证书；配置时至少需要 minPins 个不同的指纹
+func parsePins(pins []string) (map[string]bool, error) {
+	parsed := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		encoded := strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin %q: expected sha256/<base64 SHA-256>", pin)
+		}
+		parsed[pinPrefix+encoded] = true
+	}
+
+	if len(parsed) > 0 && len(parsed) < minPins {
+		return nil, fmt.Errorf("at least %d distinct certificate pins are required (current key and a backup key): "+
+			"with a single pin, replacing the server certificate key locks out every released client", minPins)
+	}
+	return parsed, nil
+}
+
+// verifyPins 检查已验证的证书链中是否有证书匹配固定的指纹
+func verifyPins(state tls.ConnectionState, pins map[string]bool) error {
+	chains := state.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{state.PeerCertificates}
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if pins[SPKIPin(cert)] {
+				return nil
+			}
+		}
+	}
+
+	var got []string
+	for _, cert := range state.PeerCertificates {
+		got = append(got, SPKIPin(cert))
+	}
+	return &PinMismatchError{Host: state.ServerName, Got: got}
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCertificate 生成 127.0.0.1 的自签名证书，每次调用使用新的密钥
+func newCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "license-server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// newPinnedServer 使用指定证书启动 TLS 测试服务器
+func newPinnedServer(t *testing.T, cert tls.Certificate) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // 指纹不匹配时的握手错误是预期的
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// pinnedGet 使用固定了指纹的客户端请求服务器
+// rootCAs 信任所有测试证书，因此失败只可能来自指纹检查
+func pinnedGet(t *testing.T, url string, rootCAs *x509.CertPool, pins ...string) error {
+	t.Helper()
+
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	c, err := New(url, WithPublicKeys(publicKey), WithTLS(TLSOptions{Pins: pins, RootCAs: rootCAs}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestTLSPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	defer server.Close()
+	currentCert := server.Certificate()
+
+	_, backupCert := newCertificate(t)
+	_, attackerCert := newCertificate(t)
+	_, otherCert := newCertificate(t)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(currentCert)
+	rootCAs.AddCert(backupCert)
+	rootCAs.AddCert(attackerCert)
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{"matching pin", []string{SPKIPin(currentCert), SPKIPin(backupCert)}, false},
+		{"matching pin after backup", []string{SPKIPin(backupCert), SPKIPin(currentCert)}, false},
+		{"mismatched pins", []string{SPKIPin(attackerCert), SPKIPin(otherCert)}, true},
+		{"backup pins only", []string{SPKIPin(backupCert), SPKIPin(otherCert)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pinnedGet(t, server.URL, rootCAs, tt.pins...)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("pinned request failed: %v", err)
+				}
+				return
+			}
+
+			var mismatch *PinMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("error = %v, want *PinMismatchError", err)
+			}
+			if len(mismatch.Got) != 1 || mismatch.Got[0] != SPKIPin(currentCert) {
+				t.Fatalf("mismatch reports %v, want the server's pin", mismatch.Got)
+			}
+		})
+	}
+}
+
+func TestTLSPinRotation(t *testing.T) {
+	current, currentCert := newCertificate(t)
+	backup, backupCert := newCertificate(t)
+	next, nextCert := newCertificate(t)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(currentCert)
+	rootCAs.AddCert(backupCert)
+	rootCAs.AddCert(nextCert)
+
+	// 已发布的客户端固定了当前密钥和备用密钥
+	pins := []string{SPKIPin(currentCert), SPKIPin(backupCert)}
+
+	if err := pinnedGet(t, newPinnedServer(t, current).URL, rootCAs, pins...); err != nil {
+		t.Fatalf("before rotation: %v", err)
+	}
+
+	// 服务器换用备用密钥后，已发布的客户端无需更新即可连接
+	if err := pinnedGet(t, newPinnedServer(t, backup).URL, rootCAs, pins...); err != nil {
+		t.Fatalf("after rotation to backup key: %v", err)
+	}
+
+	// 换用未预先固定的密钥则所有旧客户端失联，这正是需要备用指纹的原因
+	var mismatch *PinMismatchError
+	if err := pinnedGet(t, newPinnedServer(t, next).URL, rootCAs, pins...); !errors.As(err, &mismatch) {
+		t.Fatalf("unpinned key: %v, want *PinMismatchError", err)
+	}
+}
+
+func TestTLSPinRequiresValidChain(t *testing.T) {
+	current, currentCert := newCertificate(t)
+	_, backupCert := newCertificate(t)
+	server := newPinnedServer(t, current)
+
+	// 指纹匹配但证书不受信任：常规证书验证仍然生效，指纹不能代替 CA 验证
+	err := pinnedGet(t, server.URL, x509.NewCertPool(), SPKIPin(currentCert), SPKIPin(backupCert))
+	if err == nil {
+		t.Fatal("untrusted certificate accepted because its pin matched")
+	}
+	var mismatch *PinMismatchError
+	if errors.As(err, &mismatch) {
+		t.Fatalf("error = %v, want a certificate verification error", err)
+	}
+}
+
+func TestTLSPinsRequireBackup(t *testing.T) {
+	_, currentCert := newCertificate(t)
+	_, backupCert := newCertificate(t)
+	current, backup := SPKIPin(currentCert), SPKIPin(backupCert)
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr bool
+	}{
+		{"not pinned", nil, false},
+		{"current and backup", []string{current, backup}, false},
+		{"single pin", []string{current}, true},
+		{"same pin twice", []string{current, current}, true},
+		{"invalid pin", []string{current, "sha256/not-base64"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTLSConfig(TLSOptions{Pins: tt.pins}); (err != nil) != tt.wantErr {
+				t.Fatalf("NewTLSConfig: err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// roundTripperFunc 自定义 RoundTripper，模拟调用方包装的 Transport
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWithTLS(t *testing.T) {
+	current, currentCert := newCertificate(t)
+	_, backupCert := newCertificate(t)
+	server := newPinnedServer(t, current)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(currentCert)
+	tlsOptions := TLSOptions{Pins: []string{SPKIPin(currentCert), SPKIPin(backupCert)}, RootCAs: rootCAs}
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	// WithTLS 在其他选项之后应用，放在 WithHTTPClient 之前同样生效
+	c, err := New(server.URL, WithPublicKeys(publicKey), WithTLS(tlsOptions), WithHTTPClient(&http.Client{}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := c.HTTPClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("pinned request: %v", err)
+	}
+	resp.Body.Close()
+
+	// 无效的 TLS 设置在创建客户端时报错
+	if _, err := New(server.URL, WithPublicKeys(publicKey), WithTLS(TLSOptions{Pins: tlsOptions.Pins[:1]})); err == nil {
+		t.Fatal("single pin accepted")
+	}
+
+	// 自定义 RoundTripper 不会被悄悄替换成默认 Transport（那样会丢掉调用方的包装）
+	custom := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("not used")
+	})}
+	for name, opt := range map[string]Option{"WithTLS": WithTLS(tlsOptions), "WithProxy": WithProxy(nil)} {
+		if _, err := New(server.URL, WithPublicKeys(publicKey), WithHTTPClient(custom), opt); !errors.Is(err, ErrCustomTransport) {
+			t.Errorf("%s with a custom RoundTripper: %v, want ErrCustomTransport", name, err)
+		}
+	}
+	if _, ok := custom.Transport.(roundTripperFunc); !ok {
+		t.Fatal("custom RoundTripper replaced")
+	}
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PublicKey 嵌入客户端的服务器公钥（base64 编码的 Ed25519 公钥，多个用逗号分隔）
+// 编译时设置：go build -ldflags "-X github.com/Lazywords2006/web/auth.PublicKey=<base64>[,<base64>...]"
+// 服务器启动日志中的 "public key (embed in client)" 即为该值
+// 密钥轮换时先在服务器生成新密钥，将新旧公钥一起嵌入客户端发布后再提升新密钥
+// 服务器在新密钥生成 SIGNING_KEY_ROLLOUT 之后才允许提升，给新客户端留出发布时间
+var PublicKey = ""
+
+// ErrNoPublicKey 未配置公钥，无法在本地验证令牌
+var ErrNoPublicKey = errors.New("no public key configured for token verification")
+
+// Claims 许可证令牌中的声明
+type Claims struct {
+	LicenseKey string           `json:"license_key"`
+	HWID       string           `json:"hwid"`
+	Features   []string         `json:"features,omitempty"` // 许可证开启的功能
+	Limits     map[string]int64 `json:"limits,omitempty"`   // 数值限制，如 max_projects
+	ExpiresAt  int64            `json:"exp"`
+	IssuedAt   int64            `json:"iat"`
+}
+
+// Expiry 返回令牌过期时间
+func (c *Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// HasFeature 检查令牌是否包含指定功能
+func (c *Claims) HasFeature(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit 返回指定的数值限制，令牌中没有该限制时 ok 为 false
+func (c *Claims) Limit(name string) (limit int64, ok bool) {
+	limit, ok = c.Limits[name]
+	return limit, ok
+}
+
+// tokenHeader JWT 头部
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// KeyID 计算公钥的 JWK 指纹（RFC 7638），与服务器令牌头部的 kid 一致
+func KeyID(publicKey ed25519.PublicKey) string {
+	thumbprint := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(publicKey))
+	hash := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// ParsePublicKeys 解析逗号分隔的多个公钥
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, err := ParsePublicKey(part)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParsePublicKey 解析 base64 编码的32字节 Ed25519 公钥或 PKIX PEM 公钥
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is not Ed25519")
+		}
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key is neither PEM nor base64: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// VerifyToken 使用公钥在本地验证令牌签名和有效期（无需联网）
+// 令牌头部带 kid 时只使用指纹匹配的公钥，否则依次尝试所有公钥
+func VerifyToken(token string, publicKeys ...ed25519.PublicKey) (*Claims, error) {
+	var claims Claims
+	if err := verifySignedToken(token, "JWT", publicKeys, &claims); err != nil {
+		return nil, err
+	}
+
+	if claims.ExpiresAt != 0 && time.Now().After(claims.Expiry()) {
+		return nil, fmt.Errorf("token expired at %s", claims.Expiry().Format(time.RFC3339))
+	}
+
+	return &claims, nil
+}
+
+// verifySignedToken 验证 EdDSA 签名和头部 typ，并将载荷解析到 claims
+// typ 用于区分在线令牌和离线许可证文件，防止二者互相替换
+func verifySignedToken(token, typ string, publicKeys []ed25519.PublicKey, claims interface{}) error {
+	if len(publicKeys) == 0 {
+		return ErrNoPublicKey
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed token header: %w", err)
+	}
+
+	var header tokenHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("malformed token header: %w", err)
+	}
+
+	// 只接受 EdDSA，防止算法替换攻击
+	if header.Alg != "EdDSA" {
+		return fmt.Errorf("unexpected signing algorithm: %s", header.Alg)
+	}
+
+	if header.Typ != typ {
+		return fmt.Errorf("unexpected token type: %s", header.Typ)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	verified := false
+	for _, publicKey := range publicKeys {
+		if len(publicKey) != ed25519.PublicKeySize {
+			continue
+		}
+		if header.Kid != "" && KeyID(publicKey) != header.Kid {
+			continue
+		}
+		if ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		if header.Kid != "" {
+			return fmt.Errorf("token signature verification failed (kid %s)", header.Kid)
+		}
+		return fmt.Errorf("token signature verification failed")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	return nil
+}
+
+// tokenExpiry 读取令牌的过期时间（不验证签名），仅用于判断何时刷新
+// 无法解析时返回零值
+func tokenExpiry(token string) time.Time {
+	claims, err := decodeClaims(token)
+	if err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return claims.Expiry()
+}
+
+// decodeClaims 解析令牌载荷，不验证签名
+func decodeClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return &claims, nil
+}
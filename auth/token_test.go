@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signToken 按给定头部签发令牌，alg 为 HS256 时用公钥字节作为 HMAC 密钥（算法替换攻击）
+func signToken(privateKey ed25519.PrivateKey, header tokenHeader, claims interface{}) string {
+	headerJSON, _ := json.Marshal(header)
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch header.Alg {
+	case "EdDSA":
+		signature = ed25519.Sign(privateKey, []byte(signingInput))
+	case "HS256":
+		mac := hmac.New(sha256.New, privateKey.Public().(ed25519.PublicKey))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyToken(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherPublic, otherPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	kid := KeyID(publicKey)
+	claims := Claims{LicenseKey: "KEY-1", HWID: "hwid-a", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	valid := signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: "JWT", Kid: kid}, claims)
+	parts := strings.Split(valid, ".")
+	tampered, _ := json.Marshal(Claims{LicenseKey: "KEY-1", HWID: "hwid-b", ExpiresAt: claims.ExpiresAt})
+
+	tests := []struct {
+		name    string
+		token   string
+		keys    []ed25519.PublicKey
+		wantErr bool
+	}{
+		{"valid", valid, []ed25519.PublicKey{publicKey}, false},
+		{"valid without kid", signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: "JWT"}, claims), []ed25519.PublicKey{otherPublic, publicKey}, false},
+		{"one of several keys", valid, []ed25519.PublicKey{otherPublic, publicKey}, false},
+		{"untrusted key", signToken(otherPrivate, tokenHeader{Alg: "EdDSA", Typ: "JWT", Kid: kid}, claims), []ed25519.PublicKey{publicKey}, true},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2], []ed25519.PublicKey{publicKey}, true},
+		{"HMAC with the public key", signToken(privateKey, tokenHeader{Alg: "HS256", Typ: "JWT", Kid: kid}, claims), []ed25519.PublicKey{publicKey}, true},
+		{"alg none", parts[0] + "." + parts[1] + ".", []ed25519.PublicKey{publicKey}, true},
+		{"offline license file", signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: "license", Kid: kid}, claims), []ed25519.PublicKey{publicKey}, true},
+		{"expired", signToken(privateKey, tokenHeader{Alg: "EdDSA", Typ: "JWT", Kid: kid}, Claims{LicenseKey: "KEY-1", ExpiresAt: time.Now().Add(-time.Minute).Unix()}), []ed25519.PublicKey{publicKey}, true},
+		{"malformed", "not-a-token", []ed25519.PublicKey{publicKey}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyToken(tt.token, tt.keys...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("VerifyToken accepted the token: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+			if got.LicenseKey != claims.LicenseKey || got.HWID != claims.HWID {
+				t.Fatalf("claims = %+v, want %+v", got, claims)
+			}
+		})
+	}
+
+	if _, err := VerifyToken(valid); !errors.Is(err, ErrNoPublicKey) {
+		t.Fatalf("no public keys: %v, want ErrNoPublicKey", err)
+	}
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	first, _, _ := ed25519.GenerateKey(rand.Reader)
+	second, _, _ := ed25519.GenerateKey(rand.Reader)
+	encode := base64.StdEncoding.EncodeToString
+
+	keys, err := ParsePublicKeys(encode(first) + ", " + encode(second) + ",")
+	if err != nil || len(keys) != 2 || !keys[0].Equal(first) || !keys[1].Equal(second) {
+		t.Fatalf("ParsePublicKeys: %v %v", keys, err)
+	}
+
+	for _, invalid := range []string{"not base64!", encode([]byte("short"))} {
+		if _, err := ParsePublicKeys(invalid); err == nil {
+			t.Fatalf("ParsePublicKeys(%q) accepted an invalid key", invalid)
+		}
+	}
+}
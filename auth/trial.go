@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TrialRequest 试用请求结构
+type TrialRequest struct {
+	ProductName string            `json:"product_name"`
+	HWID        string            `json:"hwid"`
+	Fingerprint map[string]string `json:"fingerprint,omitempty"`
+	Environment *Environment      `json:"environment,omitempty"`
+}
+
+// TrialResponse 试用响应结构
+type TrialResponse struct {
+	Status        string    `json:"status"`
+	LicenseKey    string    `json:"license_key"`   // 试用许可证密钥，升级时传给 Upgrade
+	TrialExpires  time.Time `json:"trial_expires"` // 试用到期时间
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	RequestSecret string    `json:"request_secret,omitempty"`
+	ExpiresIn     int64     `json:"expires_in,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Code          string    `json:"code,omitempty"`
+}
+
+// StartTrial 在当前设备上开始产品试用，无需许可证密钥，需要通过 WithFingerprint 设置硬件指纹
+// 每台设备每个产品只能试用一次，试用期内重复调用（如重装后）返回同一个试用许可证
+// 成功后与 Activate 一样保存令牌，可直接发送心跳
+func (c *Client) StartTrial(productName, hwid string) (*TrialResponse, error) {
+	return c.StartTrialContext(context.Background(), productName, hwid)
+}
+
+// StartTrialContext 开始试用，ctx 取消或超时时中止请求
+func (c *Client) StartTrialContext(ctx context.Context, productName, hwid string) (*TrialResponse, error) {
+	// 服务器按指纹识别重装后的设备，拒绝不带指纹的试用请求
+	if len(c.Fingerprint) == 0 {
+		return nil, fmt.Errorf("trial requires a hardware fingerprint (see WithFingerprint)")
+	}
+
+	jsonData, err := json.Marshal(TrialRequest{
+		ProductName: productName,
+		HWID:        hwid,
+		Fingerprint: c.Fingerprint,
+		Environment: c.Environment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/trial", c.ServerURL)
+	resp, nonce, err := c.send(ctx, func(ctx context.Context) (*http.Request, string, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// 试用前设备没有任何共享密钥，请求不签名；只带随机数用于验证服务器签名的响应
+		nonce, err := setNonce(req)
+		return req, nonce, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send trial request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := c.verifyServerResponse(resp, body, nonce); err != nil {
+		return nil, fmt.Errorf("untrusted trial response: %w", err)
+	}
+
+	var trialResp TrialResponse
+	if err := json.Unmarshal(body, &trialResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("trial failed: %w",
+			&ServerError{StatusCode: resp.StatusCode, Code: trialResp.Code, Message: trialResp.Error})
+	}
+
+	if trialResp.Status != "success" || trialResp.Token == "" {
+		return nil, fmt.Errorf("trial unsuccessful: %s", trialResp.Status)
+	}
+
+	if !c.InsecureSkipVerify {
+		claims, err := VerifyToken(trialResp.Token, c.PublicKeys...)
+		if err != nil {
+			return nil, fmt.Errorf("received invalid token: %w", err)
+		}
+		if claims.LicenseKey != trialResp.LicenseKey || claims.HWID != hwid {
+			return nil, fmt.Errorf("received token does not match this trial or device")
+		}
+	}
+
+	c.mu.Lock()
+	c.Token = trialResp.Token
+	c.RefreshToken = trialResp.RefreshToken
+	c.RequestSecret = trialResp.RequestSecret
+	c.LeaseExpiry = time.Time{}
+	c.mu.Unlock()
+	c.sessionChanged()
+	return &trialResp, nil
+}
+
+// Upgrade 在试用设备上激活购买的许可证，并结束该设备的试用
+// trialKey 为 StartTrial 返回的试用许可证密钥；试用过期后仍可升级
+func (c *Client) Upgrade(trialKey, licenseKey, hwid string) error {
+	return c.UpgradeContext(context.Background(), trialKey, licenseKey, hwid)
+}
+
+// UpgradeContext 从试用升级，ctx 取消或超时时中止请求
+func (c *Client) UpgradeContext(ctx context.Context, trialKey, licenseKey, hwid string) error {
+	return c.activate(ctx, licenseKey, hwid, trialKey)
+}
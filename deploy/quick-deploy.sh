@@ -18,7 +18,7 @@ NC='\033[0m' # No Color
 # 配置变量
 PORT="${PORT:-8080}"
 DB_PATH="${DB_PATH:-/var/lib/license-server/licenses.db}"
-JWT_SECRET="${JWT_SECRET:-$(openssl rand -hex 32)}"
+SIGNING_KEY_PATH="${SIGNING_KEY_PATH:-/var/lib/license-server/signing_key.pem}"
 INSTALL_DIR="/opt/license-server"
 SERVICE_USER="license-server"
 
@@ -128,7 +128,7 @@ WorkingDirectory=$INSTALL_DIR
 ExecStart=$INSTALL_DIR/license-server
 Environment="PORT=$PORT"
 Environment="DB_PATH=$DB_PATH"
-Environment="JWT_SECRET=$JWT_SECRET"
+Environment="SIGNING_KEY_PATH=$SIGNING_KEY_PATH"
 Restart=always
 RestartSec=10
 StandardOutput=append:/var/log/license-server/server.log
@@ -185,7 +185,7 @@ show_info() {
     echo "服务器信息："
     echo "  - 监听端口: $PORT"
     echo "  - 数据库路径: $DB_PATH"
-    echo "  - JWT密钥: $JWT_SECRET"
+    echo "  - 签名密钥: $SIGNING_KEY_PATH (首次启动自动生成，请备份)"
     echo "  - 安装目录: $INSTALL_DIR"
     echo ""
     echo "管理命令："
@@ -13,6 +13,10 @@ import platform
 import threading
 import time
 import json
+import hashlib
+import hmac
+import secrets
+from urllib.parse import urlparse
 
 # ⚠️ 重要：macOS Tkinter 兼容性检查必须在导入 tkinter 之前
 if platform.system() == 'Darwin':
@@ -35,6 +39,30 @@ import tkinter as tk
 from tkinter import messagebox
 import requests
 
+
+def post_signed(url, payload, secret, timeout=10, headers=None):
+    """发送带时间戳、随机数和 HMAC-SHA256 签名的 POST 请求
+
+    签名内容为 "METHOD\\nPATH\\nTIMESTAMP\\nNONCE\\nSHA256(BODY)"；
+    激活请求使用许可证密钥作为 secret，之后的请求使用激活响应中的 request_secret
+    """
+    body = json.dumps(payload).encode() if payload is not None else b''
+    timestamp = str(int(time.time()))
+    nonce = secrets.token_hex(16)
+    message = "\n".join([
+        "POST", urlparse(url).path, timestamp, nonce, hashlib.sha256(body).hexdigest()
+    ])
+    signature = hmac.new(secret.encode(), message.encode(), hashlib.sha256).hexdigest()
+
+    signed_headers = dict(headers or {})
+    signed_headers.update({
+        "Content-Type": "application/json",
+        "X-Timestamp": timestamp,
+        "X-Nonce": nonce,
+        "X-Signature": signature,
+    })
+    return requests.post(url, data=body, headers=signed_headers, timeout=timeout)
+
 class LicenseLauncher:
     def __init__(self):
         # 配置
@@ -165,9 +193,10 @@ class LicenseLauncher:
     def verify_license(self, license_key):
         """验证许可证"""
         try:
-            response = requests.post(
+            response = post_signed(
                 f"{self.server_url}/api/activate",
-                json={"key": license_key, "hwid": self.hwid},
+                {"key": license_key, "hwid": self.hwid},
+                license_key,
                 timeout=5
             )
 
@@ -197,9 +226,10 @@ class LicenseLauncher:
     def _do_activate(self, license_key):
         """执行激活（后台线程）"""
         try:
-            response = requests.post(
+            response = post_signed(
                 f"{self.server_url}/api/activate",
-                json={"key": license_key, "hwid": self.hwid},
+                {"key": license_key, "hwid": self.hwid},
+                license_key,
                 timeout=10
             )
 
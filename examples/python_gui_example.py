@@ -24,9 +24,37 @@ import tkinter as tk
 from tkinter import ttk, messagebox
 import requests
 import hashlib
+import hmac
+import json
+import secrets
 import uuid
 import threading
 import time
+from urllib.parse import urlparse
+
+
+def post_signed(url, payload, secret, timeout=10, headers=None):
+    """发送带时间戳、随机数和 HMAC-SHA256 签名的 POST 请求
+
+    签名内容为 "METHOD\\nPATH\\nTIMESTAMP\\nNONCE\\nSHA256(BODY)"；
+    激活请求使用许可证密钥作为 secret，之后的请求使用激活响应中的 request_secret
+    """
+    body = json.dumps(payload).encode() if payload is not None else b''
+    timestamp = str(int(time.time()))
+    nonce = secrets.token_hex(16)
+    message = "\n".join([
+        "POST", urlparse(url).path, timestamp, nonce, hashlib.sha256(body).hexdigest()
+    ])
+    signature = hmac.new(secret.encode(), message.encode(), hashlib.sha256).hexdigest()
+
+    signed_headers = dict(headers or {})
+    signed_headers.update({
+        "Content-Type": "application/json",
+        "X-Timestamp": timestamp,
+        "X-Nonce": nonce,
+        "X-Signature": signature,
+    })
+    return requests.post(url, data=body, headers=signed_headers, timeout=timeout)
 
 class LicenseApp:
     def __init__(self, root):
@@ -38,6 +66,8 @@ class LicenseApp:
         # 服务器配置
         self.server_url = "http://106.14.255.49:8080"
         self.token = None
+        self.refresh_token = None
+        self.request_secret = ""
         self.license_key = None
         self.hwid = self.get_hardware_id()
         self.heartbeat_running = False
@@ -164,12 +194,13 @@ class LicenseApp:
     def _do_activate(self):
         """执行激活请求"""
         try:
-            response = requests.post(
+            response = post_signed(
                 f"{self.server_url}/api/activate",
-                json={
+                {
                     "key": self.license_key,
                     "hwid": self.hwid
                 },
+                self.license_key,
                 timeout=10
             )
 
@@ -179,6 +210,8 @@ class LicenseApp:
                 data = response.json()
                 if data.get("status") == "success":
                     self.token = data.get("token")
+                    self.refresh_token = data.get("refresh_token")
+                    self.request_secret = data.get("request_secret", "")
                     self.root.after(0, lambda: self.log_status("✅ 许可证激活成功!"))
                     self.root.after(0, lambda: messagebox.showinfo("成功",
                         "许可证激活成功!\n\n系统已开始心跳监控\n应用程序现在可以正常使用"))
@@ -220,22 +253,49 @@ class LicenseApp:
             self.root.after(0, lambda: messagebox.showerror("错误",
                 f"激活过程发生异常:\n\n{str(e)}"))
 
+    def refresh(self):
+        """使用刷新令牌换取新的访问令牌（访问令牌默认 15 分钟过期）"""
+        if not self.refresh_token:
+            return False
+
+        response = requests.post(
+            f"{self.server_url}/api/refresh",
+            json={"refresh_token": self.refresh_token},
+            timeout=10
+        )
+        if response.status_code != 200:
+            return False
+
+        data = response.json()
+        self.token = data.get("token")
+        self.refresh_token = data.get("refresh_token")
+        return True
+
+    def send_heartbeat(self):
+        """发送一次签名的心跳请求"""
+        headers = {}
+        if self.token:
+            headers["Authorization"] = f"Bearer {self.token}"
+
+        return post_signed(
+            f"{self.server_url}/api/heartbeat",
+            {
+                "key": self.license_key,
+                "hwid": self.hwid
+            },
+            self.request_secret,
+            timeout=10,
+            headers=headers
+        )
+
     def heartbeat(self):
         """心跳验证"""
         try:
-            headers = {}
-            if self.token:
-                headers["Authorization"] = f"Bearer {self.token}"
+            response = self.send_heartbeat()
 
-            response = requests.post(
-                f"{self.server_url}/api/heartbeat",
-                json={
-                    "key": self.license_key,
-                    "hwid": self.hwid
-                },
-                headers=headers,
-                timeout=10
-            )
+            # 访问令牌过期时刷新后重试一次
+            if response.status_code == 401 and self.refresh():
+                response = self.send_heartbeat()
 
             if response.status_code == 200:
                 data = response.json()
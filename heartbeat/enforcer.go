@@ -0,0 +1,123 @@
+package heartbeat
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Enforcer 许可证失效时的处置策略
+// Monitor 在服务器拒绝许可证或离线宽限期耗尽时调用 Enforce，之后停止心跳
+type Enforcer interface {
+	Enforce(ctx context.Context, reason string, err error)
+}
+
+// EnforcerFunc 将普通函数适配为 Enforcer（自定义回调）
+type EnforcerFunc func(ctx context.Context, reason string, err error)
+
+// Enforce 实现 Enforcer 接口
+func (f EnforcerFunc) Enforce(ctx context.Context, reason string, err error) {
+	f(ctx, reason, err)
+}
+
+// CleanupHook 退出前执行的清理函数（如保存用户数据），应在 ctx 取消前返回
+type CleanupHook func(ctx context.Context) error
+
+// defaultCleanupTimeout 清理函数的默认总时限
+const defaultCleanupTimeout = 5 * time.Second
+
+// ExitEnforcer 执行清理函数后终止程序（默认策略）
+type ExitEnforcer struct {
+	Hooks   []CleanupHook // 按顺序执行的清理函数
+	Timeout time.Duration // 清理总时限（默认5秒），超时后不再等待剩余清理函数
+	Code    int           // 退出码（默认1）
+}
+
+// Enforce 实现 Enforcer 接口
+func (e *ExitEnforcer) Enforce(ctx context.Context, reason string, err error) {
+	log.Printf("[KILL SWITCH] Force exit triggered: %s", reason)
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultCleanupTimeout
+	}
+	Shutdown(ctx, timeout, e.Hooks...)
+
+	code := e.Code
+	if code == 0 {
+		code = 1
+	}
+
+	log.Println("[KILL SWITCH] Application will terminate immediately")
+	os.Exit(code)
+}
+
+// ReadOnlyEnforcer 将应用降级为只读模式而不退出
+// 业务代码通过 ReadOnly() 判断是否允许写操作
+type ReadOnlyEnforcer struct {
+	OnDegrade func(reason string) // 进入只读模式时调用（可选）
+
+	readOnly atomic.Bool
+}
+
+// Enforce 实现 Enforcer 接口
+func (e *ReadOnlyEnforcer) Enforce(ctx context.Context, reason string, err error) {
+	if e.readOnly.Swap(true) {
+		return
+	}
+
+	log.Printf("[Enforcer] Switching to read-only mode: %s", reason)
+	if e.OnDegrade != nil {
+		e.OnDegrade(reason)
+	}
+}
+
+// ReadOnly 是否已降级为只读模式
+func (e *ReadOnlyEnforcer) ReadOnly() bool {
+	return e.readOnly.Load()
+}
+
+// WarningEnforcer 仅向用户显示警告，应用继续运行
+type WarningEnforcer struct {
+	Warn func(reason string) // 显示警告（可选，默认只写日志）
+}
+
+// Enforce 实现 Enforcer 接口
+func (e *WarningEnforcer) Enforce(ctx context.Context, reason string, err error) {
+	log.Printf("[Enforcer] WARNING: %s", reason)
+	if e.Warn != nil {
+		e.Warn(reason)
+	}
+}
+
+// Shutdown 在时限内按顺序执行清理函数
+// 单个清理函数失败不影响后续执行；超时后立即返回，未完成的清理函数继续在后台运行
+func Shutdown(ctx context.Context, timeout time.Duration, hooks ...CleanupHook) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	log.Printf("[Shutdown] Running %d cleanup hooks (timeout %s)", len(hooks), timeout)
+
+	for i, hook := range hooks {
+		done := make(chan error, 1)
+		go func(hook CleanupHook) {
+			done <- hook(ctx)
+		}(hook)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("[Shutdown] Cleanup hook %d failed: %v", i+1, err)
+			}
+		case <-ctx.Done():
+			log.Printf("[Shutdown] Cleanup deadline exceeded, skipping %d remaining hooks", len(hooks)-i-1)
+			return
+		}
+	}
+}
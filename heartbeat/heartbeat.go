@@ -1,9 +1,13 @@
 package heartbeat
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -12,14 +16,53 @@ type AuthClient interface {
 	Heartbeat() error
 }
 
+// StateStore 最后一次成功心跳时间的持久化接口
+// 没有保存记录时 LoadLastSuccess 应返回零值和 nil
+type StateStore interface {
+	LoadLastSuccess() (time.Time, error)
+	SaveLastSuccess(t time.Time) error
+}
+
+// revocation 由 AuthClient 返回的错误实现，表示服务器明确拒绝了许可证
+// auth.RejectedError 实现了该接口
+type revocation interface {
+	Revoked() bool
+}
+
+// IsRevoked 判断心跳错误是否为服务器明确拒绝（而非网络故障）
+func IsRevoked(err error) bool {
+	var r revocation
+	return errors.As(err, &r) && r.Revoked()
+}
+
 // Monitor 心跳监控器
 type Monitor struct {
 	client        AuthClient
 	interval      time.Duration
 	maxRetries    int
 	retryDelay    time.Duration
+	gracePeriod   time.Duration
+	stateFile     string
+	stateStore    StateStore
 	stopChan      chan struct{}
 	errorCallback func(error)
+	enforcer      Enforcer
+	observer      func(Event)
+	stopOnce      sync.Once
+
+	// 时间来源，测试中替换为假时钟
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	state       State
+	stateSince  time.Time
+	reason      string
+	lastErr     error
+	subscribers map[int]chan Event
+	nextSubID   int
+	closed      bool
 }
 
 // Config 心跳监控配置
@@ -27,40 +70,94 @@ type Config struct {
 	Interval      time.Duration // 心跳间隔（默认30秒）
 	MaxRetries    int           // 最大重试次数（默认3次）
 	RetryDelay    time.Duration // 重试延迟（默认2秒）
+	GracePeriod   time.Duration // 离线宽限期，网络故障持续超过该时长才终止程序（0 表示不宽限）
+	StateFile     string        // 持久化最后一次成功心跳时间的文件（可选），重启程序不会重置宽限期
+	StateStore    StateStore    // 自定义持久化（可选，例如 store.Store 加密保存），设置后忽略 StateFile
 	ErrorCallback func(error)   // 错误回调（可选）
+	Enforcer      Enforcer      // 许可证失效时的处置策略（默认 ExitEnforcer，直接退出）
+	OnStateChange func(Event)   // 状态变化回调（可选），在心跳协程中同步调用，不应阻塞
 }
 
 // DefaultConfig 返回默认配置
 func DefaultConfig() *Config {
 	return &Config{
-		Interval:   30 * time.Second,
-		MaxRetries: 3,
-		RetryDelay: 2 * time.Second,
+		Interval:    30 * time.Second,
+		MaxRetries:  3,
+		RetryDelay:  2 * time.Second,
+		GracePeriod: 30 * time.Minute,
 	}
 }
 
+// monitorState 持久化的心跳状态
+type monitorState struct {
+	LastSuccess time.Time `json:"last_success"`
+}
+
 // NewMonitor 创建新的心跳监控器
+// 配置了 StateFile 时从中恢复最后一次成功心跳时间
 func NewMonitor(client AuthClient, config *Config) *Monitor {
 	if config == nil {
 		config = DefaultConfig()
 	}
 
-	return &Monitor{
+	m := &Monitor{
 		client:        client,
 		interval:      config.Interval,
 		maxRetries:    config.MaxRetries,
 		retryDelay:    config.RetryDelay,
+		gracePeriod:   config.GracePeriod,
+		stateFile:     config.StateFile,
+		stateStore:    config.StateStore,
 		stopChan:      make(chan struct{}),
 		errorCallback: config.ErrorCallback,
+		enforcer:      config.Enforcer,
+		observer:      config.OnStateChange,
+		now:           time.Now,
+		sleep:         time.Sleep,
+		state:         StateStarting,
+		reason:        "monitor created",
+		subscribers:   make(map[int]chan Event),
 	}
+	m.stateSince = m.now()
+	if m.enforcer == nil {
+		m.enforcer = &ExitEnforcer{}
+	}
+	m.lastSuccess = m.loadLastSuccess()
+
+	return m
+}
+
+// RecordSuccess 记录一次与服务器的成功通信（例如刚完成在线激活）
+func (m *Monitor) RecordSuccess() {
+	now := m.now()
+
+	m.mu.Lock()
+	m.lastSuccess = now
+	m.mu.Unlock()
+
+	m.saveLastSuccess(now)
+}
+
+// LastSuccess 返回最后一次成功心跳时间
+func (m *Monitor) LastSuccess() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastSuccess
 }
 
 // Start 启动心跳监控（在后台Goroutine中运行）
 // 此方法会立即返回，心跳检查在后台持续进行
-// 如果心跳失败达到最大重试次数，将触发ForceExit终止程序
+// 服务器明确拒绝许可证，或网络故障超过离线宽限期时，调用 Enforcer 处置后停止心跳
 func (m *Monitor) Start() {
 	log.Println("[Heartbeat] Monitor started")
 
+	// 没有任何成功记录时从启动时刻开始计算宽限期
+	m.mu.Lock()
+	if m.lastSuccess.IsZero() {
+		m.lastSuccess = m.now()
+	}
+	m.mu.Unlock()
+
 	go m.run()
 }
 
@@ -72,18 +169,8 @@ func (m *Monitor) run() {
 	for {
 		select {
 		case <-ticker.C:
-			if err := m.sendHeartbeatWithRetry(); err != nil {
-				log.Printf("[Heartbeat] CRITICAL: All retries failed - %v", err)
-
-				// 调用错误回调（如果配置）
-				if m.errorCallback != nil {
-					m.errorCallback(err)
-				}
-
-				// 触发强制退出
-				ForceExit(fmt.Sprintf("Heartbeat validation failed: %v", err))
-			} else {
-				log.Println("[Heartbeat] OK")
+			if m.check() {
+				return
 			}
 
 		case <-m.stopChan:
@@ -93,7 +180,52 @@ func (m *Monitor) run() {
 	}
 }
 
+// check 执行一轮心跳（含重试）并更新状态，返回 true 表示已执行处置，监控应停止
+func (m *Monitor) check() bool {
+	err := m.sendHeartbeatWithRetry()
+	if err == nil {
+		m.RecordSuccess()
+		m.setState(StateHealthy, "heartbeat succeeded", nil)
+		log.Println("[Heartbeat] OK")
+		return false
+	}
+
+	// 服务器明确拒绝：立即终止
+	if IsRevoked(err) {
+		log.Printf("[Heartbeat] CRITICAL: License rejected by server - %v", err)
+		m.setState(StateRevoked, "license rejected by server", err)
+		m.enforce(err, fmt.Sprintf("License revoked: %v", err))
+		return true
+	}
+
+	// 网络故障：宽限期内继续运行
+	offline := m.now().Sub(m.LastSuccess())
+	if offline > m.gracePeriod {
+		log.Printf("[Heartbeat] CRITICAL: Offline for %s, grace period %s exceeded - %v",
+			offline.Round(time.Second), m.gracePeriod, err)
+		m.setState(StateRevoked, "offline grace period exceeded", err)
+		m.enforce(err, fmt.Sprintf("Heartbeat validation failed: offline grace period exceeded: %v", err))
+		return true
+	}
+
+	log.Printf("[Heartbeat] WARNING: Server unreachable, offline for %s (grace period %s) - %v",
+		offline.Round(time.Second), m.gracePeriod, err)
+	m.setState(StateGrace, "server unreachable", err)
+	return false
+}
+
+// enforce 调用错误回调后执行处置策略
+func (m *Monitor) enforce(err error, reason string) {
+	if m.errorCallback != nil {
+		m.errorCallback(err)
+	}
+
+	m.enforcer.Enforce(context.Background(), reason, err)
+	log.Println("[Heartbeat] Monitor stopped after enforcement")
+}
+
 // sendHeartbeatWithRetry 发送心跳并在失败时重试
+// 服务器明确拒绝时不再重试
 func (m *Monitor) sendHeartbeatWithRetry() error {
 	var lastErr error
 
@@ -107,26 +239,99 @@ func (m *Monitor) sendHeartbeatWithRetry() error {
 			return nil
 		}
 
+		if IsRevoked(err) {
+			return err
+		}
+
 		lastErr = err
 		log.Printf("[Heartbeat] Attempt %d/%d failed: %v", attempt, m.maxRetries, err)
 
+		// 宽限期内的失败不回退到 degraded
+		if m.State() != StateGrace {
+			m.setState(StateDegraded, "heartbeat failed, retrying", err)
+		}
+
 		// 如果不是最后一次尝试，等待后重试
 		if attempt < m.maxRetries {
-			time.Sleep(m.retryDelay)
+			m.sleep(m.retryDelay)
 		}
 	}
 
 	return fmt.Errorf("heartbeat failed after %d attempts: %w", m.maxRetries, lastErr)
 }
 
-// Stop 停止心跳监控
+// loadLastSuccess 从状态文件读取最后一次成功心跳时间，读取失败返回零值
+func (m *Monitor) loadLastSuccess() time.Time {
+	var lastSuccess time.Time
+
+	if m.stateStore != nil {
+		t, err := m.stateStore.LoadLastSuccess()
+		if err != nil {
+			log.Printf("[Heartbeat] Ignoring saved state: %v", err)
+			return time.Time{}
+		}
+		lastSuccess = t
+	} else {
+		if m.stateFile == "" {
+			return time.Time{}
+		}
+
+		data, err := os.ReadFile(m.stateFile)
+		if err != nil {
+			return time.Time{}
+		}
+
+		var state monitorState
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("[Heartbeat] Ignoring corrupt state file %s: %v", m.stateFile, err)
+			return time.Time{}
+		}
+		lastSuccess = state.LastSuccess
+	}
+
+	// 时间在未来说明文件被篡改或时钟异常，不予采信
+	if lastSuccess.After(m.now()) {
+		return time.Time{}
+	}
+
+	return lastSuccess
+}
+
+// saveLastSuccess 将最后一次成功心跳时间写入状态文件
+func (m *Monitor) saveLastSuccess(t time.Time) {
+	if m.stateStore != nil {
+		if err := m.stateStore.SaveLastSuccess(t); err != nil {
+			log.Printf("[Heartbeat] Failed to save state: %v", err)
+		}
+		return
+	}
+
+	if m.stateFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(monitorState{LastSuccess: t})
+	if err != nil {
+		return
+	}
+
+	if err := os.WriteFile(m.stateFile, data, 0600); err != nil {
+		log.Printf("[Heartbeat] Failed to save state: %v", err)
+	}
+}
+
+// Stop 停止心跳监控并关闭所有订阅通道，可重复调用
 func (m *Monitor) Stop() {
-	close(m.stopChan)
+	m.stopOnce.Do(func() {
+		m.setState(StateStopped, "monitor stopped", nil)
+		close(m.stopChan)
+		m.closeSubscribers()
+	})
 }
 
 // ForceExit 强制终止程序
 // 这是一个紧急退出函数，用于在许可证验证失败时立即终止应用程序
-// 注意：此函数会调用os.Exit(1)，不会执行defer语句
+// 注意：此函数会调用os.Exit(1)，不会执行defer语句；需要退出前清理时使用 ExitEnforcer
 func ForceExit(reason string) {
 	log.Printf("[KILL SWITCH] Force exit triggered: %s", reason)
 	log.Println("[KILL SWITCH] Application will terminate immediately")
@@ -0,0 +1,245 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock 假时钟，Sleep 直接推进时间并记录等待时长
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+// fakeClient 按顺序返回预设的心跳结果，用完后重复最后一个
+type fakeClient struct {
+	results []error
+	calls   int
+}
+
+func (c *fakeClient) Heartbeat() error {
+	i := c.calls
+	if i >= len(c.results) {
+		i = len(c.results) - 1
+	}
+	c.calls++
+	return c.results[i]
+}
+
+// rejected 模拟服务器明确拒绝（auth.RejectedError）
+type rejected struct{}
+
+func (rejected) Error() string { return "license banned" }
+func (rejected) Revoked() bool { return true }
+
+// leaseExpired 模拟浮动席位租约过期且无法重新借出（auth.RejectedError 的 lease_expired）
+type leaseExpired struct{}
+
+func (leaseExpired) Error() string { return "seat lease expired" }
+func (leaseExpired) Revoked() bool { return false }
+
+var errNetwork = errors.New("connection refused")
+
+// memState 内存中的 StateStore
+type memState struct {
+	lastSuccess time.Time
+}
+
+func (s *memState) LoadLastSuccess() (time.Time, error) { return s.lastSuccess, nil }
+func (s *memState) SaveLastSuccess(t time.Time) error {
+	s.lastSuccess = t
+	return nil
+}
+
+func newTestMonitor(client AuthClient, clock *fakeClock, offline time.Duration, enforced *[]string) *Monitor {
+	m := NewMonitor(client, &Config{
+		Interval:    30 * time.Second,
+		MaxRetries:  3,
+		RetryDelay:  2 * time.Second,
+		GracePeriod: 30 * time.Minute,
+		Enforcer: EnforcerFunc(func(ctx context.Context, reason string, err error) {
+			*enforced = append(*enforced, reason)
+		}),
+	})
+	m.now = clock.Now
+	m.sleep = clock.Sleep
+	m.lastSuccess = clock.now.Add(-offline)
+	return m
+}
+
+func TestMonitorCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     []error
+		offline     time.Duration // 本轮心跳前已离线时长
+		wantStop    bool
+		wantState   State
+		wantCalls   int
+		wantSleeps  int
+		wantEnforce bool
+	}{
+		{
+			name:      "healthy",
+			results:   []error{nil},
+			wantState: StateHealthy,
+			wantCalls: 1,
+		},
+		{
+			name:       "recovers after retry",
+			results:    []error{errNetwork, nil},
+			offline:    time.Minute,
+			wantState:  StateHealthy,
+			wantCalls:  2,
+			wantSleeps: 1,
+		},
+		{
+			name:       "outage within grace",
+			results:    []error{errNetwork},
+			offline:    10 * time.Minute,
+			wantState:  StateGrace,
+			wantCalls:  3,
+			wantSleeps: 2,
+		},
+		{
+			name:        "outage past grace",
+			results:     []error{errNetwork},
+			offline:     31 * time.Minute,
+			wantStop:    true,
+			wantState:   StateRevoked,
+			wantCalls:   3,
+			wantSleeps:  2,
+			wantEnforce: true,
+		},
+		{
+			name:        "revoked is not retried",
+			results:     []error{rejected{}},
+			wantStop:    true,
+			wantState:   StateRevoked,
+			wantCalls:   1,
+			wantEnforce: true,
+		},
+		{
+			name:       "lease expired is not revocation",
+			results:    []error{leaseExpired{}},
+			offline:    10 * time.Minute,
+			wantState:  StateGrace,
+			wantCalls:  3,
+			wantSleeps: 2,
+		},
+		{
+			name:        "revoked during outage",
+			results:     []error{errNetwork, rejected{}},
+			offline:     5 * time.Minute,
+			wantStop:    true,
+			wantState:   StateRevoked,
+			wantCalls:   2,
+			wantSleeps:  1,
+			wantEnforce: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+			client := &fakeClient{results: tt.results}
+			var enforced []string
+			m := newTestMonitor(client, clock, tt.offline, &enforced)
+
+			if stop := m.check(); stop != tt.wantStop {
+				t.Errorf("check() = %v, want %v", stop, tt.wantStop)
+			}
+			if got := m.State(); got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+			if client.calls != tt.wantCalls {
+				t.Errorf("heartbeat calls = %d, want %d", client.calls, tt.wantCalls)
+			}
+			if len(clock.sleeps) != tt.wantSleeps {
+				t.Errorf("retry sleeps = %v, want %d", clock.sleeps, tt.wantSleeps)
+			}
+			for _, d := range clock.sleeps {
+				if d != 2*time.Second {
+					t.Errorf("retry delay = %s, want 2s", d)
+				}
+			}
+			if (len(enforced) > 0) != tt.wantEnforce {
+				t.Errorf("enforced = %v, want enforcement %v", enforced, tt.wantEnforce)
+			}
+		})
+	}
+}
+
+func TestMonitorGraceAcrossTicks(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	client := &fakeClient{results: []error{errNetwork}}
+	var enforced []string
+	m := newTestMonitor(client, clock, 0, &enforced)
+
+	// 每 5 分钟一轮心跳，宽限期 30 分钟：前几轮处于 grace，超过后处置
+	for tick := 1; ; tick++ {
+		clock.now = clock.now.Add(5 * time.Minute)
+		if m.check() {
+			if offline := clock.now.Sub(m.LastSuccess()); offline <= 30*time.Minute {
+				t.Fatalf("enforced after %s offline, within grace period", offline)
+			}
+			break
+		}
+		if tick > 10 {
+			t.Fatal("grace period never exceeded")
+		}
+		status := m.Status()
+		if status.State != StateGrace || status.GraceRemaining <= 0 {
+			t.Fatalf("tick %d: status = %+v", tick, status)
+		}
+	}
+
+	if len(enforced) != 1 {
+		t.Fatalf("enforced %d times, want 1", len(enforced))
+	}
+}
+
+func TestMonitorSuccessResetsGrace(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	client := &fakeClient{results: []error{errNetwork, errNetwork, errNetwork, nil, errNetwork}}
+	var enforced []string
+	m := newTestMonitor(client, clock, 25*time.Minute, &enforced)
+
+	m.check() // 离线 25 分钟，仍在宽限期内
+	clock.now = clock.now.Add(time.Minute)
+	m.check() // 第一次重试成功
+	if m.State() != StateHealthy || !m.LastSuccess().Equal(clock.now) {
+		t.Fatalf("state = %s, last success = %s", m.State(), m.LastSuccess())
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	if m.check() {
+		t.Fatal("enforced although the last success was 10 minutes ago")
+	}
+	if len(enforced) != 0 {
+		t.Fatalf("enforced = %v", enforced)
+	}
+}
+
+func TestMonitorRestoresLastSuccess(t *testing.T) {
+	past := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	m := NewMonitor(&fakeClient{results: []error{nil}}, &Config{StateStore: &memState{lastSuccess: past}})
+	if !m.LastSuccess().Equal(past) {
+		t.Fatalf("last success = %s, want %s", m.LastSuccess(), past)
+	}
+
+	// 未来的时间说明状态被篡改，不予采信
+	future := time.Now().Add(time.Hour)
+	m = NewMonitor(&fakeClient{results: []error{nil}}, &Config{StateStore: &memState{lastSuccess: future}})
+	if !m.LastSuccess().IsZero() {
+		t.Fatalf("future last success accepted: %s", m.LastSuccess())
+	}
+}
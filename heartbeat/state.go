@@ -0,0 +1,182 @@
+package heartbeat
+
+import (
+	"log"
+	"time"
+)
+
+// State 心跳监控器状态
+//
+//	starting -> healthy <-> degraded -> grace -> revoked
+//	任意状态 -> stopped（调用 Stop）
+type State int
+
+const (
+	StateStarting State = iota // 已启动，尚未完成首次心跳
+	StateHealthy               // 最近一次心跳成功
+	StateDegraded              // 心跳失败，正在重试
+	StateGrace                 // 重试全部失败，处于离线宽限期内
+	StateRevoked               // 服务器拒绝许可证或宽限期耗尽，已执行处置（终态）
+	StateStopped               // 已调用 Stop（终态）
+)
+
+// String 返回状态名称
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateHealthy:
+		return "healthy"
+	case StateDegraded:
+		return "degraded"
+	case StateGrace:
+		return "grace"
+	case StateRevoked:
+		return "revoked"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 状态变化事件
+type Event struct {
+	From   State
+	To     State
+	Reason string
+	Err    error // 导致状态变化的心跳错误（可能为 nil）
+	Time   time.Time
+}
+
+// Status 监控器当前状态快照，用于界面展示
+type Status struct {
+	State          State
+	Since          time.Time     // 进入当前状态的时间
+	Reason         string        // 进入当前状态的原因
+	LastError      error         // 最近一次心跳错误
+	LastSuccess    time.Time     // 最近一次成功心跳时间
+	OfflineFor     time.Duration // 已离线时长（healthy 时为 0）
+	GraceRemaining time.Duration // 剩余宽限时间（仅 grace 状态有效）
+}
+
+// subscriberBuffer 订阅通道缓冲大小，消费过慢时丢弃事件而不阻塞心跳
+const subscriberBuffer = 16
+
+// Status 返回当前状态快照
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{
+		State:       m.state,
+		Since:       m.stateSince,
+		Reason:      m.reason,
+		LastError:   m.lastErr,
+		LastSuccess: m.lastSuccess,
+	}
+
+	switch m.state {
+	case StateDegraded, StateGrace, StateRevoked:
+		if !m.lastSuccess.IsZero() {
+			status.OfflineFor = m.now().Sub(m.lastSuccess)
+		}
+	}
+
+	if m.state == StateGrace {
+		if remaining := m.gracePeriod - status.OfflineFor; remaining > 0 {
+			status.GraceRemaining = remaining
+		}
+	}
+
+	return status
+}
+
+// State 返回当前状态
+func (m *Monitor) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Subscribe 订阅状态变化事件
+// 返回的通道在 Stop 或调用取消函数后关闭；消费过慢时事件会被丢弃
+func (m *Monitor) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	m.mu.Lock()
+	id := m.nextSubID
+	m.nextSubID++
+	if m.closed {
+		close(ch)
+	} else {
+		m.subscribers[id] = ch
+	}
+	m.mu.Unlock()
+
+	cancel := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if sub, ok := m.subscribers[id]; ok {
+			delete(m.subscribers, id)
+			close(sub)
+		}
+	}
+
+	return ch, cancel
+}
+
+// setState 切换状态并通知订阅者，状态未变化时只更新错误信息
+// 终态（revoked、stopped）不再切换
+func (m *Monitor) setState(to State, reason string, err error) {
+	m.mu.Lock()
+
+	from := m.state
+	if from == StateRevoked || from == StateStopped {
+		m.mu.Unlock()
+		return
+	}
+
+	if err != nil {
+		m.lastErr = err
+	}
+
+	if from == to {
+		m.mu.Unlock()
+		return
+	}
+
+	now := m.now()
+	m.state = to
+	m.stateSince = now
+	m.reason = reason
+
+	event := Event{From: from, To: to, Reason: reason, Err: err, Time: now}
+	for _, ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	observer := m.observer
+
+	m.mu.Unlock()
+
+	log.Printf("[Heartbeat] State %s -> %s: %s", from, to, reason)
+
+	if observer != nil {
+		observer(event)
+	}
+}
+
+// closeSubscribers 关闭所有订阅通道
+func (m *Monitor) closeSubscribers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	for id, ch := range m.subscribers {
+		delete(m.subscribers, id)
+		close(ch)
+	}
+}
@@ -0,0 +1,258 @@
+package hwid
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Environment 运行环境类型
+type Environment string
+
+const (
+	EnvPhysical  Environment = "physical"
+	EnvVM        Environment = "vm"
+	EnvContainer Environment = "container"
+)
+
+// EnvironmentInfo 运行环境检测结果，激活时上报给服务器，由服务器按产品策略决定是否允许
+// 检测在客户端进行，只能发现常规的虚拟机和容器，不能替代服务器端的设备数限制
+type EnvironmentInfo struct {
+	Type    Environment `json:"type"`
+	Vendor  string      `json:"vendor,omitempty"`  // 虚拟化平台，如 kvm、vmware、docker
+	Signals []string    `json:"signals,omitempty"` // 命中的检测项，如 "dmi:QEMU"、"cpu:hypervisor"
+}
+
+// Virtualized 是否运行在虚拟机或容器中
+func (e EnvironmentInfo) Virtualized() bool {
+	return e.Type == EnvVM || e.Type == EnvContainer
+}
+
+// vmVendors DMI / 系统型号中的虚拟化厂商标识（小写匹配）
+var vmVendors = []struct {
+	marker string
+	vendor string
+}{
+	{"qemu", "kvm"},
+	{"kvm", "kvm"},
+	{"bochs", "kvm"},
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"innotek", "virtualbox"},
+	{"xen", "xen"},
+	{"parallels", "parallels"},
+	{"virtual machine", "hyperv"}, // Hyper-V: "Microsoft Corporation" / "Virtual Machine"
+	{"amazon ec2", "aws"},
+	{"google compute engine", "gce"},
+	{"openstack", "openstack"},
+}
+
+// vmMACPrefixes 虚拟化平台分配的网卡厂商前缀
+var vmMACPrefixes = map[string]string{
+	"00:05:69": "vmware",
+	"00:0c:29": "vmware",
+	"00:1c:14": "vmware",
+	"00:50:56": "vmware",
+	"08:00:27": "virtualbox",
+	"52:54:00": "kvm",
+	"00:16:3e": "xen",
+	"00:15:5d": "hyperv",
+	"00:1c:42": "parallels",
+}
+
+// containerMarkers /proc/1/cgroup 中的容器运行时标识
+var containerMarkers = []struct {
+	marker string
+	vendor string
+}{
+	{"docker", "docker"},
+	{"kubepods", "kubernetes"},
+	{"containerd", "containerd"},
+	{"libpod", "podman"},
+	{"lxc", "lxc"},
+}
+
+// DetectEnvironment 检测当前是否运行在虚拟机或容器中
+// 同时命中时按容器处理（容器通常运行在虚拟机上，容器是更具体的分类）
+func DetectEnvironment() EnvironmentInfo {
+	if vendor, signals := detectContainer(); len(signals) > 0 {
+		return EnvironmentInfo{Type: EnvContainer, Vendor: vendor, Signals: signals}
+	}
+	if vendor, signals := detectVM(); len(signals) > 0 {
+		return EnvironmentInfo{Type: EnvVM, Vendor: vendor, Signals: signals}
+	}
+	return EnvironmentInfo{Type: EnvPhysical}
+}
+
+// detectContainer 检查容器运行时留下的标记文件、cgroup 路径和环境变量（仅 Linux）
+func detectContainer() (string, []string) {
+	if runtime.GOOS != "linux" {
+		return "", nil
+	}
+
+	var vendor string
+	var signals []string
+	found := func(signal, v string) {
+		signals = append(signals, signal)
+		if vendor == "" {
+			vendor = v
+		}
+	}
+
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		found("file:/.dockerenv", "docker")
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		found("file:/run/.containerenv", "podman")
+	}
+
+	if data, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		cgroup := strings.ToLower(string(data))
+		for _, m := range containerMarkers {
+			if strings.Contains(cgroup, m.marker) {
+				found("cgroup:"+m.marker, m.vendor)
+				break
+			}
+		}
+	}
+
+	// systemd-nspawn、podman 等会为容器进程设置 container 环境变量
+	if name := os.Getenv("container"); name != "" {
+		found("env:container="+name, name)
+	}
+
+	return vendor, signals
+}
+
+// detectVM 检查 DMI 厂商信息、CPU hypervisor 标志和网卡前缀
+func detectVM() (string, []string) {
+	var vendor string
+	var signals []string
+	found := func(signal, v string) {
+		signals = append(signals, signal)
+		if vendor == "" {
+			vendor = v
+		}
+	}
+
+	for _, value := range systemVendorStrings() {
+		if v, ok := matchVMVendor(value); ok {
+			found("dmi:"+value, v)
+		}
+	}
+
+	if hypervisorFlag() {
+		found("cpu:hypervisor", "")
+	}
+
+	// 宿主机安装虚拟化软件后也会出现虚拟网卡，只有全部网卡都是虚拟网卡时才计入
+	if prefixes := vmMACs(); len(prefixes) > 0 {
+		for _, prefix := range prefixes {
+			found("mac:"+prefix, vmMACPrefixes[prefix])
+		}
+	}
+
+	return vendor, signals
+}
+
+// systemVendorStrings 返回系统厂商、型号、BIOS 厂商等字符串
+func systemVendorStrings() []string {
+	var values []string
+	switch runtime.GOOS {
+	case "linux":
+		for _, field := range []string{"sys_vendor", "product_name", "bios_vendor", "board_vendor"} {
+			if data, err := os.ReadFile(filepath.Join(dmiDir, field)); err == nil {
+				if value := strings.TrimSpace(string(data)); value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+	case "windows":
+		for _, property := range []string{"Manufacturer", "Model"} {
+			if output, err := windowsWMIC("computersystem", property); err == nil {
+				// 第一行是表头
+				if lines := strings.Split(output, "\n"); len(lines) > 1 {
+					values = append(values, strings.TrimSpace(lines[1]))
+				}
+			}
+		}
+	case "darwin":
+		if output, err := runCommand("sysctl", "-n", "hw.model"); err == nil {
+			values = append(values, strings.TrimSpace(output))
+		}
+	}
+	return values
+}
+
+// matchVMVendor 按 vmVendors 识别厂商或型号字符串中的虚拟化平台
+func matchVMVendor(value string) (string, bool) {
+	lower := strings.ToLower(value)
+	for _, v := range vmVendors {
+		if strings.Contains(lower, v.marker) {
+			return v.vendor, true
+		}
+	}
+	return "", false
+}
+
+// hypervisorFlag 检查 CPU 是否报告运行在虚拟机监控程序之下
+func hypervisorFlag() bool {
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/cpuinfo")
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "flags") {
+				for _, flag := range strings.Fields(line) {
+					if flag == "hypervisor" {
+						return true
+					}
+				}
+				return false
+			}
+		}
+	case "darwin":
+		output, err := runCommand("sysctl", "-n", "kern.hv_vmm_present")
+		return err == nil && strings.TrimSpace(output) == "1"
+	}
+	return false
+}
+
+// vmMACs 所有物理网卡都使用虚拟化厂商前缀时返回这些前缀
+func vmMACs() []string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	return matchVMMACs(interfaces)
+}
+
+// matchVMMACs 任一网卡不是虚拟化厂商前缀时返回 nil
+// 跳过回环和其他本地管理地址（随机 MAC、网桥等）；KVM 的 52:54:00 本身就是本地管理地址，需先按前缀匹配
+func matchVMMACs(interfaces []net.Interface) []string {
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, iface := range interfaces {
+		mac := iface.HardwareAddr
+		if iface.Flags&net.FlagLoopback != 0 || len(mac) < 3 {
+			continue
+		}
+
+		prefix := mac[:3].String()
+		if _, ok := vmMACPrefixes[prefix]; !ok {
+			if mac[0]&0x02 != 0 {
+				continue
+			}
+			return nil
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,80 @@
+package hwid
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMatchVMVendor(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantVendor string
+		wantOK     bool
+	}{
+		{"QEMU", "kvm", true},
+		{"Standard PC (Q35 + ICH9, 2009)", "", false},
+		{"VMware, Inc.", "vmware", true},
+		{"VMware7,1", "vmware", true},
+		{"innotek GmbH", "virtualbox", true},
+		{"VirtualBox", "virtualbox", true},
+		{"Xen", "xen", true},
+		{"Virtual Machine", "hyperv", true},
+		{"Amazon EC2", "aws", true},
+		{"Google Compute Engine", "gce", true},
+		{"Dell Inc.", "", false},
+		{"LENOVO", "", false},
+		{"MacBookPro18,3", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		vendor, ok := matchVMVendor(tt.value)
+		if vendor != tt.wantVendor || ok != tt.wantOK {
+			t.Errorf("matchVMVendor(%q) = %q, %v; want %q, %v", tt.value, vendor, ok, tt.wantVendor, tt.wantOK)
+		}
+	}
+}
+
+func TestMatchVMMACs(t *testing.T) {
+	iface := func(mac string, flags net.Flags) net.Interface {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			t.Fatalf("ParseMAC(%s): %v", mac, err)
+		}
+		return net.Interface{HardwareAddr: hw, Flags: flags}
+	}
+	loopback := net.Interface{Flags: net.FlagLoopback}
+
+	tests := []struct {
+		name       string
+		interfaces []net.Interface
+		want       []string
+	}{
+		{"no interfaces", nil, nil},
+		{"only loopback", []net.Interface{loopback}, nil},
+		{"kvm", []net.Interface{loopback, iface("52:54:00:12:34:56", 0)}, []string{"52:54:00"}},
+		{"vmware twice", []net.Interface{iface("00:50:56:00:00:01", 0), iface("00:50:56:00:00:02", 0)}, []string{"00:50:56"}},
+		{"physical", []net.Interface{iface("3c:22:fb:12:34:56", 0)}, nil},
+		// 宿主机：物理网卡加 VirtualBox 虚拟网卡
+		{"host with virtual adapter", []net.Interface{iface("3c:22:fb:12:34:56", 0), iface("08:00:27:00:00:01", 0)}, nil},
+		// 本地管理地址（随机 MAC、docker0 等网桥）不参与判断
+		{"locally administered", []net.Interface{iface("02:42:ac:11:00:02", 0), iface("52:54:00:12:34:56", 0)}, []string{"52:54:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchVMMACs(tt.interfaces); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("matchVMMACs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentInfoVirtualized(t *testing.T) {
+	for env, want := range map[Environment]bool{EnvPhysical: false, EnvVM: true, EnvContainer: true, "": false} {
+		if got := (EnvironmentInfo{Type: env}).Virtualized(); got != want {
+			t.Errorf("Virtualized(%q) = %v, want %v", env, got, want)
+		}
+	}
+}
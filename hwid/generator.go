@@ -0,0 +1,181 @@
+package hwid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Platform 默认生成器：按平台读取固定的硬件信息（与 GetHardwareID 相同）
+// 设置 Salt 后同一台机器在不同产品中得到互不关联的ID
+// 硬件上不存在的标识（ErrComponentAbsent）不参与硬件ID；其他来源读取失败时 GetHWID 返回 *SourceError
+type Platform struct {
+	Salt string
+}
+
+func (p Platform) GetHWID() (string, error) {
+	c, err := collectComponents()
+	if err != nil {
+		return "", err
+	}
+	return platformHWID(c, p.Salt)
+}
+
+// platformHWID 按 Platform 的规则由采集结果计算硬件ID
+func platformHWID(c *collection, salt string) (string, error) {
+	if errs := c.readErrs(); len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return hardwareID(c.components, salt), nil
+}
+
+func (p Platform) GetFingerprint() (Fingerprint, error) {
+	c, err := collectComponents()
+	if err != nil {
+		return nil, err
+	}
+	return fingerprintOf(c.components, p.Salt), nil
+}
+
+// Report 列出各来源的采集结果，用于排查硬件ID变化
+func (p Platform) Report() ([]SourceReport, error) {
+	c, err := collectComponents()
+	if err != nil {
+		return nil, err
+	}
+	return c.report(p.Salt), nil
+}
+
+// Composite 组合多个来源生成硬件ID
+// 参与硬件ID的来源读取失败时 GetHWID 返回 *SourceError，而不是跳过该来源改变硬件ID；
+// 结构化指纹和诊断报告仍使用读取成功的来源
+type Composite struct {
+	Sources []Source
+	Salt    string // 产品盐值，同 Platform.Salt
+}
+
+func (c Composite) GetHWID() (string, error) {
+	collected, err := c.collect()
+	if err != nil {
+		return "", err
+	}
+	if len(collected.hwidErrs) > 0 {
+		return "", errors.Join(collected.hwidErrs...)
+	}
+	if collected.hwidComponents() == 0 {
+		return "", fmt.Errorf("no hardware ID sources: all configured sources are fingerprint-only")
+	}
+	return hardwareID(collected.components, c.Salt), nil
+}
+
+func (c Composite) GetFingerprint() (Fingerprint, error) {
+	collected, err := c.collect()
+	if err != nil {
+		return nil, err
+	}
+	return fingerprintOf(collected.components, c.Salt), nil
+}
+
+// Report 列出各来源的采集结果，用于排查硬件ID变化
+func (c Composite) Report() ([]SourceReport, error) {
+	collected, err := c.collect()
+	if err != nil {
+		return nil, err
+	}
+	return collected.report(c.Salt), nil
+}
+
+// collect 按配置顺序读取各来源，顺序决定硬件ID
+func (c Composite) collect() (*collection, error) {
+	if len(c.Sources) == 0 {
+		return nil, fmt.Errorf("no hardware ID sources configured")
+	}
+
+	collected := &collection{}
+	var errs []error
+	for _, source := range c.Sources {
+		value, err := source.Value()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+		}
+		if fingerprintOnly(source) {
+			collected.addFingerprintOnly(source.Name(), "", value, err)
+		} else {
+			collected.add(source.Name(), "", value, err)
+		}
+	}
+
+	if len(collected.components) == 0 {
+		return nil, fmt.Errorf("no hardware identifiers found: %w", errors.Join(errs...))
+	}
+	return collected, nil
+}
+
+// Fake 返回固定结果的生成器，用于测试
+type Fake struct {
+	HWID        string
+	Fingerprint Fingerprint
+	Err         error
+}
+
+func (f Fake) GetHWID() (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.HWID, nil
+}
+
+func (f Fake) GetFingerprint() (Fingerprint, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Fingerprint, nil
+}
+
+// NewGenerator 根据来源名称创建生成器，用于从配置文件选择
+// 来源为空或为 ["platform"] 时使用 Platform；其他可用来源：
+// machine_id、cpu、disk、mac（只用于指纹）、container_id、dmi:<字段>（如 dmi:product_uuid）
+func NewGenerator(sources []string, salt string) (Generator, error) {
+	if len(sources) == 0 || (len(sources) == 1 && sources[0] == "platform") {
+		return Platform{Salt: salt}, nil
+	}
+
+	composite := Composite{Salt: salt}
+	for _, name := range sources {
+		source, err := parseSource(name)
+		if err != nil {
+			return nil, err
+		}
+		composite.Sources = append(composite.Sources, source)
+	}
+
+	for _, source := range composite.Sources {
+		if !fingerprintOnly(source) {
+			return composite, nil
+		}
+	}
+	return nil, fmt.Errorf("hardware ID sources %v are fingerprint-only, add at least one other source", sources)
+}
+
+func parseSource(name string) (Source, error) {
+	switch name {
+	case ComponentMachineID:
+		return MachineIDSource{}, nil
+	case ComponentCPU:
+		return CPUSource{}, nil
+	case ComponentDisk:
+		return DiskSource{}, nil
+	case ComponentMAC:
+		return MACSource{}, nil
+	case ComponentContainerID:
+		return ContainerIDSource{}, nil
+	}
+
+	if field, ok := strings.CutPrefix(name, "dmi:"); ok && field != "" {
+		return DMISource{Field: field}, nil
+	}
+	if name == "platform" {
+		return nil, fmt.Errorf("hardware ID source \"platform\" cannot be combined with other sources")
+	}
+	return nil, fmt.Errorf("unknown hardware ID source %q", name)
+}
@@ -0,0 +1,197 @@
+package hwid
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"testing"
+)
+
+// staticSource 返回固定值或错误的来源
+type staticSource struct {
+	name  string
+	value string
+	err   error
+}
+
+func (s staticSource) Name() string           { return s.name }
+func (s staticSource) Value() (string, error) { return s.value, s.err }
+
+// macSource 模拟 MACSource：只用于结构化指纹
+type macSource struct{ staticSource }
+
+func (macSource) FingerprintOnly() bool { return true }
+
+var errUnreadable = errors.New("permission denied")
+
+func TestCompositeMACNotInHWID(t *testing.T) {
+	composite := func(mac string) Composite {
+		return Composite{Sources: []Source{
+			staticSource{name: ComponentMachineID, value: "machine-1"},
+			macSource{staticSource{name: ComponentMAC, value: mac}},
+		}}
+	}
+
+	before, err := composite("00:11:22:33:44:55").GetHWID()
+	if err != nil {
+		t.Fatalf("GetHWID: %v", err)
+	}
+	after, err := composite("00:11:22:33:44:66").GetHWID()
+	if err != nil {
+		t.Fatalf("GetHWID: %v", err)
+	}
+	if before != after {
+		t.Fatal("changing the network card changed the hardware ID")
+	}
+
+	// MAC 地址仍然用于结构化指纹，服务器据此识别同一台设备
+	fingerprint, err := composite("00:11:22:33:44:55").GetFingerprint()
+	if err != nil {
+		t.Fatalf("GetFingerprint: %v", err)
+	}
+	if fingerprint[ComponentMAC] == "" || fingerprint[ComponentMachineID] == "" {
+		t.Fatalf("fingerprint = %v, want machine_id and mac", fingerprint)
+	}
+}
+
+func TestCompositeSourceFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		sources     []Source
+		wantHWIDErr bool
+		wantFailed  string // 诊断报告中读取失败的组件
+	}{
+		{
+			name: "all sources readable",
+			sources: []Source{
+				staticSource{name: ComponentMachineID, value: "machine-1"},
+				staticSource{name: ComponentDisk, value: "disk-1"},
+			},
+		},
+		{
+			name: "hardware ID source fails",
+			sources: []Source{
+				staticSource{name: ComponentMachineID, value: "machine-1"},
+				staticSource{name: ComponentDisk, err: errUnreadable},
+			},
+			wantHWIDErr: true,
+			wantFailed:  ComponentDisk,
+		},
+		{
+			name: "fingerprint-only source fails",
+			sources: []Source{
+				staticSource{name: ComponentMachineID, value: "machine-1"},
+				macSource{staticSource{name: ComponentMAC, err: errUnreadable}},
+			},
+			wantFailed: ComponentMAC,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			composite := Composite{Sources: tt.sources}
+
+			_, err := composite.GetHWID()
+			var sourceErr *SourceError
+			if tt.wantHWIDErr {
+				// 不能跳过失败的来源而悄悄得到另一个硬件ID
+				if !errors.As(err, &sourceErr) || sourceErr.Component != tt.wantFailed || !errors.Is(err, errUnreadable) {
+					t.Fatalf("GetHWID error = %v, want *SourceError for %s", err, tt.wantFailed)
+				}
+			} else if err != nil {
+				t.Fatalf("GetHWID: %v", err)
+			}
+
+			// 诊断报告和指纹在来源失败时仍然可用
+			if _, err := composite.GetFingerprint(); err != nil {
+				t.Fatalf("GetFingerprint: %v", err)
+			}
+			reports, err := composite.Report()
+			if err != nil {
+				t.Fatalf("Report: %v", err)
+			}
+			var failed string
+			for _, report := range reports {
+				if report.Error != "" {
+					failed = report.Component
+				}
+			}
+			if failed != tt.wantFailed {
+				t.Fatalf("report failed component = %q, want %q", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestPlatformSourceFailure(t *testing.T) {
+	// 同一台机器上 CPU 和 machine-id 总能读到，只有磁盘的读取结果不同
+	collect := func(diskErr error) *collection {
+		c := &collection{}
+		c.add(ComponentCPU, "/proc/cpuinfo", "model name : Test CPU", nil)
+		c.add(ComponentMachineID, "/etc/machine-id", "machine-1", nil)
+		c.add(ComponentDisk, "/sys/block/vda", "disk-1", diskErr)
+		c.addFingerprintOnly(ComponentMAC, "/sys/class/net", "", errUnreadable)
+		return c
+	}
+	withoutDisk := func() *collection {
+		c := &collection{}
+		c.add(ComponentCPU, "/proc/cpuinfo", "model name : Test CPU", nil)
+		c.add(ComponentMachineID, "/etc/machine-id", "machine-1", nil)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		diskErr error
+		wantErr bool
+	}{
+		{"readable", nil, false},
+		// 硬件上没有的标识每次都读不到，跳过它得到的硬件ID是稳定的
+		{"no serial", absentf("no serial number for disk vda"), false},
+		{"file missing", fmt.Errorf("open /sys/block/vda/serial: %w", fs.ErrNotExist), false},
+		{"command missing", &exec.Error{Name: "wmic", Err: exec.ErrNotFound}, false},
+		// 权限或命令失败可能只是这一次，跳过会让设备变成另一台
+		{"permission denied", fs.ErrPermission, true},
+		{"command failed", errUnreadable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hwid, err := platformHWID(collect(tt.diskErr), "")
+			if tt.wantErr {
+				var sourceErr *SourceError
+				if !errors.As(err, &sourceErr) || sourceErr.Component != ComponentDisk || !errors.Is(err, tt.diskErr) {
+					t.Fatalf("platformHWID error = %v, want *SourceError for %s", err, ComponentDisk)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("platformHWID: %v", err)
+			}
+
+			want := hardwareID(collect(nil).components, "")
+			if tt.diskErr != nil {
+				want = hardwareID(withoutDisk().components, "")
+			}
+			if hwid != want {
+				t.Fatal("hardware ID does not match the readable components")
+			}
+		})
+	}
+}
+
+func TestNewGeneratorRejectsFingerprintOnlySources(t *testing.T) {
+	if _, err := NewGenerator([]string{"mac"}, ""); err == nil {
+		t.Fatal("mac alone accepted as hardware ID source")
+	}
+
+	generator, err := NewGenerator([]string{"machine_id", "mac"}, "")
+	if err != nil {
+		t.Fatalf("NewGenerator: %v", err)
+	}
+	sources := generator.(Composite).Sources
+	if !fingerprintOnly(sources[1]) || fingerprintOnly(sources[0]) {
+		t.Fatal("mac source not marked fingerprint-only")
+	}
+}
@@ -1,161 +1,409 @@
 package hwid
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
 
 // Generator 硬件ID生成器接口
+// 实现见 Platform（默认）、Composite（自选来源）和 Fake（测试）
 type Generator interface {
 	GetHWID() (string, error)
+	GetFingerprint() (Fingerprint, error)
 }
 
-// GetHardwareID 获取跨平台的硬件ID（基于CPU、磁盘、主板信息）
-// 返回一个SHA256哈希值作为稳定的机器指纹
-func GetHardwareID() (string, error) {
-	var hwInfo string
-	var err error
+// 硬件组件名称，与服务器的组件权重保持一致
+const (
+	ComponentCPU          = "cpu"
+	ComponentBoard        = "board"
+	ComponentDisk         = "disk"
+	ComponentMachineID    = "machine_id"
+	ComponentPlatformUUID = "platform_uuid"
+	ComponentSerial       = "serial"
+)
 
-	switch runtime.GOOS {
-	case "windows":
-		hwInfo, err = getWindowsHWID()
-	case "linux":
-		hwInfo, err = getLinuxHWID()
-	case "darwin":
-		hwInfo, err = getDarwinHWID()
-	default:
-		return "", fmt.Errorf("unsupported platform: %s", runtime.GOOS)
-	}
+// component 单个硬件标识
+type component struct {
+	name   string
+	value  string
+	source string // 读取位置，用于诊断报告
 
-	if err != nil {
-		return "", fmt.Errorf("failed to get hardware info: %w", err)
-	}
+	// fingerprintOnly 只用于结构化指纹，不参与硬件ID
+	// 用于只有 root 才能读取的来源，避免硬件ID随运行权限变化
+	fingerprintOnly bool
+}
 
-	// 使用SHA256生成稳定的硬件ID
-	hash := sha256.Sum256([]byte(hwInfo))
-	return hex.EncodeToString(hash[:]), nil
+// collection 一次采集的结果，包括读取失败的来源
+type collection struct {
+	components []component
+	failures   []SourceReport
+	hwidErrs   []error // 参与硬件ID的来源的读取错误（*SourceError）
 }
 
-// getWindowsHWID Windows平台硬件ID获取
-func getWindowsHWID() (string, error) {
-	var components []string
+// add 记录一个来源的读取结果，失败的来源只出现在诊断报告中
+func (c *collection) add(name, source string, value string, err error) {
+	c.addComponent(component{name: name, value: value, source: source}, err)
+}
 
-	// CPU ID (通过WMIC)
-	cpuID, err := runCommand("wmic", "cpu", "get", "ProcessorId")
-	if err == nil && cpuID != "" {
-		components = append(components, strings.TrimSpace(cpuID))
+// addFingerprintOnly 同 add，但该组件不参与硬件ID
+func (c *collection) addFingerprintOnly(name, source string, value string, err error) {
+	c.addComponent(component{name: name, value: value, source: source, fingerprintOnly: true}, err)
+}
+
+func (c *collection) addComponent(comp component, err error) {
+	if err != nil {
+		if !comp.fingerprintOnly {
+			c.hwidErrs = append(c.hwidErrs, &SourceError{Component: comp.name, Err: err})
+		}
+		c.failures = append(c.failures, SourceReport{
+			Component: comp.name,
+			Source:    comp.source,
+			InHWID:    !comp.fingerprintOnly,
+			Error:     err.Error(),
+		})
+		return
 	}
+	c.components = append(c.components, comp)
+}
 
-	// 主板序列号
-	boardSerial, err := runCommand("wmic", "baseboard", "get", "SerialNumber")
-	if err == nil && boardSerial != "" {
-		components = append(components, strings.TrimSpace(boardSerial))
+// readErrs 参与硬件ID的来源中除硬件上不存在（ErrComponentAbsent）以外的读取错误
+// 不存在的标识每次都读不到，跳过它不会改变硬件ID；其他错误（权限、命令失败等）可能只是偶发
+func (c *collection) readErrs() []error {
+	var errs []error
+	for _, err := range c.hwidErrs {
+		if !componentAbsent(err) {
+			errs = append(errs, err)
+		}
 	}
+	return errs
+}
 
-	// 磁盘序列号
-	diskSerial, err := runCommand("wmic", "diskdrive", "get", "SerialNumber")
-	if err == nil && diskSerial != "" {
-		components = append(components, strings.TrimSpace(diskSerial))
+// hwidComponents 参与硬件ID计算的组件数
+func (c *collection) hwidComponents() int {
+	n := 0
+	for _, comp := range c.components {
+		if !comp.fingerprintOnly {
+			n++
+		}
 	}
+	return n
+}
 
-	if len(components) == 0 {
-		return "", fmt.Errorf("no hardware identifiers found on Windows")
+// report 生成诊断报告：成功的来源附带组件哈希，失败的来源附带原因
+func (c *collection) report(salt string) []SourceReport {
+	reports := make([]SourceReport, 0, len(c.components)+len(c.failures))
+	for _, comp := range c.components {
+		reports = append(reports, SourceReport{
+			Component: comp.name,
+			Source:    comp.source,
+			InHWID:    !comp.fingerprintOnly,
+			Hash:      componentHash(comp, salt),
+		})
 	}
+	return append(reports, c.failures...)
+}
+
+// ErrComponentAbsent 这台机器上没有该硬件标识（如虚拟磁盘没有序列号），每次读取结果相同
+var ErrComponentAbsent = errors.New("hardware component not present")
+
+// absentError 硬件上不存在的标识，errors.Is(err, ErrComponentAbsent) 为 true
+type absentError struct{ msg string }
+
+func (e absentError) Error() string        { return e.msg }
+func (e absentError) Is(target error) bool { return target == ErrComponentAbsent }
 
-	return strings.Join(components, "|"), nil
+func absentf(format string, args ...interface{}) error {
+	return absentError{msg: fmt.Sprintf(format, args...)}
 }
 
-// getLinuxHWID Linux平台硬件ID获取
-func getLinuxHWID() (string, error) {
-	var components []string
+// componentAbsent 读取错误是否表示硬件上不存在该标识（文件或命令不存在也算）
+func componentAbsent(err error) bool {
+	return errors.Is(err, ErrComponentAbsent) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, exec.ErrNotFound)
+}
 
-	// CPU信息
-	cpuInfo, err := os.ReadFile("/proc/cpuinfo")
-	if err == nil {
-		// 提取CPU序列号或型号
-		lines := strings.Split(string(cpuInfo), "\n")
-		for _, line := range lines {
+// SourceError 参与硬件ID的来源读取失败
+// 跳过该来源会让硬件ID悄悄变化（设备被当作新设备），因此 Composite 和 Platform 返回该错误而不是跳过
+type SourceError struct {
+	Component string
+	Err       error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("hardware ID source %s failed: %v", e.Component, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// SourceReport 单个硬件标识来源的采集结果，用于排查硬件ID或指纹变化
+// 只包含组件哈希，可以放心地让用户提交给技术支持
+type SourceReport struct {
+	Component string `json:"component"`
+	Source    string `json:"source,omitempty"` // 读取位置，如 /sys/class/dmi/id/product_uuid
+	InHWID    bool   `json:"in_hwid"`          // 是否参与硬件ID计算（否则只用于结构化指纹）
+	Hash      string `json:"hash,omitempty"`   // 组件哈希（与结构化指纹相同），对比两次报告即可找出变化的组件
+	Error     string `json:"error,omitempty"`  // 读取失败原因，为空表示采集成功
+}
+
+// Reporter 可生成诊断报告的生成器（Platform 和 Composite）
+type Reporter interface {
+	Report() ([]SourceReport, error)
+}
+
+// Fingerprint 结构化硬件指纹：组件名 -> 组件值的 SHA256
+// 各组件单独哈希，服务器在部分硬件更换后仍能按权重识别同一台设备，且看不到原始硬件信息
+type Fingerprint map[string]string
+
+// GetHardwareID 获取跨平台的硬件ID（基于CPU、磁盘、主板信息）
+// 返回一个SHA256哈希值作为稳定的机器指纹
+func GetHardwareID() (string, error) {
+	return Platform{}.GetHWID()
+}
+
+// GetFingerprint 获取结构化硬件指纹，激活时与硬件ID一起发送
+func GetFingerprint() (Fingerprint, error) {
+	return Platform{}.GetFingerprint()
+}
+
+// PreviousHardwareID 返回旧版本算法计算的硬件ID，升级后首次激活时发送，服务器据此迁移设备绑定
+// 只有 Linux 的算法发生过变化（旧版本通过 dmidecode 读取主板序列号，不包含磁盘和网卡），其他平台返回空字符串
+func PreviousHardwareID() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+
+	var values []string
+	if cpuInfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(cpuInfo), "\n") {
 			if strings.Contains(line, "Serial") || strings.Contains(line, "model name") {
-				components = append(components, strings.TrimSpace(line))
+				values = append(values, strings.TrimSpace(line))
 				break
 			}
 		}
 	}
+	if machineID, err := linuxMachineID(); err == nil {
+		values = append(values, machineID)
+	}
+	if boardSerial, err := runCommand("dmidecode", "-s", "baseboard-serial-number"); err == nil && boardSerial != "" {
+		values = append(values, strings.TrimSpace(boardSerial))
+	}
 
-	// 机器ID（systemd）
-	machineID, err := os.ReadFile("/etc/machine-id")
-	if err == nil {
-		components = append(components, strings.TrimSpace(string(machineID)))
-	} else {
-		// 备用：尝试 /var/lib/dbus/machine-id
-		machineID, err = os.ReadFile("/var/lib/dbus/machine-id")
-		if err == nil {
-			components = append(components, strings.TrimSpace(string(machineID)))
+	if len(values) == 0 {
+		return ""
+	}
+	return saltedHash("", strings.Join(values, "|"))
+}
+
+// hardwareID 由组件值计算硬件ID
+// salt 为空时使用SHA256，否则使用 HMAC-SHA256，不同产品得到互不关联的ID
+func hardwareID(components []component, salt string) string {
+	var values []string
+	for _, c := range components {
+		if !c.fingerprintOnly {
+			values = append(values, c.value)
 		}
 	}
+	return saltedHash(salt, strings.Join(values, "|"))
+}
 
-	// 主板信息（通过dmidecode，需要root权限）
-	boardSerial, err := runCommand("dmidecode", "-s", "baseboard-serial-number")
-	if err == nil && boardSerial != "" {
-		components = append(components, strings.TrimSpace(boardSerial))
+// fingerprintOf 由组件计算结构化指纹
+func fingerprintOf(components []component, salt string) Fingerprint {
+	fingerprint := make(Fingerprint, len(components))
+	for _, c := range components {
+		fingerprint[c.name] = componentHash(c, salt)
 	}
+	return fingerprint
+}
+
+// componentHash 忽略空白差异，组件名参与哈希，避免不同组件的值互相匹配
+func componentHash(c component, salt string) string {
+	normalized := strings.Join(strings.Fields(c.value), " ")
+	return saltedHash(salt, c.name+"\x00"+normalized)
+}
 
-	if len(components) == 0 {
-		return "", fmt.Errorf("no hardware identifiers found on Linux")
+func saltedHash(salt, data string) string {
+	if salt == "" {
+		hash := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(hash[:])
 	}
 
-	return strings.Join(components, "|"), nil
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
-// getDarwinHWID macOS平台硬件ID获取
-func getDarwinHWID() (string, error) {
-	var components []string
+// collectComponents 按平台收集硬件标识
+func collectComponents() (*collection, error) {
+	c := &collection{}
 
-	// 硬件UUID
-	hwUUID, err := runCommand("ioreg", "-rd1", "-c", "IOPlatformExpertDevice")
-	if err == nil && hwUUID != "" {
-		// 提取IOPlatformUUID
-		for _, line := range strings.Split(hwUUID, "\n") {
-			if strings.Contains(line, "IOPlatformUUID") {
-				components = append(components, strings.TrimSpace(line))
-				break
-			}
-		}
+	switch runtime.GOOS {
+	case "windows":
+		getWindowsHWID(c)
+	case "linux":
+		getLinuxHWID(c)
+	case "darwin":
+		getDarwinHWID(c)
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 
-	// 序列号
-	serialNumber, err := runCommand("ioreg", "-l")
-	if err == nil && serialNumber != "" {
-		for _, line := range strings.Split(serialNumber, "\n") {
-			if strings.Contains(line, "IOPlatformSerialNumber") {
-				components = append(components, strings.TrimSpace(line))
-				break
-			}
-		}
+	if c.hwidComponents() == 0 {
+		return nil, fmt.Errorf("failed to get hardware info: no hardware identifiers found on %s", runtime.GOOS)
 	}
+	return c, nil
+}
+
+// getWindowsHWID Windows平台硬件ID获取
+func getWindowsHWID(c *collection) {
+	// CPU ID (通过WMIC)
+	cpuID, err := windowsWMIC("cpu", "ProcessorId")
+	c.add(ComponentCPU, "wmic cpu ProcessorId", cpuID, err)
+
+	// 主板序列号
+	boardSerial, err := windowsWMIC("baseboard", "SerialNumber")
+	c.add(ComponentBoard, "wmic baseboard SerialNumber", boardSerial, err)
+
+	// 磁盘序列号
+	diskSerial, err := windowsWMIC("diskdrive", "SerialNumber")
+	c.add(ComponentDisk, "wmic diskdrive SerialNumber", diskSerial, err)
+}
+
+// getLinuxHWID Linux平台硬件ID获取
+// 硬件ID只使用普通用户可读的来源，以 root 和普通用户运行得到相同的ID；
+// 只有 root 可读的 DMI 序列号和 UUID 仅加入结构化指纹
+func getLinuxHWID(c *collection) {
+	// CPU信息
+	cpu, err := linuxCPU()
+	c.add(ComponentCPU, "/proc/cpuinfo", cpu, err)
+
+	// 机器ID（systemd）
+	machineID, err := linuxMachineID()
+	c.add(ComponentMachineID, "/etc/machine-id", machineID, err)
+
+	// 根文件系统所在磁盘的序列号
+	disk, source, err := linuxRootDiskSerial()
+	c.add(ComponentDisk, source, disk, err)
+
+	// 物理网卡的出厂 MAC 地址：网卡会被插拔、禁用或更换，只加入结构化指纹
+	mac, err := linuxPermanentMACs()
+	c.addFingerprintOnly(ComponentMAC, "/sys/class/net", mac, err)
+
+	// 主板和整机信息（大多数发行版只有 root 可读）
+	for _, dmi := range []DMISource{{"product_uuid"}, {"board_serial"}, {"product_serial"}} {
+		value, err := readDMI(dmi.Field)
+		c.addFingerprintOnly(dmi.Name(), filepath.Join(dmiDir, dmi.Field), value, err)
+	}
+}
+
+// getDarwinHWID macOS平台硬件ID获取
+func getDarwinHWID(c *collection) {
+	// 硬件UUID
+	hwUUID, uuidErr := darwinPlatformUUID()
+
+	// 序列号
+	serial, serialErr := darwinIORegLine([]string{"-l"}, "IOPlatformSerialNumber")
 
 	// 备用方案：使用system_profiler（较慢）
-	if len(components) == 0 {
+	if uuidErr != nil && serialErr != nil {
 		hwInfo, err := runCommand("system_profiler", "SPHardwareDataType")
 		if err == nil && hwInfo != "" {
 			for _, line := range strings.Split(hwInfo, "\n") {
-				if strings.Contains(line, "Serial Number") || strings.Contains(line, "Hardware UUID") {
-					components = append(components, strings.TrimSpace(line))
+				if strings.Contains(line, "Serial Number") {
+					c.add(ComponentSerial, "system_profiler SPHardwareDataType", strings.TrimSpace(line), nil)
+				} else if strings.Contains(line, "Hardware UUID") {
+					c.add(ComponentPlatformUUID, "system_profiler SPHardwareDataType", strings.TrimSpace(line), nil)
 				}
 			}
+			return
 		}
 	}
 
-	if len(components) == 0 {
-		return "", fmt.Errorf("no hardware identifiers found on macOS")
+	c.add(ComponentPlatformUUID, "ioreg IOPlatformUUID", hwUUID, uuidErr)
+	c.add(ComponentSerial, "ioreg IOPlatformSerialNumber", serial, serialErr)
+}
+
+// windowsWMIC 通过WMIC读取硬件属性（输出包含表头）
+func windowsWMIC(class, property string) (string, error) {
+	output, err := runCommand("wmic", class, "get", property)
+	if err != nil {
+		return "", err
+	}
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return "", absentf("wmic %s %s returned no data", class, property)
+	}
+	return output, nil
+}
+
+// linuxCPU 读取 /proc/cpuinfo 中的CPU标识
+// 优先使用 SoC 序列号（树莓派等 ARM 设备，位于文件末尾），其次是型号
+func linuxCPU() (string, error) {
+	cpuInfo, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return "", err
+	}
+
+	// 保留整行（如 "model name : ..."），与旧版本的组件哈希一致
+	lines := make(map[string]string)
+	for _, line := range strings.Split(string(cpuInfo), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, seen := lines[key]; !seen && strings.Trim(value, "0") != "" {
+			lines[key] = strings.TrimSpace(line)
+		}
+	}
+
+	for _, key := range []string{"Serial", "model name", "Hardware", "Processor", "cpu model"} {
+		if line, ok := lines[key]; ok {
+			return line, nil
+		}
 	}
+	return "", absentf("no CPU identifier in /proc/cpuinfo")
+}
+
+// linuxMachineID 读取 systemd 机器ID，备用 /var/lib/dbus/machine-id
+func linuxMachineID() (string, error) {
+	machineID, err := os.ReadFile("/etc/machine-id")
+	if err != nil {
+		machineID, err = os.ReadFile("/var/lib/dbus/machine-id")
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(machineID)), nil
+}
 
-	return strings.Join(components, "|"), nil
+// darwinPlatformUUID 读取 IOPlatformUUID 所在行
+func darwinPlatformUUID() (string, error) {
+	return darwinIORegLine([]string{"-rd1", "-c", "IOPlatformExpertDevice"}, "IOPlatformUUID")
+}
+
+// darwinIORegLine 返回 ioreg 输出中包含 key 的第一行
+func darwinIORegLine(args []string, key string) (string, error) {
+	output, err := runCommand("ioreg", args...)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, key) {
+			return strings.TrimSpace(line), nil
+		}
+	}
+	return "", absentf("%s not found", key)
 }
 
 // runCommand 执行系统命令并返回输出
@@ -0,0 +1,292 @@
+package hwid
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// 其他来源的组件名称（服务器按默认权重 1 计算）
+const (
+	ComponentMAC         = "mac"
+	ComponentContainerID = "container_id"
+)
+
+// Source 单个硬件标识来源，供 Composite 组合使用
+type Source interface {
+	// Name 组件名称，作为结构化指纹的键
+	Name() string
+	// Value 读取标识值，当前平台不支持或读取失败时返回错误
+	Value() (string, error)
+}
+
+// FingerprintOnlySource 只加入结构化指纹、不参与硬件ID的来源（如 MACSource）
+type FingerprintOnlySource interface {
+	Source
+	FingerprintOnly() bool
+}
+
+// fingerprintOnly 来源是否只用于结构化指纹
+func fingerprintOnly(source Source) bool {
+	s, ok := source.(FingerprintOnlySource)
+	return ok && s.FingerprintOnly()
+}
+
+// MachineIDSource 操作系统安装的唯一ID
+// Linux 为 /etc/machine-id，Windows 为注册表 MachineGuid，macOS 为 IOPlatformUUID
+// 重装系统后会变化（macOS 除外）
+type MachineIDSource struct{}
+
+func (MachineIDSource) Name() string { return ComponentMachineID }
+
+func (MachineIDSource) Value() (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxMachineID()
+	case "windows":
+		output, err := runCommand("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid")
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(output, "\n") {
+			if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "MachineGuid" {
+				return fields[2], nil
+			}
+		}
+		return "", fmt.Errorf("MachineGuid not found in registry")
+	case "darwin":
+		return darwinPlatformUUID()
+	default:
+		return "", fmt.Errorf("machine ID not supported on %s", runtime.GOOS)
+	}
+}
+
+// dmiDir Linux 通过 sysfs 导出的 DMI 信息
+const dmiDir = "/sys/class/dmi/id"
+
+// dmiPlaceholders 厂商未填写时常见的占位值，不能用于区分机器
+var dmiPlaceholders = map[string]bool{
+	"":                                     true,
+	"none":                                 true,
+	"default string":                       true,
+	"to be filled by o.e.m.":               true,
+	"not specified":                        true,
+	"not applicable":                       true,
+	"system serial number":                 true,
+	"0":                                    true,
+	"00000000":                             true,
+	"0123456789":                           true,
+	"03000200-0400-0500-0006-000700080009": true,
+}
+
+// DMISource 读取 /sys/class/dmi/id 下的字段（仅 Linux）
+// 常用字段：board_serial、product_uuid、product_serial（需要 root）；board_vendor、board_name、product_name（任何用户可读）
+type DMISource struct {
+	Field string
+}
+
+// Name 序列号和 UUID 字段使用与服务器权重对应的组件名，其他字段为 "dmi_<字段>"
+func (s DMISource) Name() string {
+	switch s.Field {
+	case "board_serial":
+		return ComponentBoard
+	case "product_uuid":
+		return ComponentPlatformUUID
+	case "product_serial":
+		return ComponentSerial
+	default:
+		return "dmi_" + s.Field
+	}
+}
+
+func (s DMISource) Value() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("DMI sysfs not available on %s", runtime.GOOS)
+	}
+	if s.Field == "" || strings.ContainsAny(s.Field, `/\`) {
+		return "", fmt.Errorf("invalid DMI field %q", s.Field)
+	}
+	return readDMI(s.Field)
+}
+
+// MACSource 物理网卡的 MAC 地址（排序后拼接）
+// Linux 从 sysfs 读取出厂地址；其他平台跳过回环、无地址的接口和本地管理地址
+// （Docker、VPN 等虚拟网卡通常使用随机的本地管理地址）
+// 网卡会被插拔、禁用或更换，MAC 地址也容易修改，因此只加入结构化指纹，不参与硬件ID
+type MACSource struct{}
+
+func (MACSource) Name() string { return ComponentMAC }
+
+func (MACSource) FingerprintOnly() bool { return true }
+
+func (MACSource) Value() (string, error) {
+	if runtime.GOOS == "linux" {
+		return linuxPermanentMACs()
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, iface := range interfaces {
+		mac := iface.HardwareAddr
+		if iface.Flags&net.FlagLoopback != 0 || len(mac) == 0 || mac[0]&0x02 != 0 {
+			continue
+		}
+		if addr := mac.String(); !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no physical network interfaces found")
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ","), nil
+}
+
+// CPUSource CPU标识（Windows 为 ProcessorId，Linux 为序列号或型号，macOS 为型号）
+// 同型号的机器取值相同，只适合与其他来源组合使用
+type CPUSource struct{}
+
+func (CPUSource) Name() string { return ComponentCPU }
+
+func (CPUSource) Value() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return windowsWMIC("cpu", "ProcessorId")
+	case "linux":
+		return linuxCPU()
+	case "darwin":
+		output, err := runCommand("sysctl", "-n", "machdep.cpu.brand_string")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(output), nil
+	default:
+		return "", fmt.Errorf("CPU identifier not supported on %s", runtime.GOOS)
+	}
+}
+
+// DiskSource 磁盘序列号
+// Linux 读取 sysfs 中的序列号（NVMe 等），没有时使用 lsblk；多块磁盘按设备名排序后拼接
+type DiskSource struct{}
+
+func (DiskSource) Name() string { return ComponentDisk }
+
+func (DiskSource) Value() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return windowsWMIC("diskdrive", "SerialNumber")
+	case "linux":
+		return linuxDiskSerials()
+	case "darwin":
+		output, err := runCommand("system_profiler", "SPNVMeDataType", "SPSerialATADataType")
+		if err != nil {
+			return "", err
+		}
+		var serials []string
+		for _, line := range strings.Split(output, "\n") {
+			if strings.Contains(line, "Serial Number:") {
+				serials = append(serials, strings.TrimSpace(line))
+			}
+		}
+		if len(serials) == 0 {
+			return "", fmt.Errorf("no disk serial numbers found")
+		}
+		return strings.Join(serials, ","), nil
+	default:
+		return "", fmt.Errorf("disk serial not supported on %s", runtime.GOOS)
+	}
+}
+
+// virtualBlockPrefixes 不对应物理磁盘的块设备
+var virtualBlockPrefixes = []string{"loop", "ram", "zram", "dm-", "md", "sr", "nbd"}
+
+func linuxDiskSerials() (string, error) {
+	devices, _ := filepath.Glob("/sys/block/*")
+	sort.Strings(devices)
+
+	var serials []string
+	for _, device := range devices {
+		name := filepath.Base(device)
+		virtual := false
+		for _, prefix := range virtualBlockPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				virtual = true
+				break
+			}
+		}
+		if virtual {
+			continue
+		}
+
+		if data, err := os.ReadFile(filepath.Join(device, "device", "serial")); err == nil {
+			if serial := strings.TrimSpace(string(data)); serial != "" {
+				serials = append(serials, serial)
+			}
+		}
+	}
+
+	// SATA/SCSI 磁盘的序列号不在 sysfs 中，lsblk 从 udev 数据库读取（不需要 root）
+	if len(serials) == 0 {
+		output, err := runCommand("lsblk", "-dno", "SERIAL")
+		if err == nil {
+			for _, line := range strings.Split(output, "\n") {
+				if serial := strings.TrimSpace(line); serial != "" {
+					serials = append(serials, serial)
+				}
+			}
+		}
+	}
+
+	if len(serials) == 0 {
+		return "", fmt.Errorf("no disk serial numbers found")
+	}
+	return strings.Join(serials, ","), nil
+}
+
+// containerIDPattern Docker/containerd/Podman 的64位容器ID
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// ContainerIDSource 当前容器的ID（仅 Linux）
+// 容器内的硬件信息通常与宿主机相同，加入容器ID可区分同一宿主机上的不同容器
+// 不在容器中时返回错误，Composite 随之无法生成硬件ID，只应在确定运行于容器中时使用
+type ContainerIDSource struct{}
+
+func (ContainerIDSource) Name() string { return ComponentContainerID }
+
+func (ContainerIDSource) Value() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("container ID not supported on %s", runtime.GOOS)
+	}
+
+	// cgroup v1 的路径包含容器ID；cgroup v2 下只能从挂载信息中找到（如 /var/lib/docker/containers/<id>/hostname）
+	if data, err := os.ReadFile("/proc/self/cgroup"); err == nil {
+		if id := containerIDPattern.FindString(string(data)); id != "" {
+			return id, nil
+		}
+	}
+
+	if data, err := os.ReadFile("/proc/self/mountinfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.Contains(line, "/containers/") {
+				continue
+			}
+			if id := containerIDPattern.FindString(line); id != "" {
+				return id, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("not running in a container")
+}
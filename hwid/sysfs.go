@@ -0,0 +1,156 @@
+package hwid
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Linux sysfs 读取，均不需要 root 权限（DMI 序列号和 UUID 除外）
+
+// readDMI 读取 /sys/class/dmi/id 下的字段，忽略厂商未填写的占位值
+func readDMI(field string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dmiDir, field))
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if dmiPlaceholders[strings.ToLower(value)] {
+		return "", absentf("DMI field %s is not set", field)
+	}
+	return value, nil
+}
+
+// linuxRootDiskSerial 返回根文件系统所在物理磁盘的序列号以及读取位置
+// 分区解析到所属磁盘，LVM / LUKS / RAID 设备解析到底层的第一块磁盘
+func linuxRootDiskSerial() (string, string, error) {
+	device, err := rootBlockDevice()
+	if err != nil {
+		return "", "/proc/self/mountinfo", err
+	}
+
+	disk, err := physicalDisk(device, 0)
+	if err != nil {
+		return "", device, err
+	}
+
+	// NVMe 和 virtio 直接提供 serial；SATA/SCSI 通常只有 wwid
+	for _, path := range []string{
+		filepath.Join(disk, "device", "serial"),
+		filepath.Join(disk, "serial"),
+		filepath.Join(disk, "wwid"),
+		filepath.Join(disk, "device", "wwid"),
+	} {
+		if data, err := os.ReadFile(path); err == nil {
+			if serial := strings.TrimSpace(string(data)); serial != "" {
+				return serial, path, nil
+			}
+		}
+	}
+	return "", disk, absentf("no serial number for disk %s", filepath.Base(disk))
+}
+
+// rootBlockDevice 从挂载信息中找到根文件系统的块设备目录（/sys/dev/block/主:次 或 /sys/class/block/名称）
+func rootBlockDevice() (string, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+
+	// 根目录可能被多次挂载（如 initramfs），最后一条生效
+	var devID, source string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[4] != "/" {
+			continue
+		}
+		devID = fields[2]
+		for i, field := range fields {
+			if field == "-" && i+2 < len(fields) {
+				source = fields[i+2]
+				break
+			}
+		}
+	}
+
+	if devID == "" {
+		return "", fmt.Errorf("root filesystem not found in mountinfo")
+	}
+
+	// btrfs 等文件系统报告虚拟设备号（主设备号为0），此时按挂载源 /dev/xxx 查找
+	if !strings.HasPrefix(devID, "0:") {
+		return filepath.EvalSymlinks(filepath.Join("/sys/dev/block", devID))
+	}
+	if !strings.HasPrefix(source, "/dev/") {
+		return "", absentf("root filesystem is not on a block device (%s)", source)
+	}
+
+	resolved, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(filepath.Join("/sys/class/block", filepath.Base(resolved)))
+}
+
+// physicalDisk 将分区和 device-mapper / md 设备解析为物理磁盘目录
+func physicalDisk(device string, depth int) (string, error) {
+	if depth > 4 {
+		return "", fmt.Errorf("block device nesting too deep at %s", device)
+	}
+
+	// 分区目录位于所属磁盘目录之下
+	if _, err := os.Stat(filepath.Join(device, "partition")); err == nil {
+		device = filepath.Dir(device)
+	}
+
+	slaves, _ := filepath.Glob(filepath.Join(device, "slaves", "*"))
+	if len(slaves) == 0 {
+		return device, nil
+	}
+
+	sort.Strings(slaves)
+	slave, err := filepath.EvalSymlinks(slaves[0])
+	if err != nil {
+		return "", err
+	}
+	return physicalDisk(slave, depth+1)
+}
+
+// linuxPermanentMACs 返回物理网卡的出厂 MAC 地址（排序后拼接）
+// 只取有硬件设备的网卡（排除网桥、veth、VPN 等），并跳过随机或手动设置的地址
+func linuxPermanentMACs() (string, error) {
+	interfaces, err := filepath.Glob("/sys/class/net/*")
+	if err != nil {
+		return "", err
+	}
+
+	var addrs []string
+	for _, iface := range interfaces {
+		if _, err := os.Stat(filepath.Join(iface, "device")); err != nil {
+			continue
+		}
+
+		// addr_assign_type: 0 出厂地址，1 随机，2 继承，3 手动设置
+		assignType, err := os.ReadFile(filepath.Join(iface, "addr_assign_type"))
+		if err != nil || strings.TrimSpace(string(assignType)) != "0" {
+			continue
+		}
+
+		address, err := os.ReadFile(filepath.Join(iface, "address"))
+		if err != nil {
+			continue
+		}
+		if addr := strings.ToLower(strings.TrimSpace(string(address))); addr != "" && addr != "00:00:00:00:00:00" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return "", absentf("no physical network interfaces with a permanent address")
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ","), nil
+}
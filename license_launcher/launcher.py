@@ -12,6 +12,10 @@ import uuid
 import platform
 import time
 import json
+import hashlib
+import hmac
+import secrets
+from urllib.parse import urlparse
 
 # 尝试导入 requests
 try:
@@ -24,6 +28,30 @@ except ImportError:
     print("  python3 -m pip install requests")
     sys.exit(1)
 
+
+def post_signed(url, payload, secret, timeout=10, headers=None):
+    """发送带时间戳、随机数和 HMAC-SHA256 签名的 POST 请求
+
+    签名内容为 "METHOD\\nPATH\\nTIMESTAMP\\nNONCE\\nSHA256(BODY)"；
+    激活请求使用许可证密钥作为 secret，之后的请求使用激活响应中的 request_secret
+    """
+    body = json.dumps(payload).encode() if payload is not None else b''
+    timestamp = str(int(time.time()))
+    nonce = secrets.token_hex(16)
+    message = "\n".join([
+        "POST", urlparse(url).path, timestamp, nonce, hashlib.sha256(body).hexdigest()
+    ])
+    signature = hmac.new(secret.encode(), message.encode(), hashlib.sha256).hexdigest()
+
+    signed_headers = dict(headers or {})
+    signed_headers.update({
+        "Content-Type": "application/json",
+        "X-Timestamp": timestamp,
+        "X-Nonce": nonce,
+        "X-Signature": signature,
+    })
+    return requests.post(url, data=body, headers=signed_headers, timeout=timeout)
+
 # 全局配置
 CONFIG = {
     'server_url': 'http://106.14.255.49:8080',
@@ -98,9 +126,10 @@ class LicenseManager:
     def verify_license(self, license_key):
         """验证许可证"""
         try:
-            response = requests.post(
+            response = post_signed(
                 f"{self.server_url}/api/activate",
-                json={"key": license_key, "hwid": self.hwid},
+                {"key": license_key, "hwid": self.hwid},
+                license_key,
                 timeout=10
             )
 
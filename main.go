@@ -2,7 +2,11 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -12,8 +16,12 @@ import (
 	"github.com/Lazywords2006/web/auth"
 	"github.com/Lazywords2006/web/heartbeat"
 	"github.com/Lazywords2006/web/hwid"
+	"github.com/Lazywords2006/web/store"
 )
 
+// insecure 编译时通过 make build INSECURE=1 设置为 "true"，不验证服务器签名，仅用于连接本地测试服务器
+var insecure = ""
+
 // Config 应用程序配置
 type Config struct {
 	ServerURL     string `json:"server_url"`
@@ -21,14 +29,33 @@ type Config struct {
 	HeartbeatSec  int    `json:"heartbeat_interval_seconds"`
 	MaxRetries    int    `json:"max_retries"`
 	RetryDelaySec int    `json:"retry_delay_seconds"`
+	GraceMinutes  int    `json:"offline_grace_minutes"`  // 网络故障时允许继续运行的时长
+	LicenseFile   string `json:"license_file,omitempty"` // 离线许可证文件路径，设置后不连接服务器
+	ProductName   string `json:"product_name,omitempty"` // 设置后没有许可证密钥时可开始试用（服务器需为该产品配置 trial_days）
+
+	// 硬件ID来源，为空时使用平台默认来源；可选 machine_id、cpu、disk、mac、container_id、dmi:<字段>
+	HWIDSources []string `json:"hwid_sources,omitempty"`
+	HWIDSalt    string   `json:"hwid_salt,omitempty"` // 产品盐值，修改后所有设备的硬件ID都会变化
+
+	// TLS 设置（server_url 为 https 时生效）
+	TLSPins       []string `json:"tls_pins,omitempty"`        // 服务器公钥指纹，应包含备用指纹
+	TLSMinVersion string   `json:"tls_min_version,omitempty"` // "1.2"（默认）或 "1.3"
+	TLSCAFile     string   `json:"tls_ca_file,omitempty"`     // 自定义根证书 PEM
+	TLSClientCert string   `json:"tls_client_cert,omitempty"` // 双向 TLS 客户端证书
+	TLSClientKey  string   `json:"tls_client_key,omitempty"`  // 双向 TLS 客户端私钥
 }
 
 const (
-	configFile = "config.json"
-	appVersion = "1.0.0"
+	configFile         = "config.json"
+	appVersion         = "1.0.0"
+	offlineRequestFile = "offline_request.json"
+	sessionFile        = "session.dat"
 )
 
 func main() {
+	hwidReport := flag.Bool("hwid-report", false, "print which hardware ID sources were used and exit")
+	flag.Parse()
+
 	log.Printf("=== Secure Always-Online Client v%s ===\n", appVersion)
 
 	// 1. 加载配置
@@ -39,43 +66,257 @@ func main() {
 
 	// 2. 生成硬件ID
 	log.Println("[HWID] Generating hardware identifier...")
-	hwID, err := hwid.GetHardwareID()
+	generator, err := hwid.NewGenerator(config.HWIDSources, config.HWIDSalt)
+	if err != nil {
+		log.Fatalf("Invalid hardware ID config: %v", err)
+	}
+	if *hwidReport {
+		printHWIDReport(generator)
+		return
+	}
+	hwID, err := generator.GetHWID()
 	if err != nil {
 		log.Fatalf("Failed to get hardware ID: %v", err)
 	}
 	log.Printf("[HWID] Generated: %s\n", hwID[:16]+"...") // 只显示前16位
 
-	// 3. 获取许可证密钥（从配置或用户输入）
+	// 结构化指纹用于硬件部分更换后仍识别为同一台设备，获取失败时只按 HWID 激活
+	fingerprint, err := generator.GetFingerprint()
+	if err != nil {
+		log.Printf("[HWID] Fingerprint unavailable: %v", err)
+	}
+
+	// 默认来源的硬件ID算法在 Linux 上有过变化，激活时附带旧ID以迁移原设备绑定
+	var previousHWID string
+	if len(config.HWIDSources) == 0 && config.HWIDSalt == "" {
+		if previous := hwid.PreviousHardwareID(); previous != hwID {
+			previousHWID = previous
+		}
+	}
+
+	// 检测虚拟机和容器，激活时上报，由服务器按产品策略决定是否允许
+	env := hwid.DetectEnvironment()
+	if env.Virtualized() {
+		log.Printf("[HWID] Running in %s (%s)", env.Type, strings.Join(env.Signals, ", "))
+	}
+
+	// 离线模式：验证许可证文件后直接运行，不启动心跳
+	if config.LicenseFile != "" {
+		runOffline(config, hwID)
+		return
+	}
+
+	// 3. 读取加密保存的会话（密钥由 HWID 派生，复制到其他机器无法使用）
+	sessionStore := store.New(sessionFile, hwID)
+	saved, err := sessionStore.Load()
+	if err != nil && !errors.Is(err, store.ErrNoSession) {
+		log.Printf("[Session] Discarding saved session: %v", err)
+		sessionStore.Clear()
+	}
+
+	// 4. 获取许可证密钥（配置、已保存的会话或用户输入）
+	// 配置中不填写 license_key 时只会加密保存在会话文件中；配置了 product_name 时留空可开始试用
 	licenseKey := config.LicenseKey
+	if licenseKey == "" && saved != nil {
+		licenseKey = saved.LicenseKey
+	}
 	if licenseKey == "" {
-		licenseKey = promptLicenseKey()
+		if config.ProductName != "" {
+			licenseKey = promptLicenseKeyOrTrial()
+		} else {
+			licenseKey = promptLicenseKey()
+		}
 	}
 
-	// 4. 创建认证客户端
-	authClient := auth.NewClient(config.ServerURL)
+	// 正在试用时记录试用密钥，激活购买的许可证时结束试用
+	var trialKey string
+	if saved != nil && saved.Trial {
+		trialKey = saved.LicenseKey
+	}
+	trial := trialKey != "" && trialKey == licenseKey
 
-	// 5. 激活许可证
-	log.Println("[Auth] Activating license...")
-	if err := authClient.Activate(licenseKey, hwID); err != nil {
-		log.Fatalf("License activation failed: %v", err)
+	// 5. 创建认证客户端（重试由心跳监控负责），令牌变化时保存会话
+	saveSession := func(session auth.Session) {
+		err := sessionStore.Update(func(s *store.Session) {
+			s.LicenseKey = licenseKey
+			s.Trial = trial
+			s.Token = session.Token
+			s.RefreshToken = session.RefreshToken
+			s.RequestSecret = session.RequestSecret
+		})
+		if err != nil {
+			log.Printf("[Session] Failed to save session: %v", err)
+		}
+	}
+	opts := []auth.Option{
+		auth.WithLogger(log.Default()),
+		auth.WithFingerprint(fingerprint),
+		auth.WithPreviousHWID(previousHWID),
+		auth.WithEnvironment(auth.Environment{Type: string(env.Type), Vendor: env.Vendor, Signals: env.Signals}),
+		auth.WithOnSessionChange(saveSession),
+	}
+	if insecure == "true" {
+		log.Println("[Auth] WARNING: Insecure build, token and server response signatures will not be verified")
+		opts = append(opts, auth.WithInsecureSkipVerify())
+	}
+	tlsOpts, err := tlsOptions(config)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	opts = append(opts, auth.WithTLS(tlsOpts))
+	authClient, err := auth.New(config.ServerURL, opts...)
+	if errors.Is(err, auth.ErrNoPublicKey) {
+		log.Fatalf("[Auth] Cannot create client: %v (build with make build PUBLIC_KEY=<server public key>)", err)
+	}
+	if err != nil {
+		log.Fatalf("[Auth] Cannot create client: %v", err)
+	}
+
+	// 6. 恢复会话，无法恢复时重新激活许可证（或开始试用）
+	resumed, online := resumeSession(authClient, saved, licenseKey)
+	if !resumed {
+		sessionStore.Clear()
+
+		licenseKey, trial = activateLicense(authClient, config.ProductName, hwID, licenseKey, trialKey)
+		saveSession(authClient.Session()) // 试用密钥在请求成功后才知道，重新保存
+		log.Printf("[Auth] Token received: %s...\n", authClient.GetToken()[:20])
+		online = true
 	}
-	log.Println("[Auth] ✓ License activated successfully")
-	log.Printf("[Auth] Token received: %s...\n", authClient.GetToken()[:20])
 
-	// 6. 启动心跳监控
+	// 7. 启动心跳监控
 	log.Println("[Heartbeat] Starting background monitor...")
 	hbConfig := &heartbeat.Config{
-		Interval:   time.Duration(config.HeartbeatSec) * time.Second,
-		MaxRetries: config.MaxRetries,
-		RetryDelay: time.Duration(config.RetryDelaySec) * time.Second,
+		Interval:    time.Duration(config.HeartbeatSec) * time.Second,
+		MaxRetries:  config.MaxRetries,
+		RetryDelay:  time.Duration(config.RetryDelaySec) * time.Second,
+		GracePeriod: time.Duration(config.GraceMinutes) * time.Minute,
+		StateStore:  sessionStore, // 加密保存，防止修改时间延长宽限期
 		ErrorCallback: func(err error) {
 			log.Printf("[Heartbeat] Critical error callback: %v", err)
 		},
+		// 许可证失效时先保存用户数据再退出
+		Enforcer: &heartbeat.ExitEnforcer{
+			Hooks:   []heartbeat.CleanupHook{saveUserWork},
+			Timeout: 5 * time.Second,
+		},
 	}
 	monitor := heartbeat.NewMonitor(authClient, hbConfig)
+	if online {
+		monitor.RecordSuccess() // 刚完成在线激活或心跳
+	}
 	monitor.Start()
 
-	// 7. 运行主业务逻辑
+	// 8. 按许可证的授权内容开关功能，令牌刷新后自动反映管理员的修改
+	if authClient.HasFeature("premium") {
+		log.Println("[App] Premium features enabled")
+	}
+	if maxProjects, ok := authClient.Limit("max_projects"); ok {
+		log.Printf("[App] Project limit: %d", maxProjects)
+	}
+
+	// 9. 运行主业务逻辑
+	log.Println("\n[App] All security checks passed. Starting main application...")
+	log.Println("[App] ========================================")
+	RunMainApp()
+}
+
+// resumeSession 使用保存的会话代替重新激活
+// 服务器拒绝会话时返回 resumed=false，需要重新激活；
+// 服务器暂时无法连接或繁忙时仍然恢复会话（online=false），由心跳监控按离线宽限期处理
+func resumeSession(client *auth.Client, saved *store.Session, licenseKey string) (resumed, online bool) {
+	if saved == nil || saved.LicenseKey != licenseKey || saved.RefreshToken == "" {
+		return false, false
+	}
+
+	client.Resume(auth.Session{
+		Token:         saved.Token,
+		RefreshToken:  saved.RefreshToken,
+		RequestSecret: saved.RequestSecret,
+	})
+
+	var serverErr *auth.ServerError
+	err := client.Heartbeat()
+	switch {
+	case err == nil:
+		log.Println("[Session] ✓ Resumed saved session")
+		return true, true
+	case heartbeat.IsRevoked(err),
+		errors.As(err, &serverErr) && !errors.Is(err, auth.ErrServer) && !errors.Is(err, auth.ErrRateLimited):
+		log.Printf("[Session] Saved session rejected (%v), re-activating", err)
+		client.Resume(auth.Session{})
+		return false, false
+	default:
+		log.Printf("[Session] Server unreachable (%v), resuming saved session offline", err)
+		return true, false
+	}
+}
+
+// activateLicense 激活许可证，返回会话对应的许可证密钥以及是否为试用
+// licenseKey 为空或为当前试用密钥时开始（或恢复）试用，试用已结束时提示输入购买的许可证；
+// 正在试用的设备激活购买的许可证时同时结束试用
+func activateLicense(client *auth.Client, productName, hwID, licenseKey, trialKey string) (string, bool) {
+	if licenseKey == "" || licenseKey == trialKey {
+		log.Println("[Auth] Starting trial...")
+		trial, err := client.StartTrial(productName, hwID)
+		if err == nil {
+			log.Printf("[Auth] ✓ Trial active until %s", trial.TrialExpires.Format("2006-01-02"))
+			return trial.LicenseKey, true
+		}
+		if !errors.Is(err, auth.ErrTrialUsed) {
+			log.Printf("Trial failed: %v", err)
+			log.Fatalf("[Auth] %s", activationFailureHint(err))
+		}
+
+		log.Println("[Auth] The trial on this device has ended")
+		licenseKey = promptLicenseKey()
+	}
+
+	var err error
+	if trialKey != "" {
+		log.Println("[Auth] Upgrading trial to purchased license...")
+		err = client.Upgrade(trialKey, licenseKey, hwID)
+	} else {
+		log.Println("[Auth] Activating license...")
+		err = client.Activate(licenseKey, hwID)
+	}
+	if err != nil {
+		log.Printf("License activation failed: %v", err)
+		log.Fatalf("[Auth] %s", activationFailureHint(err))
+	}
+	log.Println("[Auth] ✓ License activated successfully")
+	return licenseKey, false
+}
+
+// runOffline 离线模式
+// 许可证文件存在时在本地验证并运行；不存在时生成离线激活请求文件后退出
+func runOffline(config *Config, hwID string) {
+	authClient, err := auth.New(config.ServerURL)
+	if err != nil {
+		log.Fatalf("Offline mode requires an embedded public key: %v", err)
+	}
+
+	if _, err := os.Stat(config.LicenseFile); os.IsNotExist(err) {
+		licenseKey := config.LicenseKey
+		if licenseKey == "" {
+			licenseKey = promptLicenseKey()
+		}
+
+		if err := auth.WriteOfflineRequest(offlineRequestFile, licenseKey, hwID); err != nil {
+			log.Fatalf("Failed to create offline request: %v", err)
+		}
+		log.Printf("[Offline] License file %s not found", config.LicenseFile)
+		log.Printf("[Offline] Request written to %s, send it to your vendor and save the returned license as %s",
+			offlineRequestFile, config.LicenseFile)
+		return
+	}
+
+	claims, err := authClient.LoadLicenseFile(config.LicenseFile, hwID)
+	if err != nil {
+		log.Fatalf("Offline license verification failed: %v", err)
+	}
+	log.Printf("[Offline] ✓ License %s verified (product: %s, expires: %s)",
+		claims.LicenseKey, claims.Product, claims.Expiry().Format("2006-01-02"))
+
 	log.Println("\n[App] All security checks passed. Starting main application...")
 	log.Println("[App] ========================================")
 	RunMainApp()
@@ -89,6 +330,7 @@ func loadConfig() (*Config, error) {
 		HeartbeatSec:  30,
 		MaxRetries:    3,
 		RetryDelaySec: 2,
+		GraceMinutes:  30,
 	}
 
 	// 尝试读取配置文件
@@ -121,15 +363,100 @@ func loadConfig() (*Config, error) {
 	if config.RetryDelaySec == 0 {
 		config.RetryDelaySec = defaultConfig.RetryDelaySec
 	}
+	if config.GraceMinutes == 0 {
+		config.GraceMinutes = defaultConfig.GraceMinutes
+	}
 
 	log.Printf("[Config] Loaded from %s", configFile)
 	log.Printf("[Config] Server: %s", config.ServerURL)
-	log.Printf("[Config] Heartbeat: %ds | Retries: %d | Delay: %ds",
-		config.HeartbeatSec, config.MaxRetries, config.RetryDelaySec)
+	log.Printf("[Config] Heartbeat: %ds | Retries: %d | Delay: %ds | Offline grace: %dm",
+		config.HeartbeatSec, config.MaxRetries, config.RetryDelaySec, config.GraceMinutes)
 
 	return &config, nil
 }
 
+// printHWIDReport 输出各硬件ID来源的采集结果（只包含哈希），供技术支持排查硬件ID变化
+func printHWIDReport(generator hwid.Generator) {
+	reporter, ok := generator.(hwid.Reporter)
+	if !ok {
+		log.Fatalf("Hardware ID generator does not support reports")
+	}
+
+	reports, err := reporter.Report()
+	if err != nil {
+		log.Fatalf("Failed to get hardware ID: %v", err)
+	}
+
+	// 来源读取失败时仍输出报告，便于找出失败的来源
+	result := map[string]interface{}{"sources": reports}
+	if hwID, err := generator.GetHWID(); err != nil {
+		result["error"] = err.Error()
+	} else {
+		result["hwid"] = hwID
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(data))
+}
+
+// tlsOptions 根据配置文件生成证书固定、根证书和客户端证书设置
+func tlsOptions(config *Config) (auth.TLSOptions, error) {
+	opts := auth.TLSOptions{Pins: config.TLSPins}
+
+	switch config.TLSMinVersion {
+	case "", "1.2":
+		opts.MinVersion = tls.VersionTLS12
+	case "1.3":
+		opts.MinVersion = tls.VersionTLS13
+	default:
+		return opts, fmt.Errorf("unsupported tls_min_version: %q", config.TLSMinVersion)
+	}
+
+	if config.TLSCAFile != "" {
+		pool, err := auth.LoadCertPool(config.TLSCAFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.RootCAs = pool
+	}
+
+	if config.TLSClientCert != "" || config.TLSClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSClientCert, config.TLSClientKey)
+		if err != nil {
+			return opts, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		opts.ClientCertificate = &cert
+	}
+
+	if len(opts.Pins) == 0 && strings.HasPrefix(config.ServerURL, "https://") {
+		log.Println("[Auth] WARNING: No tls_pins configured, server certificate is not pinned")
+	}
+
+	return opts, nil
+}
+
+// activationFailureHint 根据失败原因给出提示
+func activationFailureHint(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrNotFound):
+		return "The license key is invalid, please check it and try again"
+	case errors.Is(err, auth.ErrBanned):
+		return "This license has been banned, please contact your vendor"
+	case errors.Is(err, auth.ErrExpired):
+		return "This license has expired, please renew it"
+	case errors.Is(err, auth.ErrDeviceLimit):
+		return "All device slots are in use, deactivate another device first"
+	case errors.Is(err, auth.ErrTrialUnavailable):
+		return "No trial is available for this product, please enter a license key"
+	case errors.Is(err, auth.ErrRequestStale):
+		return "Your system clock is wrong, please correct it and try again"
+	case errors.Is(err, auth.ErrRateLimited), errors.Is(err, auth.ErrServer):
+		return "The license server is busy, please try again later"
+	default:
+		return "Please check your network connection and try again"
+	}
+}
+
 // promptLicenseKey 提示用户输入许可证密钥
 func promptLicenseKey() string {
 	reader := bufio.NewReader(os.Stdin)
@@ -150,6 +477,18 @@ func promptLicenseKey() string {
 	}
 }
 
+// promptLicenseKeyOrTrial 提示用户输入许可证密钥，直接回车表示开始试用（返回空字符串）
+func promptLicenseKeyOrTrial() string {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("Enter your license key (or press Enter to start a free trial): ")
+	key, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+	return strings.TrimSpace(key)
+}
+
 // RunMainApp 主业务逻辑占位符
 // 这里是您实际应用程序的入口点
 // 在生产环境中，将此函数替换为您的业务代码
@@ -177,6 +516,13 @@ func RunMainApp() {
 	}
 }
 
+// saveUserWork 许可证失效退出前的清理占位符
+// 在生产环境中替换为保存文档、刷新缓存等操作，需在 ctx 取消前返回
+func saveUserWork(ctx context.Context) error {
+	log.Println("[App] Saving user work before exit...")
+	return nil
+}
+
 // performBusinessLogic 执行业务逻辑示例
 func performBusinessLogic(iteration int) {
 	// 这里放置您的实际业务代码
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/Lazywords2006/web/server/utils"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -42,6 +43,7 @@ func createTables() error {
 		password TEXT NOT NULL,
 		name TEXT NOT NULL,
 		is_admin BOOLEAN DEFAULT 0,
+		must_change_password BOOLEAN DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -56,6 +58,7 @@ func createTables() error {
 		duration INTEGER NOT NULL,
 		max_devices INTEGER DEFAULT 1,
 		is_active BOOLEAN DEFAULT 1,
+		entitlements TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -77,6 +80,10 @@ func createTables() error {
 		order_id TEXT,
 		last_heartbeat DATETIME,
 		note TEXT,
+		max_transfers INTEGER DEFAULT 3,
+		transfer_cooldown_hours INTEGER DEFAULT 24,
+		license_type TEXT DEFAULT 'node_locked',
+		entitlements TEXT,
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);
 
@@ -109,6 +116,97 @@ func createTables() error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- 许可证设备表（每个许可证最多 max_devices 台设备）
+	-- 浮动许可证的设备记录即席位租约，lease_expires_at 之后不再有效
+	CREATE TABLE IF NOT EXISTS license_devices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		license_key TEXT NOT NULL,
+		hwid TEXT NOT NULL,
+		first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		request_secret TEXT,
+		fingerprint TEXT,
+		environment TEXT,
+		environment_vendor TEXT,
+		flagged BOOLEAN DEFAULT 0,
+		lease_expires_at DATETIME,
+		rebound_at DATETIME,
+		UNIQUE (license_key, hwid),
+		FOREIGN KEY (license_key) REFERENCES licenses(license_key)
+	);
+
+	-- 刷新令牌表（只保存令牌的SHA256哈希，同一令牌族的轮换记录共享 family_id）
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash TEXT PRIMARY KEY,
+		family_id TEXT NOT NULL,
+		license_key TEXT NOT NULL,
+		hwid TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		revoked INTEGER DEFAULT 0
+	);
+
+	-- 令牌吊销表（按 jti 吊销单个令牌，或按许可证/设备吊销 revoked_before 之前签发的令牌，revoked_before 为 Unix 毫秒）
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		jti TEXT,
+		license_key TEXT,
+		hwid TEXT,
+		revoked_before INTEGER,
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL
+	);
+
+	-- 请求签名随机数（防重放，超过时间窗口后清理）
+	CREATE TABLE IF NOT EXISTS request_nonces (
+		nonce TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL
+	);
+
+	-- 管理员会话表（只保存令牌的SHA256哈希）
+	CREATE TABLE IF NOT EXISTS admin_sessions (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	-- 产品策略（按 licenses.product_name 匹配，未配置的产品使用默认值）
+	-- vm_policy 为空时使用默认虚拟化策略；trial_days 为0时不提供试用
+	CREATE TABLE IF NOT EXISTS product_policies (
+		product_name TEXT PRIMARY KEY,
+		vm_policy TEXT NOT NULL,
+		trial_days INTEGER DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- 试用记录（每台设备每个产品一次，重装系统后按硬件指纹识别）
+	CREATE TABLE IF NOT EXISTS trials (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_name TEXT NOT NULL,
+		hwid TEXT NOT NULL,
+		fingerprint TEXT,
+		license_key TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		upgraded_to TEXT,
+		upgraded_at DATETIME,
+		UNIQUE (product_name, hwid)
+	);
+
+	-- 令牌签名密钥环
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		kid TEXT PRIMARY KEY,
+		private_key TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
 	-- 创建索引
 	CREATE INDEX IF NOT EXISTS idx_licenses_key ON licenses(license_key);
 	CREATE INDEX IF NOT EXISTS idx_licenses_hwid ON licenses(hwid);
@@ -117,6 +215,13 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
 	CREATE INDEX IF NOT EXISTS idx_logs_license ON activation_logs(license_key);
 	CREATE INDEX IF NOT EXISTS idx_logs_action ON activation_logs(action);
+	CREATE INDEX IF NOT EXISTS idx_devices_license ON license_devices(license_key);
+	CREATE INDEX IF NOT EXISTS idx_sessions_expires ON admin_sessions(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_refresh_family ON refresh_tokens(family_id);
+	CREATE INDEX IF NOT EXISTS idx_refresh_device ON refresh_tokens(license_key, hwid);
+	CREATE INDEX IF NOT EXISTS idx_revoked_jti ON revoked_tokens(jti);
+	CREATE INDEX IF NOT EXISTS idx_revoked_license ON revoked_tokens(license_key);
+	CREATE INDEX IF NOT EXISTS idx_trials_license ON trials(license_key);
 	`
 
 	_, err := DB.Exec(schema)
@@ -124,6 +229,20 @@ func createTables() error {
 		return fmt.Errorf("failed to execute schema: %w", err)
 	}
 
+	// 为旧版数据库补充新增列
+	if err := migrateColumns(); err != nil {
+		return fmt.Errorf("failed to migrate columns: %w", err)
+	}
+
+	// 迁移旧版单设备绑定到设备表
+	migrateLicenseDevices()
+
+	// 将旧版明文密码迁移为哈希
+	migratePlaintextPasswords()
+
+	// 吊销时间点改为毫秒精度
+	migrateRevocationPrecision()
+
 	// 插入默认管理员账户（仅在不存在时）
 	createDefaultAdmin()
 
@@ -133,6 +252,109 @@ func createTables() error {
 	return nil
 }
 
+// migrateColumns 为已存在的表补充新版本增加的列
+// CREATE TABLE IF NOT EXISTS 不会修改旧表结构，因此需要单独检查
+func migrateColumns() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"licenses", "max_transfers", "INTEGER DEFAULT 3"},
+		{"licenses", "transfer_cooldown_hours", "INTEGER DEFAULT 24"},
+		{"users", "must_change_password", "BOOLEAN DEFAULT 0"},
+		{"license_devices", "request_secret", "TEXT"},
+		{"license_devices", "fingerprint", "TEXT"},
+		{"license_devices", "environment", "TEXT"},
+		{"license_devices", "environment_vendor", "TEXT"},
+		{"license_devices", "flagged", "BOOLEAN DEFAULT 0"},
+		{"licenses", "license_type", "TEXT DEFAULT 'node_locked'"},
+		{"license_devices", "lease_expires_at", "DATETIME"},
+		{"product_policies", "trial_days", "INTEGER DEFAULT 0"},
+		{"products", "entitlements", "TEXT"},
+		{"licenses", "entitlements", "TEXT"},
+		{"license_devices", "rebound_at", "DATETIME"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing 当列不存在时执行 ALTER TABLE ADD COLUMN
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read table info for %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info for %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	log.Printf("[DB] Added column %s.%s", table, column)
+	return nil
+}
+
+// migrateLicenseDevices 将 licenses.hwid 中已有的绑定迁移到 license_devices
+// 可重复执行，已存在的记录会被忽略
+func migrateLicenseDevices() {
+	result, err := DB.Exec(`
+		INSERT OR IGNORE INTO license_devices (license_key, hwid, first_seen, last_seen)
+		SELECT license_key, hwid,
+		       COALESCE(activated_at, CURRENT_TIMESTAMP),
+		       COALESCE(last_heartbeat, activated_at, CURRENT_TIMESTAMP)
+		FROM licenses
+		WHERE hwid IS NOT NULL AND hwid != ''
+	`)
+	if err != nil {
+		log.Printf("[DB] Warning: Failed to migrate license devices: %v", err)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("[DB] Migrated %d device bindings to license_devices", n)
+	}
+}
+
+// migrateRevocationPrecision 将旧版以秒记录的 revoked_before 转换为毫秒
+// 旧记录吊销该秒内（含）签发的令牌，转换为该秒的最后一毫秒以保持原有语义；可重复执行
+func migrateRevocationPrecision() {
+	result, err := DB.Exec(`
+		UPDATE revoked_tokens SET revoked_before = revoked_before * 1000 + 999
+		WHERE revoked_before IS NOT NULL AND revoked_before < 100000000000
+	`)
+	if err != nil {
+		log.Printf("[DB] Warning: Failed to migrate revocations: %v", err)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("[DB] Migrated %d revocations to millisecond precision", n)
+	}
+}
+
+// defaultAdminPassword 默认管理员初始密码，首次登录后必须修改
+const defaultAdminPassword = "admin123"
+
 // createDefaultAdmin 创建默认管理员
 func createDefaultAdmin() {
 	var count int
@@ -141,15 +363,67 @@ func createDefaultAdmin() {
 		return
 	}
 
-	// 密码: admin123 (实际应该使用bcrypt加密)
+	hash, err := utils.HashPassword(defaultAdminPassword)
+	if err != nil {
+		log.Printf("[DB] Warning: Failed to hash default admin password: %v", err)
+		return
+	}
+
 	_, err = DB.Exec(`
-		INSERT INTO users (email, password, name, is_admin)
-		VALUES ('admin@example.com', 'admin123', 'Admin', 1)
-	`)
+		INSERT INTO users (email, password, name, is_admin, must_change_password)
+		VALUES ('admin@example.com', ?, 'Admin', 1, 1)
+	`, hash)
 	if err != nil {
 		log.Printf("[DB] Warning: Failed to create default admin: %v", err)
 	} else {
-		log.Println("[DB] Default admin created: admin@example.com / admin123")
+		log.Printf("[DB] Default admin created: admin@example.com / %s (must be changed on first login)", defaultAdminPassword)
+	}
+}
+
+// migratePlaintextPasswords 将旧版本保存的明文密码转换为 bcrypt 哈希
+// 已是哈希的记录会被跳过，因此可重复执行；仍使用默认密码的账户会被要求修改密码
+func migratePlaintextPasswords() {
+	rows, err := DB.Query("SELECT id, password FROM users")
+	if err != nil {
+		log.Printf("[DB] Warning: Failed to query users for password migration: %v", err)
+		return
+	}
+
+	type plaintextUser struct {
+		id       int64
+		password string
+	}
+
+	var pending []plaintextUser
+	for rows.Next() {
+		var u plaintextUser
+		if err := rows.Scan(&u.id, &u.password); err != nil {
+			continue
+		}
+		if !utils.IsPasswordHash(u.password) {
+			pending = append(pending, u)
+		}
+	}
+	rows.Close()
+
+	for _, u := range pending {
+		hash, err := utils.HashPassword(u.password)
+		if err != nil {
+			log.Printf("[DB] Warning: Failed to hash password for user %d: %v", u.id, err)
+			continue
+		}
+
+		_, err = DB.Exec(`
+			UPDATE users SET password = ?, must_change_password = (must_change_password OR ?), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, hash, u.password == defaultAdminPassword, u.id)
+		if err != nil {
+			log.Printf("[DB] Warning: Failed to migrate password for user %d: %v", u.id, err)
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Printf("[DB] Migrated %d plaintext passwords to bcrypt", len(pending))
 	}
 }
 
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+func TestMigratePlaintextPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// 旧版数据库：users 表没有 must_change_password 列，密码以明文保存
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = old.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			email TEXT UNIQUE NOT NULL,
+			password TEXT NOT NULL,
+			name TEXT NOT NULL,
+			is_admin BOOLEAN DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO users (email, password, name, is_admin) VALUES
+			('admin@example.com', 'admin123', 'Admin', 1),
+			('ops@example.com', 'ops-password', 'Ops', 1);
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	if err := InitDB(path); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { Close() })
+
+	tests := []struct {
+		email              string
+		password           string
+		mustChangePassword bool
+	}{
+		{"admin@example.com", "admin123", true}, // 仍使用默认密码，首次登录必须修改
+		{"ops@example.com", "ops-password", false},
+	}
+	hashes := map[string]string{}
+	for _, tt := range tests {
+		var stored string
+		var mustChange bool
+		if err := DB.QueryRow(`SELECT password, must_change_password FROM users WHERE email = ?`, tt.email).Scan(&stored, &mustChange); err != nil {
+			t.Fatalf("query %s: %v", tt.email, err)
+		}
+		if !utils.IsPasswordHash(stored) || !utils.CheckPassword(stored, tt.password) {
+			t.Fatalf("%s: password not migrated to a matching hash: %q", tt.email, stored)
+		}
+		if mustChange != tt.mustChangePassword {
+			t.Fatalf("%s: must_change_password = %v, want %v", tt.email, mustChange, tt.mustChangePassword)
+		}
+		hashes[tt.email] = stored
+	}
+
+	// 已有管理员时不再创建默认管理员
+	var admins int
+	DB.QueryRow(`SELECT COUNT(*) FROM users WHERE is_admin = 1`).Scan(&admins)
+	if admins != 2 {
+		t.Fatalf("admins = %d, want 2", admins)
+	}
+
+	// 迁移可重复执行，已是哈希的记录不变
+	migratePlaintextPasswords()
+	for email, hash := range hashes {
+		var stored string
+		DB.QueryRow(`SELECT password FROM users WHERE email = ?`, email).Scan(&stored)
+		if stored != hash {
+			t.Fatalf("%s: hash changed on second migration", email)
+		}
+	}
+}
+
+func TestDefaultAdminMustChangePassword(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { Close() })
+
+	var stored string
+	var mustChange bool
+	if err := DB.QueryRow(`SELECT password, must_change_password FROM users WHERE email = 'admin@example.com'`).Scan(&stored, &mustChange); err != nil {
+		t.Fatalf("query default admin: %v", err)
+	}
+	if !utils.CheckPassword(stored, defaultAdminPassword) || !mustChange {
+		t.Fatalf("default admin: hashed=%v must_change_password=%v", utils.IsPasswordHash(stored), mustChange)
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// KeyStore 基于数据库的签名密钥存储，实现 utils.KeyStore
+type KeyStore struct{}
+
+// LoadSigningKeys 读取所有签名密钥
+func (KeyStore) LoadSigningKeys() ([]*utils.SigningKey, error) {
+	rows, err := DB.Query(`
+		SELECT kid, private_key, status, created_at, updated_at
+		FROM signing_keys ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*utils.SigningKey{}
+	for rows.Next() {
+		var key utils.SigningKey
+		var privateKeyPEM string
+		if err := rows.Scan(&key.KID, &privateKeyPEM, &key.Status, &key.CreatedAt, &key.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		key.PrivateKey, err = utils.ParsePrivateKey([]byte(privateKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", key.KID, err)
+		}
+
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// SaveSigningKeys 在同一事务中新增或更新签名密钥，任一失败时全部回滚
+func (KeyStore) SaveSigningKeys(keys ...*utils.SigningKey) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, key := range keys {
+		privateKeyPEM, err := utils.EncodePrivateKey(key.PrivateKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO signing_keys (kid, private_key, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(kid) DO UPDATE SET status = excluded.status, updated_at = excluded.updated_at
+		`, key.KID, string(privateKeyPEM), key.Status, key.CreatedAt, key.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save signing key %s: %w", key.KID, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/mattn/go-sqlite3 v1.14.19
+	golang.org/x/crypto v0.18.0
 )
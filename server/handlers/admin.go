@@ -19,14 +19,19 @@ func HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: 添加管理员认证中间件
-
 	var req struct {
 		Key          string `json:"key"`           // 许可证密钥
 		MaxDevices   int    `json:"max_devices"`   // 最大设备数
 		ValidityDays int    `json:"validity_days"` // 有效期天数
 		Note         string `json:"note"`          // 备注
 		ProductName  string `json:"product_name"`  // 产品名称(可选)
+
+		MaxTransfers          *int `json:"max_transfers"`           // 允许自助转移次数(可选)
+		TransferCooldownHours *int `json:"transfer_cooldown_hours"` // 转移冷却时间(可选)
+
+		LicenseType string `json:"license_type"` // node_locked(默认) 或 floating，floating 时 max_devices 为同时在线席位数
+
+		Entitlements *utils.Entitlements `json:"entitlements"` // 覆盖产品的功能和限制(可选)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -52,11 +57,31 @@ func HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		req.ProductName = "Default Product"
 	}
 
+	maxTransfers, cooldownHours, ok := transferPolicy(req.MaxTransfers, req.TransferCooldownHours)
+	if !ok {
+		respondError(w, "max_transfers and transfer_cooldown_hours must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if req.LicenseType == "" {
+		req.LicenseType = utils.LicenseNodeLocked
+	}
+	if !utils.ValidLicenseType(req.LicenseType) {
+		respondError(w, "license_type must be node_locked or floating", http.StatusBadRequest)
+		return
+	}
+
+	entitlements, err := encodeEntitlementOverrides(req.Entitlements)
+	if err != nil {
+		respondError(w, "Invalid entitlements: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 插入数据库 (不设置 expires_at,等激活时再计算)
-	_, err := database.DB.Exec(`
-		INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days, note)
-		VALUES (?, ?, 'unused', ?, ?, ?)
-	`, req.Key, req.ProductName, req.MaxDevices, req.ValidityDays, req.Note)
+	_, err = database.DB.Exec(`
+		INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days, note, max_transfers, transfer_cooldown_hours, license_type, entitlements)
+		VALUES (?, ?, 'unused', ?, ?, ?, ?, ?, ?, ?)
+	`, req.Key, req.ProductName, req.MaxDevices, req.ValidityDays, req.Note, maxTransfers, cooldownHours, req.LicenseType, entitlements)
 
 	if err != nil {
 		log.Printf("[Admin] Failed to insert license: %v", err)
@@ -64,7 +89,7 @@ func HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[Admin] Generated license: %s (validity: %d days)", req.Key, req.ValidityDays)
+	log.Printf("[Admin] Generated %s license: %s (validity: %d days)", req.LicenseType, req.Key, req.ValidityDays)
 
 	respondJSON(w, map[string]interface{}{
 		"license_key":   req.Key,
@@ -73,6 +98,11 @@ func HandleGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		"max_devices":   req.MaxDevices,
 		"note":          req.Note,
 		"status":        "unused",
+		"license_type":  req.LicenseType,
+		"entitlements":  req.Entitlements,
+
+		"max_transfers":           maxTransfers,
+		"transfer_cooldown_hours": cooldownHours,
 	}, http.StatusOK)
 }
 
@@ -90,6 +120,13 @@ func HandleBatchGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		ValidityDays int    `json:"validity_days"` // 有效期天数
 		Note         string `json:"note"`          // 备注
 		ProductName  string `json:"product_name"`  // 产品名称
+
+		MaxTransfers          *int `json:"max_transfers"`           // 允许自助转移次数(可选)
+		TransferCooldownHours *int `json:"transfer_cooldown_hours"` // 转移冷却时间(可选)
+
+		LicenseType string `json:"license_type"` // node_locked(默认) 或 floating，floating 时 max_devices 为同时在线席位数
+
+		Entitlements *utils.Entitlements `json:"entitlements"` // 覆盖产品的功能和限制(可选)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -119,6 +156,26 @@ func HandleBatchGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		req.Prefix = "LICENSE"
 	}
 
+	maxTransfers, cooldownHours, ok := transferPolicy(req.MaxTransfers, req.TransferCooldownHours)
+	if !ok {
+		respondError(w, "max_transfers and transfer_cooldown_hours must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if req.LicenseType == "" {
+		req.LicenseType = utils.LicenseNodeLocked
+	}
+	if !utils.ValidLicenseType(req.LicenseType) {
+		respondError(w, "license_type must be node_locked or floating", http.StatusBadRequest)
+		return
+	}
+
+	entitlements, err := encodeEntitlementOverrides(req.Entitlements)
+	if err != nil {
+		respondError(w, "Invalid entitlements: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 生成许可证
 	generated := []map[string]interface{}{}
 	failed := 0
@@ -138,9 +195,9 @@ func HandleBatchGenerateLicense(w http.ResponseWriter, r *http.Request) {
 
 		// 插入数据库
 		_, err = database.DB.Exec(`
-			INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days, note)
-			VALUES (?, ?, 'unused', ?, ?, ?)
-		`, key, req.ProductName, req.MaxDevices, req.ValidityDays, req.Note)
+			INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days, note, max_transfers, transfer_cooldown_hours, license_type, entitlements)
+			VALUES (?, ?, 'unused', ?, ?, ?, ?, ?, ?, ?)
+		`, key, req.ProductName, req.MaxDevices, req.ValidityDays, req.Note, maxTransfers, cooldownHours, req.LicenseType, entitlements)
 
 		if err != nil {
 			log.Printf("[Admin] Failed to insert batch license: %v", err)
@@ -162,6 +219,7 @@ func HandleBatchGenerateLicense(w http.ResponseWriter, r *http.Request) {
 		"licenses":      generated,
 		"max_devices":   req.MaxDevices,
 		"validity_days": req.ValidityDays,
+		"license_type":  req.LicenseType,
 	}, http.StatusOK)
 }
 
@@ -172,13 +230,11 @@ func HandleListLicenses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: 添加管理员认证
-
 	// 查询参数
 	status := r.URL.Query().Get("status")
 	userID := r.URL.Query().Get("user_id")
 
-	query := "SELECT id, license_key, product_name, hwid, status, max_devices, validity_days, expires_at, activated_at, created_at, updated_at, user_id, last_heartbeat, note FROM licenses WHERE 1=1"
+	query := "SELECT id, license_key, product_name, hwid, status, max_devices, validity_days, expires_at, activated_at, created_at, updated_at, user_id, last_heartbeat, note, COALESCE(license_type, 'node_locked') FROM licenses WHERE 1=1"
 	args := []interface{}{}
 
 	if status != "" {
@@ -204,7 +260,7 @@ func HandleListLicenses(w http.ResponseWriter, r *http.Request) {
 	licenses := []map[string]interface{}{}
 	for rows.Next() {
 		var id int
-		var licenseKey, productName, status string
+		var licenseKey, productName, status, licenseType string
 		var maxDevices, validityDays int
 		var hwid, note, lastHeartbeat sql.NullString
 		var expiresAt, activatedAt, createdAt, updatedAt sql.NullTime
@@ -214,7 +270,7 @@ func HandleListLicenses(w http.ResponseWriter, r *http.Request) {
 			&id, &licenseKey, &productName,
 			&hwid, &status, &maxDevices, &validityDays,
 			&expiresAt, &activatedAt, &createdAt, &updatedAt,
-			&userID, &lastHeartbeat, &note,
+			&userID, &lastHeartbeat, &note, &licenseType,
 		)
 
 		if err != nil {
@@ -223,10 +279,7 @@ func HandleListLicenses(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// 计算已激活设备数
-		activatedDevices := 0
-		if status == "active" && hwid.Valid && hwid.String != "" {
-			activatedDevices = 1
-		}
+		activatedDevices, _ := countDevices(licenseKey)
 
 		// 构建许可证对象
 		license := map[string]interface{}{
@@ -238,6 +291,7 @@ func HandleListLicenses(w http.ResponseWriter, r *http.Request) {
 			"max_devices":       maxDevices,
 			"validity_days":     validityDays,
 			"activated_devices": activatedDevices,
+			"license_type":      licenseType,
 		}
 
 		if hwid.Valid {
@@ -296,13 +350,15 @@ func HandleGetLicense(w http.ResponseWriter, r *http.Request) {
 
 	err := database.DB.QueryRow(`
 		SELECT id, license_key, product_name, hwid, status, max_devices,
-		       expires_at, activated_at, created_at, updated_at, user_id, order_id, last_heartbeat
+		       expires_at, activated_at, created_at, updated_at, user_id, order_id, last_heartbeat,
+		       max_transfers, transfer_cooldown_hours, COALESCE(license_type, 'node_locked')
 		FROM licenses WHERE license_key = ?
 	`, licenseKey).Scan(
 		&license.ID, &license.LicenseKey, &license.ProductName,
 		&hwid, &license.Status, &license.MaxDevices,
 		&license.ExpiresAt, &activatedAt, &license.CreatedAt, &license.UpdatedAt,
 		&license.UserID, &orderID, &lastHeartbeat,
+		&license.MaxTransfers, &license.TransferCooldownHours, &license.LicenseType,
 	)
 
 	if err == sql.ErrNoRows {
@@ -329,12 +385,22 @@ func HandleGetLicense(w http.ResponseWriter, r *http.Request) {
 		license.LastHeartbeat = lastHeartbeat.Time
 	}
 
-	// 获取激活日志
+	// 获取激活日志和绑定设备
 	logs, _ := getActivationLogs(licenseKey)
+	devices, _ := getLicenseDevices(licenseKey)
+
+	// 生效的授权内容（产品默认值加许可证覆盖）和许可证自身的覆盖项
+	entitlements, _ := licenseEntitlements(licenseKey)
+	var overrideValue string
+	database.DB.QueryRow("SELECT COALESCE(entitlements, '') FROM licenses WHERE license_key = ?", licenseKey).Scan(&overrideValue)
+	overrides, _ := utils.ParseEntitlements(overrideValue)
 
 	respondJSON(w, map[string]interface{}{
-		"license": license,
-		"logs":    logs,
+		"license":               license,
+		"devices":               devices,
+		"logs":                  logs,
+		"entitlements":          entitlements,
+		"entitlement_overrides": overrides,
 	}, http.StatusOK)
 }
 
@@ -346,11 +412,19 @@ func HandleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		LicenseKey string    `json:"license_key"`
-		Key        string    `json:"key"` // 兼容前端使用的 key 字段
-		Status     string    `json:"status,omitempty"`
-		ExpiryDate string    `json:"expiry_date,omitempty"`
-		MaxDevices int       `json:"max_devices,omitempty"`
+		LicenseKey string `json:"license_key"`
+		Key        string `json:"key"` // 兼容前端使用的 key 字段
+		Status     string `json:"status,omitempty"`
+		ExpiryDate string `json:"expiry_date,omitempty"`
+		MaxDevices int    `json:"max_devices,omitempty"`
+
+		MaxTransfers          *int `json:"max_transfers,omitempty"`
+		TransferCooldownHours *int `json:"transfer_cooldown_hours,omitempty"`
+
+		LicenseType string `json:"license_type,omitempty"`
+
+		// 整体替换许可证对产品功能和限制的覆盖，{} 清除覆盖
+		Entitlements *utils.Entitlements `json:"entitlements,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -400,6 +474,43 @@ func HandleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 		args = append(args, req.MaxDevices)
 	}
 
+	if req.MaxTransfers != nil {
+		if *req.MaxTransfers < 0 {
+			respondError(w, "max_transfers must not be negative", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "max_transfers = ?")
+		args = append(args, *req.MaxTransfers)
+	}
+
+	if req.TransferCooldownHours != nil {
+		if *req.TransferCooldownHours < 0 {
+			respondError(w, "transfer_cooldown_hours must not be negative", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "transfer_cooldown_hours = ?")
+		args = append(args, *req.TransferCooldownHours)
+	}
+
+	if req.LicenseType != "" {
+		if !utils.ValidLicenseType(req.LicenseType) {
+			respondError(w, "license_type must be node_locked or floating", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "license_type = ?")
+		args = append(args, req.LicenseType)
+	}
+
+	if req.Entitlements != nil {
+		entitlements, err := encodeEntitlementOverrides(req.Entitlements)
+		if err != nil {
+			respondError(w, "Invalid entitlements: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "entitlements = ?")
+		args = append(args, entitlements)
+	}
+
 	if len(updates) == 0 {
 		respondError(w, "No fields to update", http.StatusBadRequest)
 		return
@@ -427,6 +538,14 @@ func HandleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.LicenseType != "" {
+		if err := convertDeviceLeases(licenseKey, req.LicenseType); err != nil {
+			log.Printf("[Admin] Failed to convert devices of license %s: %v", licenseKey, err)
+			respondError(w, "Failed to update license", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	log.Printf("[Admin] Updated license %s", licenseKey)
 
 	respondJSON(w, map[string]string{
@@ -460,6 +579,9 @@ func HandleDeleteLicense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	database.DB.Exec("DELETE FROM license_devices WHERE license_key = ?", licenseKey)
+	database.DB.Exec("DELETE FROM refresh_tokens WHERE license_key = ?", licenseKey)
+
 	log.Printf("[Admin] Deleted license: %s", licenseKey)
 
 	respondJSON(w, map[string]string{
@@ -509,6 +631,18 @@ func HandleGetStats(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, stats, http.StatusOK)
 }
 
+// 辅助函数：解析转移策略，未指定时使用默认值（3次，24小时）
+func transferPolicy(maxTransfers, cooldownHours *int) (int, int, bool) {
+	transfers, cooldown := 3, 24
+	if maxTransfers != nil {
+		transfers = *maxTransfers
+	}
+	if cooldownHours != nil {
+		cooldown = *cooldownHours
+	}
+	return transfers, cooldown, transfers >= 0 && cooldown >= 0
+}
+
 // 辅助函数：获取激活日志
 func getActivationLogs(licenseKey string) ([]models.ActivationLog, error) {
 	rows, err := database.DB.Query(`
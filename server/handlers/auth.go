@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/models"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// adminSessionTTL 管理员会话有效期
+const adminSessionTTL = 24 * time.Hour
+
+type contextKey string
+
+const adminUserKey contextKey = "admin_user"
+
+// LoginRequest 管理员登录请求
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginResponse 管理员登录响应
+type LoginResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"`
+}
+
+// HandleAdminLogin 管理员登录
+// 使用 users 表中 is_admin = 1 的账户验证，成功后返回会话令牌
+func HandleAdminLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		respondError(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err := database.DB.QueryRow(`
+		SELECT id, email, password, name, is_admin, must_change_password, created_at, updated_at
+		FROM users WHERE email = ?
+	`, req.Email).Scan(
+		&user.ID, &user.Email, &user.Password, &user.Name,
+		&user.IsAdmin, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt,
+	)
+
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[Auth] Database error: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 用户不存在时与占位哈希比较，保证每次登录都执行一次 bcrypt，响应时间不暴露用户名是否存在
+	storedHash := user.Password
+	if err == sql.ErrNoRows {
+		storedHash = utils.DummyPasswordHash()
+	}
+	passwordOK := utils.CheckPassword(storedHash, req.Password)
+
+	// 用户不存在、密码错误或非管理员统一返回相同错误
+	if err == sql.ErrNoRows || !passwordOK || !user.IsAdmin {
+		log.Printf("[Auth] Login failed for %s from %s", req.Email, r.RemoteAddr)
+		respondError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	// 哈希参数变更后，使用本次登录的明文密码透明地重新计算
+	if utils.PasswordNeedsRehash(user.Password) {
+		if hash, err := utils.HashPassword(req.Password); err == nil {
+			database.DB.Exec("UPDATE users SET password = ? WHERE id = ?", hash, user.ID)
+			log.Printf("[Auth] Rehashed password for %s", user.Email)
+		}
+	}
+
+	token, err := utils.GenerateSessionToken()
+	if err != nil {
+		log.Printf("[Auth] Failed to generate session token: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(adminSessionTTL)
+
+	// 顺便清理过期会话
+	database.DB.Exec("DELETE FROM admin_sessions WHERE expires_at < ?", now)
+
+	_, err = database.DB.Exec(`
+		INSERT INTO admin_sessions (token_hash, user_id, ip_address, user_agent, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, utils.HashToken(token), user.ID, r.RemoteAddr, r.Header.Get("User-Agent"), now, expiresAt)
+	if err != nil {
+		log.Printf("[Auth] Failed to create session: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Auth] Admin %s logged in from %s", user.Email, r.RemoteAddr)
+
+	respondJSON(w, LoginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      &user,
+	}, http.StatusOK)
+}
+
+// HandleAdminLogout 管理员退出登录，使当前会话令牌失效
+func HandleAdminLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, _ := bearerToken(r)
+	database.DB.Exec("DELETE FROM admin_sessions WHERE token_hash = ?", utils.HashToken(token))
+
+	if user := AdminFromContext(r.Context()); user != nil {
+		log.Printf("[Auth] Admin %s logged out", user.Email)
+	}
+
+	respondJSON(w, map[string]string{
+		"message": "Logged out",
+	}, http.StatusOK)
+}
+
+// HandleAdminMe 返回当前登录的管理员信息
+func HandleAdminMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"user": AdminFromContext(r.Context()),
+	}, http.StatusOK)
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// minPasswordLength 管理员密码最小长度
+const minPasswordLength = 8
+
+// HandleChangePassword 修改当前管理员密码
+// 修改成功后清除强制改密标记，并使该账户的其他会话失效
+func HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := AdminFromContext(r.Context())
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.NewPassword) < minPasswordLength {
+		respondError(w, fmt.Sprintf("New password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	var stored string
+	if err := database.DB.QueryRow("SELECT password FROM users WHERE id = ?", user.ID).Scan(&stored); err != nil {
+		log.Printf("[Auth] Database error: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !utils.CheckPassword(stored, req.CurrentPassword) {
+		respondError(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		respondError(w, "New password must differ from the current password", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("[Auth] Failed to hash password: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE users SET password = ?, must_change_password = 0, updated_at = ? WHERE id = ?
+	`, hash, time.Now(), user.ID)
+	if err != nil {
+		log.Printf("[Auth] Failed to update password: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 保留当前会话，注销其他会话
+	token, _ := bearerToken(r)
+	database.DB.Exec(`
+		DELETE FROM admin_sessions WHERE user_id = ? AND token_hash != ?
+	`, user.ID, utils.HashToken(token))
+
+	log.Printf("[Auth] Admin %s changed password", user.Email)
+
+	respondJSON(w, map[string]string{
+		"message": "Password changed successfully",
+	}, http.StatusOK)
+}
+
+// RequireAdmin 管理员认证中间件
+// 要求请求携带 Authorization: Bearer <会话令牌>，并将管理员信息放入请求上下文
+// 需要修改密码的账户在改密前无法访问其他管理接口
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return requireAdmin(next, false)
+}
+
+// RequireAdminSession 仅校验会话有效，允许尚未修改初始密码的账户访问
+// 用于登出、查询当前用户和修改密码
+func RequireAdminSession(next http.HandlerFunc) http.HandlerFunc {
+	return requireAdmin(next, true)
+}
+
+func requireAdmin(next http.HandlerFunc, allowPasswordChange bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			respondError(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		var user models.User
+		err := database.DB.QueryRow(`
+			SELECT u.id, u.email, u.name, u.is_admin, u.must_change_password, u.created_at, u.updated_at
+			FROM admin_sessions s JOIN users u ON u.id = s.user_id
+			WHERE s.token_hash = ? AND s.expires_at > ?
+		`, utils.HashToken(token), time.Now()).Scan(
+			&user.ID, &user.Email, &user.Name,
+			&user.IsAdmin, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt,
+		)
+
+		if err == sql.ErrNoRows || (err == nil && !user.IsAdmin) {
+			respondError(w, "Session expired or invalid", http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			log.Printf("[Auth] Database error: %v", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if user.MustChangePassword && !allowPasswordChange {
+			respondError(w, "Password change required", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), adminUserKey, &user)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// AdminFromContext 获取 RequireAdmin 放入上下文的管理员信息
+func AdminFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(adminUserKey).(*models.User)
+	return user
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// createUser 创建用户，返回用户ID
+func createUser(t *testing.T, email, password string, isAdmin, mustChangePassword bool) int64 {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	result, err := database.DB.Exec(`
+		INSERT INTO users (email, password, name, is_admin, must_change_password) VALUES (?, ?, 'Test', ?, ?)
+	`, email, hash, isAdmin, mustChangePassword)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// login 调用登录接口，返回状态码、会话令牌和响应
+func login(t *testing.T, email, password string) (int, string, map[string]interface{}) {
+	t.Helper()
+	code, resp := callHandler(t, HandleAdminLogin, LoginRequest{Email: email, Password: password}, false)
+	token, _ := resp["token"].(string)
+	return code, token, resp
+}
+
+// callAdmin 携带会话令牌调用处理函数，返回状态码
+func callAdmin(t *testing.T, handler http.HandlerFunc, token string, body interface{}) int {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code
+}
+
+// whoami 返回 200 表示中间件放行并设置了管理员信息
+func whoami(w http.ResponseWriter, r *http.Request) {
+	if AdminFromContext(r.Context()) == nil {
+		respondError(w, "no admin in context", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+func TestAdminLogin(t *testing.T) {
+	setupTestDB(t)
+	createUser(t, "admin@test", "correct horse", true, false)
+	createUser(t, "user@test", "correct horse", false, false)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+	}{
+		{"valid credentials", "admin@test", "correct horse", http.StatusOK},
+		{"wrong password", "admin@test", "wrong", http.StatusUnauthorized},
+		{"unknown user", "nobody@test", "correct horse", http.StatusUnauthorized},
+		{"not an admin", "user@test", "correct horse", http.StatusUnauthorized},
+		{"missing password", "admin@test", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, token, resp := login(t, tt.email, tt.password)
+			if code != tt.wantCode {
+				t.Fatalf("login: %d %v, want %d", code, resp, tt.wantCode)
+			}
+			if code != http.StatusOK {
+				// 失败原因不区分用户不存在、密码错误和非管理员
+				if code == http.StatusUnauthorized && resp["error"] != "Invalid email or password" {
+					t.Fatalf("error = %v", resp["error"])
+				}
+				return
+			}
+
+			// 数据库只保存令牌哈希，响应不包含密码哈希
+			var count int
+			database.DB.QueryRow(`SELECT COUNT(*) FROM admin_sessions WHERE token_hash = ?`, utils.HashToken(token)).Scan(&count)
+			if count != 1 {
+				t.Fatal("session not stored by token hash")
+			}
+			if user, _ := resp["user"].(map[string]interface{}); user["password"] != nil {
+				t.Fatalf("login response exposes the password hash: %v", user)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	setupTestDB(t)
+	userID := createUser(t, "admin@test", "correct horse", true, false)
+	_, token, _ := login(t, "admin@test", "correct horse")
+	_, expired, _ := login(t, "admin@test", "correct horse")
+	execSQL(t, `UPDATE admin_sessions SET expires_at = ? WHERE token_hash = ?`, time.Now().Add(-time.Minute), utils.HashToken(expired))
+	_, demoted, _ := login(t, "admin@test", "correct horse")
+
+	tests := []struct {
+		name     string
+		token    string
+		setup    func(t *testing.T)
+		wantCode int
+	}{
+		{"valid session", token, nil, http.StatusOK},
+		{"no token", "", nil, http.StatusUnauthorized},
+		{"unknown token", "sess_invalid", nil, http.StatusUnauthorized},
+		{"expired session", expired, nil, http.StatusUnauthorized},
+		{
+			name:  "account no longer admin",
+			token: demoted,
+			setup: func(t *testing.T) {
+				execSQL(t, `UPDATE users SET is_admin = 0 WHERE id = ?`, userID)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup(t)
+				t.Cleanup(func() { execSQL(t, `UPDATE users SET is_admin = 1 WHERE id = ?`, userID) })
+			}
+			if code := callAdmin(t, RequireAdmin(whoami), tt.token, nil); code != tt.wantCode {
+				t.Fatalf("RequireAdmin: %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAdminLogout(t *testing.T) {
+	setupTestDB(t)
+	createUser(t, "admin@test", "correct horse", true, false)
+	_, token, _ := login(t, "admin@test", "correct horse")
+	_, other, _ := login(t, "admin@test", "correct horse")
+
+	if code := callAdmin(t, RequireAdminSession(HandleAdminLogout), token, nil); code != http.StatusOK {
+		t.Fatalf("logout: %d", code)
+	}
+	if code := callAdmin(t, RequireAdmin(whoami), token, nil); code != http.StatusUnauthorized {
+		t.Fatalf("request after logout: %d, want 401", code)
+	}
+
+	// 只注销当前会话
+	if code := callAdmin(t, RequireAdmin(whoami), other, nil); code != http.StatusOK {
+		t.Fatalf("other session after logout: %d, want 200", code)
+	}
+}
+
+func TestAdminMustChangePassword(t *testing.T) {
+	setupTestDB(t)
+	createUser(t, "new@test", "initial-password", true, true)
+	_, token, _ := login(t, "new@test", "initial-password")
+	_, other, _ := login(t, "new@test", "initial-password")
+
+	// 修改初始密码前只能访问登出、当前用户和修改密码接口
+	if code := callAdmin(t, RequireAdmin(whoami), token, nil); code != http.StatusForbidden {
+		t.Fatalf("admin route before password change: %d, want 403", code)
+	}
+	if code := callAdmin(t, RequireAdminSession(whoami), token, nil); code != http.StatusOK {
+		t.Fatalf("session route before password change: %d, want 200", code)
+	}
+
+	change := RequireAdminSession(HandleChangePassword)
+	tests := []struct {
+		name     string
+		req      ChangePasswordRequest
+		wantCode int
+	}{
+		{"wrong current password", ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new-password"}, http.StatusForbidden},
+		{"too short", ChangePasswordRequest{CurrentPassword: "initial-password", NewPassword: "short"}, http.StatusBadRequest},
+		{"unchanged", ChangePasswordRequest{CurrentPassword: "initial-password", NewPassword: "initial-password"}, http.StatusBadRequest},
+		{"valid", ChangePasswordRequest{CurrentPassword: "initial-password", NewPassword: "new-password"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := callAdmin(t, change, token, tt.req); code != tt.wantCode {
+			t.Fatalf("%s: %d, want %d", tt.name, code, tt.wantCode)
+		}
+	}
+
+	if code := callAdmin(t, RequireAdmin(whoami), token, nil); code != http.StatusOK {
+		t.Fatalf("admin route after password change: %d, want 200", code)
+	}
+	// 其他会话失效，旧密码不能再登录
+	if code := callAdmin(t, RequireAdminSession(whoami), other, nil); code != http.StatusUnauthorized {
+		t.Fatalf("other session after password change: %d, want 401", code)
+	}
+	if code, _, _ := login(t, "new@test", "initial-password"); code != http.StatusUnauthorized {
+		t.Fatalf("login with old password: %d, want 401", code)
+	}
+	if code, _, _ := login(t, "new@test", "new-password"); code != http.StatusOK {
+		t.Fatalf("login with new password: %d, want 200", code)
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	setupTestDB(t)
+	weak, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	execSQL(t, `INSERT INTO users (email, password, name, is_admin) VALUES ('admin@test', ?, 'Test', 1)`, string(weak))
+
+	if code, _, resp := login(t, "admin@test", "correct horse"); code != http.StatusOK {
+		t.Fatalf("login: %d %v", code, resp)
+	}
+
+	var stored string
+	database.DB.QueryRow(`SELECT password FROM users WHERE email = 'admin@test'`).Scan(&stored)
+	if cost, err := bcrypt.Cost([]byte(stored)); err != nil || cost != utils.PasswordCost {
+		t.Fatalf("stored hash cost = %d (%v), want %d", cost, err, utils.PasswordCost)
+	}
+	if !utils.CheckPassword(stored, "correct horse") {
+		t.Fatal("rehashed password does not match")
+	}
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/models"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// isDeviceRegistered 检查设备是否已绑定到许可证（浮动许可证的席位租约过期后视为未绑定）
+func isDeviceRegistered(licenseKey, hwid string) (bool, error) {
+	var id int64
+	err := database.DB.QueryRow(`
+		SELECT id FROM license_devices
+		WHERE license_key = ? AND hwid = ? AND (lease_expires_at IS NULL OR lease_expires_at > ?)
+	`, licenseKey, hwid, time.Now()).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// countDevices 统计许可证已绑定的设备数（浮动许可证为占用中的席位数）
+func countDevices(licenseKey string) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM license_devices
+		WHERE license_key = ? AND (lease_expires_at IS NULL OR lease_expires_at > ?)
+	`, licenseKey, time.Now()).Scan(&count)
+	return count, err
+}
+
+// registerDevice 在设备数未达上限时绑定新设备
+// 计数和插入在同一条语句中完成，避免并发激活超出 max_devices
+// 返回 false 表示设备槽位已满
+func registerDevice(licenseKey, hwid string, maxDevices int) (bool, error) {
+	now := time.Now()
+	result, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO license_devices (license_key, hwid, first_seen, last_seen)
+		SELECT ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM license_devices WHERE license_key = ?) < ?
+	`, licenseKey, hwid, now, now, licenseKey, maxDevices)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// touchDevice 更新设备最后在线时间
+func touchDevice(licenseKey, hwid string) error {
+	_, err := database.DB.Exec(`
+		UPDATE license_devices SET last_seen = ? WHERE license_key = ? AND hwid = ?
+	`, time.Now(), licenseKey, hwid)
+	return err
+}
+
+// saveDeviceFingerprint 保存设备最新的硬件指纹，硬件逐步变化时指纹随之更新
+func saveDeviceFingerprint(licenseKey, hwid string, fingerprint map[string]string) error {
+	if len(fingerprint) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE license_devices SET fingerprint = ? WHERE license_key = ? AND hwid = ?
+	`, string(data), licenseKey, hwid)
+	return err
+}
+
+// matchDeviceFingerprint 在许可证已绑定的设备中查找指纹匹配度最高且达到阈值的设备
+// 返回该设备的 HWID 和匹配度，没有匹配的设备时 HWID 为空
+func matchDeviceFingerprint(licenseKey string, fingerprint map[string]string) (string, float64, error) {
+	if len(fingerprint) == 0 {
+		return "", 0, nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT hwid, fingerprint FROM license_devices
+		WHERE license_key = ? AND fingerprint IS NOT NULL
+	`, licenseKey)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rows.Close()
+
+	var bestHWID string
+	var bestScore float64
+	for rows.Next() {
+		var hwid, data string
+		if err := rows.Scan(&hwid, &data); err != nil {
+			continue
+		}
+
+		var stored map[string]string
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			continue
+		}
+
+		if score, ok := utils.MatchFingerprint(stored, fingerprint); ok && score > bestScore {
+			bestHWID, bestScore = hwid, score
+		}
+	}
+
+	return bestHWID, bestScore, rows.Err()
+}
+
+// isDeviceMigratable 检查旧硬件ID的设备能否按 previous_hwid 迁移
+// 只有没有保存指纹（旧版客户端激活）且从未换绑过的设备可以迁移，迁移后 rebound_at 不再为空
+func isDeviceMigratable(licenseKey, hwid string) (bool, error) {
+	var id int64
+	err := database.DB.QueryRow(`
+		SELECT id FROM license_devices
+		WHERE license_key = ? AND hwid = ? AND fingerprint IS NULL AND rebound_at IS NULL
+		  AND lease_expires_at IS NULL
+	`, licenseKey, hwid).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rebindDevice 将已绑定设备的 HWID 更新为硬件变化后的新 HWID，不占用新的设备槽位
+// 旧 HWID 的刷新令牌随之删除；licenses.hwid 指向旧 HWID 时同步更新
+func rebindDevice(licenseKey, oldHWID, newHWID string, fingerprint map[string]string) error {
+	now := time.Now()
+	if _, err := database.DB.Exec(`
+		UPDATE license_devices SET hwid = ?, last_seen = ?, rebound_at = ?
+		WHERE license_key = ? AND hwid = ?
+	`, newHWID, now, now, licenseKey, oldHWID); err != nil {
+		return err
+	}
+
+	if err := saveDeviceFingerprint(licenseKey, newHWID, fingerprint); err != nil {
+		return err
+	}
+
+	if err := deleteDeviceRefreshTokens(licenseKey, oldHWID); err != nil {
+		return err
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE licenses SET hwid = ?, updated_at = ? WHERE license_key = ? AND hwid = ?
+	`, newHWID, now, licenseKey, oldHWID)
+	return err
+}
+
+// getLicenseDevices 获取许可证绑定的所有设备
+func getLicenseDevices(licenseKey string) ([]models.LicenseDevice, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, license_key, hwid, first_seen, last_seen,
+		       COALESCE(environment, ''), COALESCE(environment_vendor, ''), COALESCE(flagged, 0),
+		       lease_expires_at
+		FROM license_devices WHERE license_key = ?
+		ORDER BY first_seen ASC
+	`, licenseKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.LicenseDevice{}
+	for rows.Next() {
+		var device models.LicenseDevice
+		var leaseExpiresAt sql.NullTime
+		if err := rows.Scan(
+			&device.ID, &device.LicenseKey, &device.HWID,
+			&device.FirstSeen, &device.LastSeen,
+			&device.Environment, &device.EnvironmentVendor, &device.Flagged,
+			&leaseExpiresAt,
+		); err != nil {
+			continue
+		}
+		if leaseExpiresAt.Valid {
+			device.LeaseExpiresAt = &leaseExpiresAt.Time
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// releaseDevice 解除设备绑定并删除该设备的刷新令牌
+// 如果 licenses.hwid 指向被解绑的设备，则改为剩余设备中最早绑定的一台
+func releaseDevice(licenseKey, hwid string) error {
+	if _, err := database.DB.Exec(`
+		DELETE FROM license_devices WHERE license_key = ? AND hwid = ?
+	`, licenseKey, hwid); err != nil {
+		return err
+	}
+
+	if err := deleteDeviceRefreshTokens(licenseKey, hwid); err != nil {
+		return err
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE licenses
+		SET hwid = (
+			SELECT hwid FROM license_devices WHERE license_key = ?
+			ORDER BY first_seen ASC LIMIT 1
+		), updated_at = ?
+		WHERE license_key = ? AND hwid = ?
+	`, licenseKey, time.Now(), licenseKey, hwid)
+	return err
+}
+
+// transferHistory 返回许可证已成功转移的次数和最近一次转移时间
+// 解绑和激活时的换绑（指纹匹配、硬件ID迁移）都算作转移
+func transferHistory(licenseKey string) (int, time.Time, error) {
+	var count int
+	var lastUnix int64
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(MAX(CAST(strftime('%s', created_at) AS INTEGER)), 0)
+		FROM activation_logs
+		WHERE license_key = ? AND action IN ('deactivate', 'transfer') AND success = 1
+	`, licenseKey).Scan(&count, &lastUnix)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if lastUnix == 0 {
+		return count, time.Time{}, nil
+	}
+	return count, time.Unix(lastUnix, 0), nil
+}
+
+// transferDenial 转移被拒绝的原因
+type transferDenial struct {
+	code       string
+	reason     string // 写入 activation_logs
+	message    string // 返回给客户端
+	retryAfter time.Duration
+}
+
+// respond 返回拒绝转移的错误响应，冷却期内附带 Retry-After
+func (d *transferDenial) respond(w http.ResponseWriter) {
+	if d.code == CodeRateLimited {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(d.retryAfter.Seconds())))
+		respondErrorCode(w, d.code, d.message, http.StatusTooManyRequests)
+		return
+	}
+	respondErrorCode(w, d.code, d.message, http.StatusForbidden)
+}
+
+// checkTransfer 检查许可证的转移次数和冷却时间，返回已使用的转移次数
+// 试用许可证绑定领取试用的设备，不能转移；允许转移时 denial 为 nil
+func checkTransfer(licenseKey string, maxTransfers, cooldownHours int) (int, *transferDenial, error) {
+	trial, err := isTrialLicense(licenseKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	if trial {
+		return 0, &transferDenial{
+			code:    CodeTransferLimit,
+			reason:  "Trial license cannot be transferred",
+			message: "Trial licenses cannot be moved to another device",
+		}, nil
+	}
+
+	used, lastTransfer, err := transferHistory(licenseKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if used >= maxTransfers {
+		return used, &transferDenial{
+			code:    CodeTransferLimit,
+			reason:  "Transfer quota exhausted",
+			message: fmt.Sprintf("Transfer quota exhausted (%d/%d used)", used, maxTransfers),
+		}, nil
+	}
+
+	if !lastTransfer.IsZero() {
+		nextAllowed := lastTransfer.Add(time.Duration(cooldownHours) * time.Hour)
+		if time.Now().Before(nextAllowed) {
+			return used, &transferDenial{
+				code:       CodeRateLimited,
+				reason:     "Transfer cooldown active",
+				message:    fmt.Sprintf("Transfer cooldown active, retry after %s", nextAllowed.Format(time.RFC3339)),
+				retryAfter: time.Until(nextAllowed).Round(time.Second),
+			}, nil
+		}
+	}
+
+	return used, nil, nil
+}
+
+// deviceSession 激活成功后下发给设备的令牌和请求签名密钥
+type deviceSession struct {
+	Token         string
+	RefreshToken  string
+	RequestSecret string
+	AccessExpiry  time.Time
+}
+
+// ExpiresIn 访问令牌剩余秒数
+func (s *deviceSession) ExpiresIn() int64 {
+	return int64(time.Until(s.AccessExpiry).Seconds())
+}
+
+// issueDeviceSession 为设备签发短期访问令牌和刷新令牌，并轮换请求签名密钥
+// 访问令牌过期后客户端使用刷新令牌续期
+func issueDeviceSession(licenseKey, hwid string, licenseExpiry time.Time) (*deviceSession, error) {
+	session := &deviceSession{AccessExpiry: utils.AccessTokenExpiry(licenseExpiry)}
+
+	entitlements, err := licenseEntitlements(licenseKey)
+	if err != nil {
+		return nil, fmt.Errorf("load entitlements: %w", err)
+	}
+
+	session.Token, err = utils.GenerateJWT(licenseKey, hwid, entitlements, session.AccessExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+
+	cleanupRefreshTokens()
+	session.RefreshToken, err = issueRefreshToken(licenseKey, hwid, "", licenseExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("issue refresh token: %w", err)
+	}
+
+	session.RequestSecret, err = setRequestSecret(licenseKey, hwid)
+	if err != nil {
+		return nil, fmt.Errorf("issue request secret: %w", err)
+	}
+	return session, nil
+}
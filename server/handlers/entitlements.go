@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// licenseEntitlements 返回许可证生效的授权内容：产品的默认值加上许可证自身的覆盖
+// 许可证的 product_name 在 products 表中不存在时只使用许可证自身的设置
+func licenseEntitlements(licenseKey string) (utils.Entitlements, error) {
+	var productValue, licenseValue string
+	err := database.DB.QueryRow(`
+		SELECT COALESCE(p.entitlements, ''), COALESCE(l.entitlements, '')
+		FROM licenses l LEFT JOIN products p ON p.name = l.product_name
+		WHERE l.license_key = ?
+	`, licenseKey).Scan(&productValue, &licenseValue)
+	if err != nil {
+		return utils.Entitlements{}, err
+	}
+
+	product, err := utils.ParseEntitlements(productValue)
+	if err != nil {
+		return utils.Entitlements{}, err
+	}
+	override, err := utils.ParseEntitlements(licenseValue)
+	if err != nil {
+		return utils.Entitlements{}, err
+	}
+	return product.Merge(override), nil
+}
+
+// encodeEntitlementOverrides 校验并序列化管理员为单个许可证设置的覆盖项，nil 表示不覆盖
+func encodeEntitlementOverrides(overrides *utils.Entitlements) (string, error) {
+	if overrides == nil {
+		return "", nil
+	}
+	if err := overrides.Validate(); err != nil {
+		return "", err
+	}
+	return overrides.Encode()
+}
+
+// productEntitlements 管理界面中的产品授权内容
+type productEntitlements struct {
+	ProductName  string             `json:"product_name"`
+	Entitlements utils.Entitlements `json:"entitlements"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// HandleProductEntitlements 查看或设置产品的功能和数值限制（按 licenses.product_name 匹配 products.name）
+// GET 返回所有产品；PUT {product_name, entitlements} 整体替换，产品不存在时创建
+// 修改在设备下次获取令牌（激活或刷新）时生效
+func HandleProductEntitlements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := database.DB.Query(`
+			SELECT name, COALESCE(entitlements, ''), updated_at FROM products ORDER BY name
+		`)
+		if err != nil {
+			respondError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		products := []productEntitlements{}
+		for rows.Next() {
+			var p productEntitlements
+			var value string
+			if err := rows.Scan(&p.ProductName, &value, &p.UpdatedAt); err != nil {
+				continue
+			}
+			if p.Entitlements, err = utils.ParseEntitlements(value); err != nil {
+				log.Printf("[Admin] Product %q has %v", p.ProductName, err)
+			}
+			products = append(products, p)
+		}
+
+		respondJSON(w, map[string]interface{}{"products": products}, http.StatusOK)
+
+	case http.MethodPut:
+		var req struct {
+			ProductName  string             `json:"product_name"`
+			Entitlements utils.Entitlements `json:"entitlements"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductName == "" {
+			respondError(w, "product_name is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := req.Entitlements.Validate(); err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		value, err := req.Entitlements.Encode()
+		if err != nil {
+			respondError(w, "Invalid entitlements", http.StatusBadRequest)
+			return
+		}
+
+		// products 的价格和有效期为必填列，仅为授权内容创建的产品使用 0
+		now := time.Now()
+		_, err = database.DB.Exec(`
+			INSERT INTO products (name, price, duration, entitlements, updated_at)
+			VALUES (?, 0, 0, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET
+				entitlements = excluded.entitlements,
+				updated_at = excluded.updated_at
+		`, req.ProductName, value, now)
+		if err != nil {
+			log.Printf("[Admin] Failed to update entitlements of %q: %v", req.ProductName, err)
+			respondError(w, "Failed to update entitlements", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("[Admin] Entitlements for %q: features=%v, limits=%v",
+			req.ProductName, req.Entitlements.EnabledFeatures(), req.Entitlements.Limits)
+		respondJSON(w, map[string]interface{}{
+			"status": "success",
+			"product": productEntitlements{
+				ProductName:  req.ProductName,
+				Entitlements: req.Entitlements,
+				UpdatedAt:    now,
+			},
+		}, http.StatusOK)
+
+	default:
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
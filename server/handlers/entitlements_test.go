@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// tokenEntitlements 验证访问令牌并返回其中的功能和限制声明
+func tokenEntitlements(t *testing.T, token string) ([]interface{}, map[string]interface{}) {
+	t.Helper()
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	features, _ := (*claims)["features"].([]interface{})
+	limits, _ := (*claims)["limits"].(map[string]interface{})
+	return features, limits
+}
+
+// setProductEntitlements 通过管理接口设置产品的授权内容
+func setProductEntitlements(t *testing.T, productName string, e utils.Entitlements) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]interface{}{"product_name": productName, "entitlements": e})
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	HandleProductEntitlements(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set product entitlements: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLicenseEntitlementsInToken(t *testing.T) {
+	setupTestDB(t)
+
+	setProductEntitlements(t, "Test", utils.Entitlements{
+		Features: map[string]bool{"export": true, "sync": true},
+		Limits:   map[string]int64{"max_projects": 10},
+	})
+
+	tests := []struct {
+		name         string
+		product      string
+		override     string
+		wantFeatures []interface{}
+		wantLimits   map[string]interface{}
+	}{
+		{
+			name:         "product defaults",
+			product:      "Test",
+			wantFeatures: []interface{}{"export", "sync"},
+			wantLimits:   map[string]interface{}{"max_projects": float64(10)},
+		},
+		{
+			name:         "license override",
+			product:      "Test",
+			override:     `{"features":{"sync":false,"beta":true},"limits":{"max_projects":50}}`,
+			wantFeatures: []interface{}{"beta", "export"},
+			wantLimits:   map[string]interface{}{"max_projects": float64(50)},
+		},
+		{
+			name:         "product without entitlements",
+			product:      "Unknown",
+			override:     `{"features":{"beta":true}}`,
+			wantFeatures: []interface{}{"beta"},
+		},
+		{
+			name:    "nothing configured",
+			product: "Unknown",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := fmt.Sprintf("ENT-%d", i)
+			execSQL(t, `INSERT INTO licenses (license_key, product_name, entitlements) VALUES (?, ?, NULLIF(?, ''))`, key, tt.product, tt.override)
+
+			code, resp := activate(t, ActivateRequest{Key: key, HWID: "device-a"})
+			if code != http.StatusOK {
+				t.Fatalf("activate: %d %v", code, resp)
+			}
+			features, limits := tokenEntitlements(t, resp["token"].(string))
+			if !reflect.DeepEqual(features, tt.wantFeatures) || !reflect.DeepEqual(limits, tt.wantLimits) {
+				t.Fatalf("token features %v limits %v, want %v %v", features, limits, tt.wantFeatures, tt.wantLimits)
+			}
+		})
+	}
+
+	// 修改产品授权内容后，设备刷新令牌时生效
+	session := createActiveLicense(t, "ENT-REFRESH", "device-a")["device-a"]
+	setProductEntitlements(t, "Test", utils.Entitlements{Features: map[string]bool{"export": true}})
+	code, resp := refresh(t, session.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: %d %v", code, resp)
+	}
+	if features, limits := tokenEntitlements(t, resp["token"].(string)); !reflect.DeepEqual(features, []interface{}{"export"}) || limits != nil {
+		t.Fatalf("refreshed token features %v limits %v", features, limits)
+	}
+}
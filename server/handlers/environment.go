@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// 客户端上报的运行环境类型
+const (
+	envPhysical  = "physical"
+	envVM        = "vm"
+	envContainer = "container"
+	envUnknown   = "unknown" // 客户端未上报，仅由服务器记录
+)
+
+// 客户端运行环境的大小限制
+const (
+	maxEnvironmentSignals = 16
+	maxEnvironmentField   = 128
+)
+
+// ClientEnvironment 客户端检测到的运行环境（hwid.DetectEnvironment）
+// 分类完全由客户端给出，修改过的客户端可以谎报 physical 或干脆不上报，
+// 虚拟化策略只能拦住未经修改的客户端，不能替代设备数和转移次数限制
+type ClientEnvironment struct {
+	Type    string   `json:"type"`
+	Vendor  string   `json:"vendor,omitempty"`
+	Signals []string `json:"signals,omitempty"`
+}
+
+// virtualized 是否上报了运行在虚拟机或容器中
+func (e *ClientEnvironment) virtualized() bool {
+	return e != nil && (e.Type == envVM || e.Type == envContainer)
+}
+
+// String 日志中显示的环境描述，如 "vm (kvm: dmi:QEMU, cpu:hypervisor)"
+func (e *ClientEnvironment) String() string {
+	if e == nil {
+		return "unknown"
+	}
+	if len(e.Signals) == 0 {
+		return e.Type
+	}
+	return fmt.Sprintf("%s (%s: %s)", e.Type, e.Vendor, strings.Join(e.Signals, ", "))
+}
+
+// validateEnvironment 检查客户端上报的运行环境格式
+func validateEnvironment(env *ClientEnvironment) error {
+	if env == nil {
+		return nil
+	}
+
+	switch env.Type {
+	case envPhysical, envVM, envContainer:
+	default:
+		return fmt.Errorf("invalid environment type %q", env.Type)
+	}
+
+	if len(env.Vendor) > maxEnvironmentField || len(env.Signals) > maxEnvironmentSignals {
+		return fmt.Errorf("invalid environment")
+	}
+	for _, signal := range env.Signals {
+		if len(signal) > maxEnvironmentField {
+			return fmt.Errorf("invalid environment")
+		}
+	}
+	return nil
+}
+
+// productVMPolicy 返回产品的虚拟化策略，未配置时使用 VM_POLICY
+func productVMPolicy(productName string) (string, error) {
+	var policy string
+	err := database.DB.QueryRow(`
+		SELECT vm_policy FROM product_policies WHERE product_name = ?
+	`, productName).Scan(&policy)
+
+	if err == sql.ErrNoRows || (err == nil && policy == "") {
+		return utils.DefaultVMPolicy, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return policy, nil
+}
+
+// checkEnvironment 按产品的虚拟化策略判断是否拒绝激活、是否将设备标记为待审查
+// 未上报运行环境（旧版客户端或被修改的客户端）按未知处理：不拒绝，但在 flag 和 reject 策略下标记设备
+func checkEnvironment(productName string, env *ClientEnvironment) (reject, flag bool, err error) {
+	if env != nil && !env.virtualized() {
+		return false, false, nil
+	}
+
+	policy, err := productVMPolicy(productName)
+	if err != nil {
+		return false, false, err
+	}
+
+	switch policy {
+	case utils.VMPolicyReject:
+		return env != nil, true, nil
+	case utils.VMPolicyFlag:
+		return false, true, nil
+	}
+	return false, false, nil
+}
+
+// saveDeviceEnvironment 记录设备最近一次激活时上报的运行环境和审查标记
+// 未上报运行环境时只记录被标记的设备，环境记为 unknown
+func saveDeviceEnvironment(licenseKey, hwid string, env *ClientEnvironment, flagged bool) error {
+	if env == nil {
+		if !flagged {
+			return nil
+		}
+		env = &ClientEnvironment{Type: envUnknown}
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE license_devices SET environment = ?, environment_vendor = ?, flagged = ?
+		WHERE license_key = ? AND hwid = ?
+	`, env.Type, env.Vendor, flagged, licenseKey, hwid)
+	return err
+}
+
+// productPolicy 产品策略
+type productPolicy struct {
+	ProductName string    `json:"product_name"`
+	VMPolicy    string    `json:"vm_policy"`  // 为空表示使用默认策略
+	TrialDays   int       `json:"trial_days"` // 试用天数，0 表示不提供试用
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// HandleProductPolicies 列出（GET）或设置（PUT）产品策略
+// PUT {product_name, vm_policy?, trial_days?}，未提供的字段保持不变
+// vm_policy 为空时恢复使用默认策略，trial_days 为0时关闭试用
+func HandleProductPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rows, err := database.DB.Query(`
+			SELECT product_name, vm_policy, COALESCE(trial_days, 0), updated_at FROM product_policies ORDER BY product_name
+		`)
+		if err != nil {
+			respondError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		policies := []productPolicy{}
+		for rows.Next() {
+			var p productPolicy
+			if err := rows.Scan(&p.ProductName, &p.VMPolicy, &p.TrialDays, &p.UpdatedAt); err != nil {
+				continue
+			}
+			policies = append(policies, p)
+		}
+
+		respondJSON(w, map[string]interface{}{
+			"policies":          policies,
+			"default_vm_policy": utils.DefaultVMPolicy,
+		}, http.StatusOK)
+
+	case http.MethodPut:
+		var req struct {
+			ProductName string  `json:"product_name"`
+			VMPolicy    *string `json:"vm_policy"`
+			TrialDays   *int    `json:"trial_days"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductName == "" {
+			respondError(w, "product_name is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.VMPolicy == nil && req.TrialDays == nil {
+			respondError(w, "vm_policy or trial_days is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.VMPolicy != nil && *req.VMPolicy != "" && !utils.ValidVMPolicy(*req.VMPolicy) {
+			respondError(w, "vm_policy must be allow, flag or reject", http.StatusBadRequest)
+			return
+		}
+
+		if req.TrialDays != nil && (*req.TrialDays < 0 || *req.TrialDays > 365) {
+			respondError(w, "trial_days must be between 0 and 365", http.StatusBadRequest)
+			return
+		}
+
+		_, err := database.DB.Exec(`
+			INSERT INTO product_policies (product_name, vm_policy, trial_days, updated_at)
+			VALUES (?, COALESCE(?, ''), COALESCE(?, 0), ?)
+			ON CONFLICT(product_name) DO UPDATE SET
+				vm_policy = COALESCE(?, vm_policy),
+				trial_days = COALESCE(?, trial_days),
+				updated_at = excluded.updated_at
+		`, req.ProductName, req.VMPolicy, req.TrialDays, time.Now(), req.VMPolicy, req.TrialDays)
+		if err != nil {
+			respondError(w, "Failed to update policy", http.StatusInternalServerError)
+			return
+		}
+
+		var p productPolicy
+		if err := database.DB.QueryRow(`
+			SELECT product_name, vm_policy, COALESCE(trial_days, 0), updated_at FROM product_policies WHERE product_name = ?
+		`, req.ProductName).Scan(&p.ProductName, &p.VMPolicy, &p.TrialDays, &p.UpdatedAt); err != nil {
+			respondError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		vmPolicy := p.VMPolicy
+		if vmPolicy == "" {
+			vmPolicy = "default (" + utils.DefaultVMPolicy + ")"
+		}
+		log.Printf("[Admin] Policy for %q: vm_policy=%s, trial_days=%d", p.ProductName, vmPolicy, p.TrialDays)
+		respondJSON(w, map[string]interface{}{"status": "success", "policy": p}, http.StatusOK)
+
+	default:
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+func TestValidateEnvironment(t *testing.T) {
+	long := strings.Repeat("x", maxEnvironmentField+1)
+
+	tests := []struct {
+		name    string
+		env     *ClientEnvironment
+		wantErr bool
+	}{
+		{"not reported", nil, false},
+		{"physical", &ClientEnvironment{Type: envPhysical}, false},
+		{"vm", &ClientEnvironment{Type: envVM, Vendor: "kvm", Signals: []string{"dmi:QEMU", "cpu:hypervisor"}}, false},
+		{"container", &ClientEnvironment{Type: envContainer, Vendor: "docker"}, false},
+		{"empty type", &ClientEnvironment{}, true},
+		{"unknown is server-only", &ClientEnvironment{Type: envUnknown}, true},
+		{"unknown type", &ClientEnvironment{Type: "bare-metal"}, true},
+		{"long vendor", &ClientEnvironment{Type: envVM, Vendor: long}, true},
+		{"long signal", &ClientEnvironment{Type: envVM, Signals: []string{long}}, true},
+		{"too many signals", &ClientEnvironment{Type: envVM, Signals: make([]string, maxEnvironmentSignals+1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateEnvironment(tt.env); (err != nil) != tt.wantErr {
+				t.Fatalf("validateEnvironment: err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProductVMPolicyFallback(t *testing.T) {
+	setupTestDB(t)
+
+	defaultPolicy := utils.DefaultVMPolicy
+	utils.DefaultVMPolicy = utils.VMPolicyFlag
+	t.Cleanup(func() { utils.DefaultVMPolicy = defaultPolicy })
+
+	// 只设置试用天数的产品 vm_policy 为空，同样使用默认策略
+	execSQL(t, `INSERT INTO product_policies (product_name, vm_policy) VALUES ('Strict', 'reject')`)
+	execSQL(t, `INSERT INTO product_policies (product_name, vm_policy, trial_days) VALUES ('TrialOnly', '', 14)`)
+
+	tests := []struct {
+		product string
+		want    string
+	}{
+		{"Strict", utils.VMPolicyReject},
+		{"TrialOnly", utils.VMPolicyFlag},
+		{"Unconfigured", utils.VMPolicyFlag},
+	}
+	for _, tt := range tests {
+		policy, err := productVMPolicy(tt.product)
+		if err != nil || policy != tt.want {
+			t.Errorf("productVMPolicy(%s) = %q, %v; want %q", tt.product, policy, err, tt.want)
+		}
+	}
+}
+
+func TestCheckEnvironment(t *testing.T) {
+	vm := &ClientEnvironment{Type: envVM, Vendor: "kvm"}
+	container := &ClientEnvironment{Type: envContainer, Vendor: "docker"}
+	physical := &ClientEnvironment{Type: envPhysical}
+
+	tests := []struct {
+		name       string
+		policy     string
+		env        *ClientEnvironment
+		wantReject bool
+		wantFlag   bool
+	}{
+		{"allow vm", utils.VMPolicyAllow, vm, false, false},
+		{"allow not reported", utils.VMPolicyAllow, nil, false, false},
+		{"flag vm", utils.VMPolicyFlag, vm, false, true},
+		{"flag physical", utils.VMPolicyFlag, physical, false, false},
+		{"flag not reported", utils.VMPolicyFlag, nil, false, true},
+		{"reject vm", utils.VMPolicyReject, vm, true, true},
+		{"reject container", utils.VMPolicyReject, container, true, true},
+		{"reject physical", utils.VMPolicyReject, physical, false, false},
+		// 旧版客户端不上报运行环境，拒绝会导致它们全部无法激活，只标记待审查
+		{"reject not reported", utils.VMPolicyReject, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			execSQL(t, `INSERT INTO product_policies (product_name, vm_policy) VALUES ('Pro', ?)`, tt.policy)
+
+			reject, flag, err := checkEnvironment("Pro", tt.env)
+			if err != nil {
+				t.Fatalf("checkEnvironment: %v", err)
+			}
+			if reject != tt.wantReject || flag != tt.wantFlag {
+				t.Fatalf("reject=%v flag=%v, want reject=%v flag=%v", reject, flag, tt.wantReject, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestActivateWithoutEnvironmentIsFlagged(t *testing.T) {
+	setupTestDB(t)
+	execSQL(t, `INSERT INTO product_policies (product_name, vm_policy) VALUES ('Pro', 'reject')`)
+	execSQL(t, `INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days) VALUES ('ENV-1', 'Pro', 'unused', 2, 365)`)
+
+	if code, resp := activate(t, ActivateRequest{Key: "ENV-1", HWID: "hwid-1"}); code != http.StatusOK {
+		t.Fatalf("activate without environment: %d %v", code, resp)
+	}
+
+	var environment string
+	var flagged bool
+	if err := database.DB.QueryRow(`
+		SELECT environment, flagged FROM license_devices WHERE license_key = 'ENV-1' AND hwid = 'hwid-1'
+	`).Scan(&environment, &flagged); err != nil {
+		t.Fatalf("query device: %v", err)
+	}
+	if environment != envUnknown || !flagged {
+		t.Fatalf("environment=%q flagged=%v, want %q flagged", environment, flagged, envUnknown)
+	}
+}
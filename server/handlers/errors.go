@@ -0,0 +1,57 @@
+package handlers
+
+import "net/http"
+
+// 客户端 API 错误码
+// 错误响应体为 {"error": "说明", "code": "错误码"}，客户端按错误码区分失败原因，说明文字仅供阅读
+// 必须与客户端 auth 包中的错误码保持一致
+const (
+	CodeInvalidRequest = "invalid_request" // 请求格式错误或缺少参数
+	CodeNotFound       = "not_found"       // 许可证不存在
+	CodeBanned         = "banned"          // 许可证已封禁
+	CodeExpired        = "expired"         // 许可证已过期
+	CodeInactive       = "inactive"        // 许可证未处于可用状态
+	CodeHWIDMismatch   = "hwid_mismatch"   // 设备未绑定到该许可证（已解绑或从未激活）
+	CodeDeviceLimit    = "device_limit"    // 设备槽位已满
+	CodeTransferLimit  = "transfer_limit"  // 设备转移次数已用完
+	CodeRateLimited    = "rate_limited"    // 操作过于频繁（如转移冷却期内）
+	CodeTokenInvalid   = "token_invalid"   // 访问令牌缺失、无效或已过期
+	CodeTokenRevoked   = "token_revoked"   // 访问令牌已被吊销
+	CodeRefreshInvalid = "refresh_invalid" // 刷新令牌无效、过期或已作废
+	CodeRefreshReused  = "refresh_reused"  // 刷新令牌被重复使用，该设备的令牌族已全部吊销
+	CodeInternal       = "internal_error"  // 服务器内部错误，可稍后重试
+
+	// 请求签名
+	CodeSignatureMissing = "signature_missing" // 缺少签名头
+	CodeRequestStale     = "request_stale"     // 时间戳超出允许偏差
+	CodeRequestReplayed  = "request_replayed"  // 随机数已使用过
+	CodeSignatureInvalid = "signature_invalid" // 签名不匹配（请求被篡改或密钥错误）
+
+	// 运行环境
+	CodeVirtualizationDenied = "virtualization_denied" // 产品策略不允许在虚拟机或容器中激活
+
+	// 浮动许可证
+	CodeNoSeats      = "no_seats"      // 席位已全部被占用，响应附带 seats_in_use 和 max_seats
+	CodeLeaseExpired = "lease_expired" // 席位租约已过期（心跳中断），需重新激活借出席位
+
+	// 试用
+	CodeTrialUnavailable = "trial_unavailable" // 该产品不提供试用
+	CodeTrialUsed        = "trial_used"        // 该设备已试用过该产品（试用已过期或已升级）
+)
+
+// licenseStatusCode 将许可证状态映射为错误码
+func licenseStatusCode(status string) string {
+	switch status {
+	case "banned":
+		return CodeBanned
+	case "expired":
+		return CodeExpired
+	default:
+		return CodeInactive
+	}
+}
+
+// respondErrorCode 返回带错误码的错误响应，便于客户端区分失败原因
+func respondErrorCode(w http.ResponseWriter, code, message string, statusCode int) {
+	respondJSON(w, map[string]string{"error": message, "code": code}, statusCode)
+}
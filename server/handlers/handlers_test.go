@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/models"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// setupTestDB 为每个测试初始化独立的 SQLite 数据库和签名密钥
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	t.Setenv("SIGNING_KEY", base64.StdEncoding.EncodeToString(privateKey.Seed()))
+
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := utils.InitSigningKey(database.KeyStore{}); err != nil {
+		t.Fatalf("InitSigningKey: %v", err)
+	}
+}
+
+// createActiveLicense 创建已激活的许可证并绑定设备，返回设备会话
+func createActiveLicense(t *testing.T, licenseKey string, hwids ...string) map[string]*deviceSession {
+	t.Helper()
+
+	expiresAt := time.Now().AddDate(1, 0, 0)
+	_, err := database.DB.Exec(`
+		INSERT INTO licenses (license_key, product_name, status, max_devices, expires_at, activated_at)
+		VALUES (?, 'Test', 'active', ?, ?, ?)
+	`, licenseKey, len(hwids), expiresAt, time.Now())
+	if err != nil {
+		t.Fatalf("insert license: %v", err)
+	}
+
+	sessions := map[string]*deviceSession{}
+	for _, hwid := range hwids {
+		if added, err := registerDevice(licenseKey, hwid, len(hwids)); err != nil || !added {
+			t.Fatalf("registerDevice(%s): added=%v err=%v", hwid, added, err)
+		}
+		session, err := issueDeviceSession(licenseKey, hwid, expiresAt)
+		if err != nil {
+			t.Fatalf("issueDeviceSession(%s): %v", hwid, err)
+		}
+		sessions[hwid] = session
+	}
+	return sessions
+}
+
+// callHandler 以 JSON 请求体调用处理函数，返回状态码和解析后的响应
+func callHandler(t *testing.T, handler http.HandlerFunc, body interface{}, admin bool) (int, map[string]interface{}) {
+	t.Helper()
+
+	data, _ := json.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	if admin {
+		r = r.WithContext(context.WithValue(r.Context(), adminUserKey, &models.User{Email: "admin@test"}))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+// execSQL 执行测试准备语句
+func execSQL(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		t.Fatalf("exec %q: %v", query, err)
+	}
+}
+
+// enableTrial 为产品开启试用
+func enableTrial(t *testing.T, productName string, days int) {
+	t.Helper()
+	execSQL(t, `INSERT INTO product_policies (product_name, vm_policy, trial_days) VALUES (?, '', ?)`, productName, days)
+}
+
+// startTrial 调用试用接口，返回状态码和响应
+func startTrial(t *testing.T, hwid string, fingerprint map[string]string) (int, map[string]interface{}) {
+	t.Helper()
+	return callHandler(t, HandleTrial, TrialRequest{ProductName: "Pro", HWID: hwid, Fingerprint: fingerprint}, false)
+}
+
+// laptop 一台设备的硬件指纹
+var laptop = map[string]string{"board": "board-1", "disk": "disk-1", "machine_id": "machine-1", "cpu": "cpu-1"}
+
+func TestTrialRequiresFingerprint(t *testing.T) {
+	setupTestDB(t)
+	enableTrial(t, "Pro", 14)
+
+	for _, fingerprint := range []map[string]string{nil, {"board": "board-1"}} {
+		if code, resp := startTrial(t, "hwid-1", fingerprint); code != http.StatusBadRequest || resp["code"] != CodeInvalidRequest {
+			t.Fatalf("fingerprint %v: %d %v, want 400 %s", fingerprint, code, resp, CodeInvalidRequest)
+		}
+	}
+}
+
+func TestTrialOncePerDevice(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T, trialKey string)
+		hwid        string
+		fingerprint map[string]string
+		wantCode    int
+		wantErr     string
+		wantSameKey bool
+	}{
+		{
+			name:        "duplicate request",
+			hwid:        "hwid-1",
+			fingerprint: laptop,
+			wantCode:    http.StatusOK,
+			wantSameKey: true,
+		},
+		{
+			// 重装系统：machine-id 变化导致 HWID 变化，主板和磁盘不变
+			name:        "reinstall with the same fingerprint",
+			hwid:        "hwid-reinstalled",
+			fingerprint: map[string]string{"board": "board-1", "disk": "disk-1", "machine_id": "machine-2", "cpu": "cpu-1"},
+			wantCode:    http.StatusOK,
+			wantSameKey: true,
+		},
+		{
+			name:        "another device",
+			hwid:        "hwid-2",
+			fingerprint: map[string]string{"board": "board-2", "disk": "disk-2", "machine_id": "machine-2", "cpu": "cpu-1"},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name: "expired trial",
+			setup: func(t *testing.T, trialKey string) {
+				execSQL(t, `UPDATE licenses SET expires_at = ? WHERE license_key = ?`, time.Now().Add(-time.Hour), trialKey)
+			},
+			hwid:        "hwid-reinstalled",
+			fingerprint: laptop,
+			wantCode:    http.StatusForbidden,
+			wantErr:     CodeTrialUsed,
+		},
+		{
+			name: "device removed by admin",
+			setup: func(t *testing.T, trialKey string) {
+				execSQL(t, `DELETE FROM license_devices WHERE license_key = ?`, trialKey)
+			},
+			hwid:        "hwid-1",
+			fingerprint: laptop,
+			wantCode:    http.StatusForbidden,
+			wantErr:     CodeTrialUsed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			enableTrial(t, "Pro", 14)
+
+			code, resp := startTrial(t, "hwid-1", laptop)
+			if code != http.StatusOK {
+				t.Fatalf("first trial: %d %v", code, resp)
+			}
+			trialKey, _ := resp["license_key"].(string)
+			if tt.setup != nil {
+				tt.setup(t, trialKey)
+			}
+
+			code, resp = startTrial(t, tt.hwid, tt.fingerprint)
+			if code != tt.wantCode || (tt.wantErr != "" && resp["code"] != tt.wantErr) {
+				t.Fatalf("second trial: %d %v, want %d %s", code, resp, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if sameKey := resp["license_key"] == trialKey; sameKey != tt.wantSameKey {
+				t.Fatalf("license_key %v, first trial %s, want same key %v", resp["license_key"], trialKey, tt.wantSameKey)
+			}
+
+			// 试用许可证只绑定当前请求的设备
+			key, _ := resp["license_key"].(string)
+			if registered, _ := isDeviceRegistered(key, tt.hwid); !registered {
+				t.Fatal("trial device not registered")
+			}
+			if devices, _ := countDevices(key); devices != 1 {
+				t.Fatalf("trial license has %d devices, want 1", devices)
+			}
+		})
+	}
+}
+
+func TestTrialUpgradeKeepsDevice(t *testing.T) {
+	setupTestDB(t)
+	enableTrial(t, "Pro", 14)
+
+	_, resp := startTrial(t, "hwid-1", laptop)
+	trialKey, _ := resp["license_key"].(string)
+	execSQL(t, `INSERT INTO licenses (license_key, product_name, status, max_devices, validity_days) VALUES ('PRO-1', 'Pro', 'unused', 1, 365)`)
+
+	code, resp := activate(t, ActivateRequest{Key: "PRO-1", HWID: "hwid-1", Fingerprint: laptop, UpgradeFrom: trialKey})
+	if code != http.StatusOK {
+		t.Fatalf("upgrade: %d %v", code, resp)
+	}
+
+	// 设备转到正式许可证，试用许可证结束并释放设备
+	if registered, _ := isDeviceRegistered("PRO-1", "hwid-1"); !registered {
+		t.Fatal("device not registered on the purchased license")
+	}
+	if devices, _ := countDevices(trialKey); devices != 0 {
+		t.Fatalf("trial license still has %d devices", devices)
+	}
+	var status string
+	database.DB.QueryRow(`SELECT status FROM licenses WHERE license_key = ?`, trialKey).Scan(&status)
+	if status != "expired" {
+		t.Fatalf("trial license status = %s, want expired", status)
+	}
+
+	// 升级后不能再次试用
+	if code, resp := startTrial(t, "hwid-1", laptop); code != http.StatusForbidden || resp["code"] != CodeTrialUsed {
+		t.Fatalf("trial after upgrade: %d %v, want 403 %s", code, resp, CodeTrialUsed)
+	}
+}
+
+func TestTrialLicenseCannotMove(t *testing.T) {
+	setupTestDB(t)
+	enableTrial(t, "Pro", 14)
+
+	_, resp := startTrial(t, "hwid-1", laptop)
+	trialKey, _ := resp["license_key"].(string)
+	token, _ := resp["token"].(string)
+
+	// 解绑后空出的槽位同样可以被其他机器占用
+	r := httptest.NewRequest(http.MethodPost, "/api/deactivate", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	HandleDeactivate(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("deactivate trial: %d %s, want 403", w.Code, w.Body.String())
+	}
+
+	// 试用密钥不是秘密，拿到它的人不能通过激活接口的换绑路径把试用转到其他机器
+	// 试用设备总是保存了指纹，不满足 previous_hwid 迁移条件，只能按新设备处理
+	tests := []struct {
+		name    string
+		req     ActivateRequest
+		wantErr string
+	}{
+		{"previous_hwid", ActivateRequest{Key: trialKey, HWID: "other", PreviousHWID: "hwid-1"}, CodeDeviceLimit},
+		{"fingerprint drift", ActivateRequest{Key: trialKey, HWID: "other", Fingerprint: map[string]string{"board": "board-1", "disk": "disk-1", "machine_id": "machine-1", "cpu": "cpu-2"}}, CodeTransferLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := activate(t, tt.req)
+			if code != http.StatusForbidden || resp["code"] != tt.wantErr {
+				t.Fatalf("activate: %d %v, want 403 %s", code, resp, tt.wantErr)
+			}
+			if registered, _ := isDeviceRegistered(trialKey, "hwid-1"); !registered {
+				t.Fatal("trial device lost its binding")
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(utils.NewRateLimiter(2, time.Hour), func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, map[string]string{"status": "success"}, http.StatusOK)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/trial", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("192.0.2.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: %d", i+1, w.Code)
+		}
+	}
+
+	// 同一 IP 换端口仍然计数，其他 IP 不受影响
+	if w := request("192.0.2.1:2000"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("over limit: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request("192.0.2.2:1000"); w.Code != http.StatusOK {
+		t.Fatalf("other client: %d", w.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// signingKeyInfo 签名密钥信息（不包含私钥）
+type signingKeyInfo struct {
+	KID       string    `json:"kid"`
+	PublicKey string    `json:"public_key"` // base64，可直接嵌入客户端
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toSigningKeyInfo(key *utils.SigningKey) signingKeyInfo {
+	return signingKeyInfo{
+		KID:       key.KID,
+		PublicKey: base64.StdEncoding.EncodeToString(key.PublicKey()),
+		Status:    key.Status,
+		CreatedAt: key.CreatedAt,
+		UpdatedAt: key.UpdatedAt,
+	}
+}
+
+// HandleSigningKeys 列出（GET）或生成（POST）签名密钥
+// 新生成的密钥处于 pending 状态，公钥立即发布到 JWKS，提升后才用于签名
+func HandleSigningKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys := []signingKeyInfo{}
+		for _, key := range utils.ListSigningKeys() {
+			keys = append(keys, toSigningKeyInfo(key))
+		}
+		respondJSON(w, map[string]interface{}{
+			"keys":  keys,
+			"count": len(keys),
+		}, http.StatusOK)
+
+	case http.MethodPost:
+		key, err := utils.GenerateSigningKey()
+		if err != nil {
+			log.Printf("[Admin] Failed to generate signing key: %v", err)
+			respondError(w, "Failed to generate signing key", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, toSigningKeyInfo(key), http.StatusOK)
+
+	default:
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePromoteSigningKey 将指定密钥设为签名密钥
+// 待启用密钥发布时间不足 SIGNING_KEY_ROLLOUT 时拒绝（409），{"force": true} 强制提升
+func HandlePromoteSigningKey(w http.ResponseWriter, r *http.Request) {
+	handleSigningKeyAction(w, r, utils.PromoteSigningKey, "promoted")
+}
+
+// HandleRetireSigningKey 停用指定密钥
+func HandleRetireSigningKey(w http.ResponseWriter, r *http.Request) {
+	handleSigningKeyAction(w, r, func(kid string, _ bool) error {
+		return utils.RetireSigningKey(kid)
+	}, "retired")
+}
+
+func handleSigningKeyAction(w http.ResponseWriter, r *http.Request, action func(kid string, force bool) error, verb string) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		KID   string `json:"kid"`
+		Force bool   `json:"force"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.KID == "" {
+		respondError(w, "Missing kid", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(req.KID, req.Force); err != nil {
+		log.Printf("[Admin] Signing key %s not %s: %v", req.KID, verb, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, utils.ErrKeyRolloutPending) {
+			status = http.StatusConflict
+		}
+		respondError(w, err.Error(), status)
+		return
+	}
+
+	if req.Force {
+		log.Printf("[Admin] Signing key %s %s (forced)", req.KID, verb)
+	} else {
+		log.Printf("[Admin] Signing key %s %s", req.KID, verb)
+	}
+
+	respondJSON(w, map[string]string{
+		"message": "Signing key " + verb,
+		"kid":     req.KID,
+	}, http.StatusOK)
+}
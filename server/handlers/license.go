@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -14,21 +15,31 @@ import (
 
 // ActivateRequest 激活请求
 type ActivateRequest struct {
-	Key  string `json:"key"`
-	HWID string `json:"hwid"`
+	Key          string             `json:"key"`
+	HWID         string             `json:"hwid"`
+	Fingerprint  map[string]string  `json:"fingerprint,omitempty"`   // 组件名 -> 组件哈希，旧版客户端不发送
+	PreviousHWID string             `json:"previous_hwid,omitempty"` // 客户端升级前的硬件ID（硬件ID算法变化时）
+	Environment  *ClientEnvironment `json:"environment,omitempty"`   // 运行环境，旧版客户端不发送
+	UpgradeFrom  string             `json:"upgrade_from,omitempty"`  // 该设备的试用许可证密钥，激活成功后结束试用
 }
 
 // ActivateResponse 激活响应
 type ActivateResponse struct {
-	Status string `json:"status"`
-	Token  string `json:"token,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Status         string `json:"status"`
+	Token          string `json:"token,omitempty"`
+	RefreshToken   string `json:"refresh_token,omitempty"`    // 用于 /api/refresh 换取新的访问令牌
+	RequestSecret  string `json:"request_secret,omitempty"`   // 设备后续请求的签名密钥
+	ExpiresIn      int64  `json:"expires_in,omitempty"`       // 访问令牌剩余秒数
+	Devices        int    `json:"devices,omitempty"`          // 已占用的设备槽位
+	MaxDevices     int    `json:"max_devices,omitempty"`      // 设备槽位总数
+	LeaseExpiresIn int64  `json:"lease_expires_in,omitempty"` // 浮动许可证席位租约剩余秒数，需在此之前发送心跳续期
+	Error          string `json:"error,omitempty"`
 }
 
 // HandleActivate 处理许可证激活
 func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondErrorCode(w, CodeInvalidRequest, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -36,7 +47,7 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	var req ActivateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logActivation(req.Key, req.HWID, "activate", r, false, "Invalid request format")
-		respondError(w, "Invalid request format", http.StatusBadRequest)
+		respondErrorCode(w, CodeInvalidRequest, "Invalid request format", http.StatusBadRequest)
 		return
 	}
 
@@ -46,7 +57,19 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	if req.HWID == "" {
 		log.Printf("[Activate] WARNING: Received empty HWID from client")
 		logActivation(req.Key, req.HWID, "activate", r, false, "Empty HWID")
-		respondError(w, "Hardware ID is required", http.StatusBadRequest)
+		respondErrorCode(w, CodeInvalidRequest, "Hardware ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.ValidateFingerprint(req.Fingerprint); err != nil {
+		logActivation(req.Key, req.HWID, "activate", r, false, "Invalid fingerprint")
+		respondErrorCode(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateEnvironment(req.Environment); err != nil {
+		logActivation(req.Key, req.HWID, "activate", r, false, "Invalid environment")
+		respondErrorCode(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -58,12 +81,14 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	var userID sql.NullInt64
 
 	err := database.DB.QueryRow(`
-		SELECT id, license_key, product_name, hwid, status, max_devices, validity_days, expires_at, user_id
+		SELECT id, license_key, product_name, hwid, status, max_devices, validity_days, expires_at, user_id,
+		       COALESCE(license_type, 'node_locked'), max_transfers, transfer_cooldown_hours
 		FROM licenses WHERE license_key = ?
 	`, req.Key).Scan(
 		&license.ID, &license.LicenseKey, &license.ProductName,
 		&hwid, &license.Status, &license.MaxDevices,
-		&validityDays, &expiresAt, &userID,
+		&validityDays, &expiresAt, &userID, &license.LicenseType,
+		&license.MaxTransfers, &license.TransferCooldownHours,
 	)
 
 	// 处理 NULL hwid
@@ -78,14 +103,14 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	if err == sql.ErrNoRows {
 		log.Printf("[Activate] REJECTED: License not found")
 		logActivation(req.Key, req.HWID, "activate", r, false, "License not found")
-		respondError(w, "Invalid license key", http.StatusForbidden)
+		respondErrorCode(w, CodeNotFound, "Invalid license key", http.StatusForbidden)
 		return
 	}
 
 	if err != nil {
 		log.Printf("[Activate] ERROR: Database error: %v", err)
 		logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
-		respondError(w, "Internal server error", http.StatusInternalServerError)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -98,14 +123,14 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	if license.Status == "banned" {
 		log.Printf("[Activate] REJECTED: License banned")
 		logActivation(req.Key, req.HWID, "activate", r, false, "License banned")
-		respondError(w, "License has been banned", http.StatusForbidden)
+		respondErrorCode(w, CodeBanned, "License has been banned", http.StatusForbidden)
 		return
 	}
 
 	if license.Status == "expired" {
 		log.Printf("[Activate] REJECTED: License expired")
 		logActivation(req.Key, req.HWID, "activate", r, false, "License expired")
-		respondError(w, "License has expired", http.StatusForbidden)
+		respondErrorCode(w, CodeExpired, "License has expired", http.StatusForbidden)
 		return
 	}
 
@@ -115,18 +140,153 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 		database.DB.Exec("UPDATE licenses SET status = 'expired' WHERE id = ?", license.ID)
 		log.Printf("[Activate] REJECTED: License expired (expires_at check)")
 		logActivation(req.Key, req.HWID, "activate", r, false, "License expired")
-		respondError(w, "License has expired", http.StatusForbidden)
+		respondErrorCode(w, CodeExpired, "License has expired", http.StatusForbidden)
+		return
+	}
+
+	// 按产品策略处理虚拟机和容器中的激活（在占用设备槽位之前）
+	reject, flagged, err := checkEnvironment(license.ProductName, req.Environment)
+	if err != nil {
+		log.Printf("[Activate] ERROR: Failed to load product policy: %v", err)
+		logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if reject {
+		log.Printf("[Activate] REJECTED: Virtualized environment %s", req.Environment)
+		logActivation(req.Key, req.HWID, "activate", r, false, "Virtualized environment: "+req.Environment.Type)
+		respondErrorCode(w, CodeVirtualizationDenied, "This license cannot be activated in a virtual machine or container", http.StatusForbidden)
+		return
+	}
+	if flagged {
+		log.Printf("[Activate] FLAGGED: Environment %s", req.Environment)
+	}
+
+	// 检查设备绑定：已绑定的设备直接通过，硬件部分变化的设备按指纹识别，新设备占用一个空闲槽位
+	// 浮动许可证不绑定设备，改为借出一个有时限的席位
+	floating := license.LicenseType == utils.LicenseFloating
+	registered, err := isDeviceRegistered(license.LicenseKey, req.HWID)
+	if err != nil {
+		log.Printf("[Activate] ERROR: Failed to query devices: %v", err)
+		logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// 检查硬件绑定
-	if license.Status == "active" {
-		if license.HWID != req.HWID {
-			log.Printf("[Activate] REJECTED: HWID mismatch (expected %s, got %s)", truncate(license.HWID, 16), truncate(req.HWID, 16))
-			logActivation(req.Key, req.HWID, "activate", r, false, "HWID mismatch")
-			respondError(w, "License already activated on another device", http.StatusForbidden)
+	var driftedHWID string
+	var driftScore float64
+	if !registered && !floating {
+		driftedHWID, driftScore, err = matchDeviceFingerprint(license.LicenseKey, req.Fingerprint)
+		if err != nil {
+			log.Printf("[Activate] ERROR: Failed to match fingerprint: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// 客户端升级后硬件ID算法变化，且旧设备没有保存指纹时，按旧硬件ID迁移绑定
+	// 旧硬件ID不是秘密，只迁移从未换绑过的旧设备，每台设备最多迁移一次
+	migrated := false
+	if !registered && !floating && driftedHWID == "" && req.PreviousHWID != "" && req.PreviousHWID != req.HWID {
+		migrated, err = isDeviceMigratable(license.LicenseKey, req.PreviousHWID)
+		if err != nil {
+			log.Printf("[Activate] ERROR: Failed to query devices: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if migrated {
+			driftedHWID = req.PreviousHWID
+		}
+	}
+
+	// 换绑同样是设备转移，受 max_transfers 和冷却时间限制，否则持有密钥的人可以借此接管他人的设备槽位
+	// 试用许可证绑定领取试用的设备，任何情况下都不能换绑（重装后通过 /api/trial 按指纹找回）
+	// 不允许换绑时按新设备处理，有空闲槽位仍可激活
+	var transferDenied *transferDenial
+	if driftedHWID != "" {
+		_, transferDenied, err = checkTransfer(license.LicenseKey, license.MaxTransfers, license.TransferCooldownHours)
+		if err != nil {
+			log.Printf("[Activate] ERROR: Failed to query transfer history: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Database error")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if transferDenied != nil {
+			log.Printf("[Activate] Rebind of %s refused: %s", truncate(driftedHWID, 16), transferDenied.message)
+			logActivation(req.Key, driftedHWID, "transfer", r, false, transferDenied.reason)
+			driftedHWID, migrated = "", false
+		}
+	}
+
+	var leaseExpiry time.Time
+	if floating {
+		checkedOut, expiry, err := checkoutSeat(license.LicenseKey, req.HWID, license.MaxDevices)
+		if err != nil {
+			log.Printf("[Activate] ERROR: Failed to check out seat: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Failed to check out seat")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !checkedOut {
+			seats, _ := countDevices(license.LicenseKey)
+			log.Printf("[Activate] REJECTED: No seats available (%d/%d in use)", seats, license.MaxDevices)
+			logActivation(req.Key, req.HWID, "activate", r, false, "No seats available")
+			respondNoSeats(w, seats, license.MaxDevices)
+			return
+		}
+		leaseExpiry = expiry
+		log.Printf("[Activate] Seat checked out, hwid=%s (lease until %s)", truncate(req.HWID, 16), expiry.Format(time.RFC3339))
+	} else if registered {
+		touchDevice(license.LicenseKey, req.HWID)
+		if err := saveDeviceFingerprint(license.LicenseKey, req.HWID, req.Fingerprint); err != nil {
+			log.Printf("[Activate] WARNING: Failed to save fingerprint: %v", err)
+		}
+		log.Printf("[Activate] Device already registered, hwid=%s", truncate(req.HWID, 16))
+	} else if driftedHWID != "" {
+		if err := rebindDevice(license.LicenseKey, driftedHWID, req.HWID, req.Fingerprint); err != nil {
+			log.Printf("[Activate] ERROR: Failed to rebind device: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Failed to rebind device")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if migrated {
+			log.Printf("[Activate] HWID migrated: hwid=%s replaces previous %s", truncate(req.HWID, 16), truncate(driftedHWID, 16))
+		} else {
+			log.Printf("[Activate] Hardware drift: hwid=%s replaces %s (fingerprint match %.0f%%)",
+				truncate(req.HWID, 16), truncate(driftedHWID, 16), driftScore*100)
+		}
+		logActivation(req.Key, driftedHWID, "transfer", r, true, "")
+	} else {
+		added, err := registerDevice(license.LicenseKey, req.HWID, license.MaxDevices)
+		if err != nil {
+			log.Printf("[Activate] ERROR: Failed to register device: %v", err)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Failed to register device")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !added && transferDenied != nil {
+			// 设备被识别为已绑定设备，但换绑次数用尽或处于冷却期，返回换绑被拒绝的原因
+			log.Printf("[Activate] REJECTED: %s", transferDenied.message)
+			logActivation(req.Key, req.HWID, "activate", r, false, transferDenied.reason)
+			transferDenied.respond(w)
+			return
+		}
+		if !added {
+			log.Printf("[Activate] REJECTED: Device limit reached (max %d)", license.MaxDevices)
+			logActivation(req.Key, req.HWID, "activate", r, false, "Device limit reached")
+			respondErrorCode(w, CodeDeviceLimit, fmt.Sprintf("Device limit reached (max %d devices)", license.MaxDevices), http.StatusForbidden)
+			return
+		}
+		if err := saveDeviceFingerprint(license.LicenseKey, req.HWID, req.Fingerprint); err != nil {
+			log.Printf("[Activate] WARNING: Failed to save fingerprint: %v", err)
+		}
+		log.Printf("[Activate] New device registered, hwid=%s (len=%d)", truncate(req.HWID, 16), len(req.HWID))
+	}
+
+	if err := saveDeviceEnvironment(license.LicenseKey, req.HWID, req.Environment, flagged); err != nil {
+		log.Printf("[Activate] WARNING: Failed to save environment: %v", err)
 	}
 
 	// 激活许可证 (首次激活)
@@ -136,6 +296,7 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 		expiresAt := now.AddDate(0, 0, validityDays)
 		license.ExpiresAt = expiresAt
 
+		// hwid 列保留首台设备，兼容旧版查询
 		_, err = database.DB.Exec(`
 			UPDATE licenses
 			SET hwid = ?, status = 'active', activated_at = ?, expires_at = ?, updated_at = ?
@@ -145,28 +306,30 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			log.Printf("[Activate] ERROR: Failed to update license: %v", err)
 			logActivation(req.Key, req.HWID, "activate", r, false, "Failed to update license")
-			respondError(w, "Internal server error", http.StatusInternalServerError)
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
 		log.Printf("[Activate] License activated successfully, hwid=%s (len=%d), expires_at=%s (%d days)",
 			truncate(req.HWID, 16), len(req.HWID), expiresAt.Format("2006-01-02"), validityDays)
+	}
 
-		// 验证数据库写入
-		var savedHWID string
-		database.DB.QueryRow("SELECT hwid FROM licenses WHERE id = ?", license.ID).Scan(&savedHWID)
-		log.Printf("[Activate] Verification: Saved HWID length = %d", len(savedHWID))
-	} else {
-		// 已激活，验证HWID
-		log.Printf("[Activate] License already active, validating HWID")
+	// 从试用升级：同一设备激活同一产品的正式许可证后结束试用
+	if req.UpgradeFrom != "" && req.UpgradeFrom != license.LicenseKey {
+		if err := upgradeTrial(req.UpgradeFrom, req.HWID, license.ProductName, license.LicenseKey); err != nil {
+			log.Printf("[Activate] WARNING: Failed to end trial %s: %v", req.UpgradeFrom, err)
+		} else {
+			log.Printf("[Activate] Trial %s upgraded to %s", req.UpgradeFrom, license.LicenseKey)
+		}
 	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateJWT(license.LicenseKey, req.HWID, license.ExpiresAt)
+	devices, _ := countDevices(license.LicenseKey)
+
+	session, err := issueDeviceSession(license.LicenseKey, req.HWID, license.ExpiresAt)
 	if err != nil {
-		log.Printf("[Activate] ERROR: Failed to generate token: %v", err)
-		logActivation(req.Key, req.HWID, "activate", r, false, "Failed to generate token")
-		respondError(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("[Activate] ERROR: Failed to issue session: %v", err)
+		logActivation(req.Key, req.HWID, "activate", r, false, "Failed to issue session")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -174,62 +337,78 @@ func HandleActivate(w http.ResponseWriter, r *http.Request) {
 	logActivation(req.Key, req.HWID, "activate", r, true, "")
 
 	// 返回成功响应
-	respondJSON(w, ActivateResponse{
-		Status: "success",
-		Token:  token,
-	}, http.StatusOK)
+	response := ActivateResponse{
+		Status:        "success",
+		Token:         session.Token,
+		RefreshToken:  session.RefreshToken,
+		RequestSecret: session.RequestSecret,
+		ExpiresIn:     session.ExpiresIn(),
+		Devices:       devices,
+		MaxDevices:    license.MaxDevices,
+	}
+	if floating {
+		response.LeaseExpiresIn = int64(time.Until(leaseExpiry).Seconds())
+	}
+	respondJSON(w, response, http.StatusOK)
 }
 
 // HeartbeatResponse 心跳响应
 type HeartbeatResponse struct {
-	Status string `json:"status"`
+	Status         string `json:"status"`
+	Code           string `json:"code,omitempty"`             // 失败原因（错误码）
+	LeaseExpiresIn int64  `json:"lease_expires_in,omitempty"` // 浮动许可证续期后的席位租约剩余秒数
 }
 
 // HandleHeartbeat 处理心跳请求
 func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondErrorCode(w, CodeInvalidRequest, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// 提取Authorization头
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || len(authHeader) < 7 || authHeader[:7] != "Bearer " {
+	token, ok := bearerToken(r)
+	if !ok {
 		log.Printf("[Heartbeat] REJECTED: No valid Authorization header")
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusUnauthorized)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeTokenInvalid}, http.StatusUnauthorized)
 		return
 	}
 
-	token := authHeader[7:]
-
 	// 验证JWT
 	claims, err := utils.ValidateJWT(token)
 	if err != nil {
 		log.Printf("[Heartbeat] REJECTED: Invalid token: %v", err)
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusUnauthorized)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeTokenInvalid}, http.StatusUnauthorized)
+		return
+	}
+
+	// 检查令牌是否被管理员吊销
+	if revoked, err := isTokenRevoked(claims); err != nil || revoked {
+		log.Printf("[Heartbeat] REJECTED: Token revoked")
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeTokenRevoked}, http.StatusUnauthorized)
 		return
 	}
 
 	licenseKey, ok := (*claims)["license_key"].(string)
 	if !ok {
 		log.Printf("[Heartbeat] REJECTED: Invalid token claims")
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusUnauthorized)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeTokenInvalid}, http.StatusUnauthorized)
 		return
 	}
 
 	hwid, _ := (*claims)["hwid"].(string)
 
 	// 查询许可证状态
-	var status string
+	var status, licenseType string
 	var expiresAt time.Time
 	err = database.DB.QueryRow(`
-		SELECT status, expires_at FROM licenses WHERE license_key = ?
-	`, licenseKey).Scan(&status, &expiresAt)
+		SELECT status, expires_at, COALESCE(license_type, 'node_locked') FROM licenses WHERE license_key = ?
+	`, licenseKey).Scan(&status, &expiresAt, &licenseType)
 
 	if err != nil {
 		log.Printf("[Heartbeat] REJECTED: License not found or error: %v", err)
 		logActivation(licenseKey, hwid, "heartbeat", r, false, "License not found")
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusForbidden)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeNotFound}, http.StatusForbidden)
 		return
 	}
 
@@ -237,7 +416,7 @@ func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	if status != "active" {
 		log.Printf("[Heartbeat] REJECTED: License status is %s", status)
 		logActivation(licenseKey, hwid, "heartbeat", r, false, "License not active")
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusForbidden)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: licenseStatusCode(status)}, http.StatusForbidden)
 		return
 	}
 
@@ -246,7 +425,28 @@ func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
 		database.DB.Exec("UPDATE licenses SET status = 'expired' WHERE license_key = ?", licenseKey)
 		log.Printf("[Heartbeat] REJECTED: License expired")
 		logActivation(licenseKey, hwid, "heartbeat", r, false, "License expired")
-		respondJSON(w, HeartbeatResponse{Status: "dead"}, http.StatusForbidden)
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeExpired}, http.StatusForbidden)
+		return
+	}
+
+	// 浮动许可证：续期席位租约，租约已过期说明席位已被释放，需重新激活
+	var response HeartbeatResponse
+	if licenseType == utils.LicenseFloating {
+		leaseExpiry, renewed, err := renewSeat(licenseKey, hwid)
+		if err != nil || !renewed {
+			log.Printf("[Heartbeat] REJECTED: Seat lease expired")
+			logActivation(licenseKey, hwid, "heartbeat", r, false, "Seat lease expired")
+			respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeLeaseExpired}, http.StatusForbidden)
+			return
+		}
+		response.LeaseExpiresIn = int64(time.Until(leaseExpiry).Seconds())
+	}
+
+	// 检查设备是否仍绑定（设备解绑后旧令牌失效）
+	if registered, err := isDeviceRegistered(licenseKey, hwid); err != nil || !registered {
+		log.Printf("[Heartbeat] REJECTED: Device not registered")
+		logActivation(licenseKey, hwid, "heartbeat", r, false, "Device not registered")
+		respondJSON(w, HeartbeatResponse{Status: "dead", Code: CodeHWIDMismatch}, http.StatusForbidden)
 		return
 	}
 
@@ -254,16 +454,188 @@ func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	database.DB.Exec(`
 		UPDATE licenses SET last_heartbeat = ? WHERE license_key = ?
 	`, time.Now(), licenseKey)
+	touchDevice(licenseKey, hwid)
 
 	log.Printf("[Heartbeat] OK: %s", truncate(licenseKey, 20))
 	logActivation(licenseKey, hwid, "heartbeat", r, true, "")
 
 	// 返回成功
-	respondJSON(w, HeartbeatResponse{Status: "alive"}, http.StatusOK)
+	response.Status = "alive"
+	respondJSON(w, response, http.StatusOK)
+}
+
+// DeactivateResponse 解绑响应
+type DeactivateResponse struct {
+	Status        string `json:"status"`
+	Devices       int    `json:"devices"`        // 解绑后剩余的设备数
+	TransfersLeft int    `json:"transfers_left"` // 剩余可转移次数
+	Error         string `json:"error,omitempty"`
+}
+
+// HandleDeactivate 处理设备解绑
+// 客户端使用激活时获得的令牌释放当前设备的槽位，以便在新设备上重新激活
+// 每个许可证的转移次数和冷却时间分别由 max_transfers 和 transfer_cooldown_hours 控制
+func HandleDeactivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondErrorCode(w, CodeInvalidRequest, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		log.Printf("[Deactivate] REJECTED: No valid Authorization header")
+		respondErrorCode(w, CodeTokenInvalid, "Missing or invalid Authorization header", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		log.Printf("[Deactivate] REJECTED: Invalid token: %v", err)
+		respondErrorCode(w, CodeTokenInvalid, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if revoked, err := isTokenRevoked(claims); err != nil || revoked {
+		log.Printf("[Deactivate] REJECTED: Token revoked")
+		respondErrorCode(w, CodeTokenRevoked, "Token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	licenseKey, ok := (*claims)["license_key"].(string)
+	if !ok {
+		log.Printf("[Deactivate] REJECTED: Invalid token claims")
+		respondErrorCode(w, CodeTokenInvalid, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	hwid, _ := (*claims)["hwid"].(string)
+
+	// 查询许可证转移策略
+	var status, licenseType string
+	var maxTransfers, cooldownHours int
+	err = database.DB.QueryRow(`
+		SELECT status, max_transfers, transfer_cooldown_hours, COALESCE(license_type, 'node_locked')
+		FROM licenses WHERE license_key = ?
+	`, licenseKey).Scan(&status, &maxTransfers, &cooldownHours, &licenseType)
+
+	if err == sql.ErrNoRows {
+		log.Printf("[Deactivate] REJECTED: License not found")
+		logActivation(licenseKey, hwid, "deactivate", r, false, "License not found")
+		respondErrorCode(w, CodeNotFound, "Invalid license key", http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		log.Printf("[Deactivate] ERROR: Database error: %v", err)
+		logActivation(licenseKey, hwid, "deactivate", r, false, "Database error")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if status == "banned" {
+		log.Printf("[Deactivate] REJECTED: License banned")
+		logActivation(licenseKey, hwid, "deactivate", r, false, "License banned")
+		respondErrorCode(w, CodeBanned, "License has been banned", http.StatusForbidden)
+		return
+	}
+
+	registered, err := isDeviceRegistered(licenseKey, hwid)
+	if err != nil {
+		log.Printf("[Deactivate] ERROR: Failed to query devices: %v", err)
+		logActivation(licenseKey, hwid, "deactivate", r, false, "Database error")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !registered {
+		log.Printf("[Deactivate] REJECTED: Device not registered")
+		logActivation(licenseKey, hwid, "deactivate", r, false, "Device not registered")
+		respondErrorCode(w, CodeHWIDMismatch, "Device is not registered to this license", http.StatusNotFound)
+		return
+	}
+
+	// 浮动许可证归还席位，不受转移次数和冷却时间限制
+	if licenseType == utils.LicenseFloating {
+		if err := releaseDevice(licenseKey, hwid); err != nil {
+			log.Printf("[Deactivate] ERROR: Failed to release seat: %v", err)
+			logActivation(licenseKey, hwid, "checkin", r, false, "Failed to release seat")
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		seats, _ := countDevices(licenseKey)
+		log.Printf("[Deactivate] SUCCESS: Seat released, hwid=%s (%d seats in use)", truncate(hwid, 16), seats)
+		logActivation(licenseKey, hwid, "checkin", r, true, "")
+		respondJSON(w, DeactivateResponse{Status: "success", Devices: seats}, http.StatusOK)
+		return
+	}
+
+	// 检查转移次数和冷却时间
+	used, denied, err := checkTransfer(licenseKey, maxTransfers, cooldownHours)
+	if err != nil {
+		log.Printf("[Deactivate] ERROR: Failed to query transfer history: %v", err)
+		logActivation(licenseKey, hwid, "deactivate", r, false, "Database error")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if denied != nil {
+		log.Printf("[Deactivate] REJECTED: %s", denied.message)
+		logActivation(licenseKey, hwid, "deactivate", r, false, denied.reason)
+		denied.respond(w)
+		return
+	}
+
+	if err := releaseDevice(licenseKey, hwid); err != nil {
+		log.Printf("[Deactivate] ERROR: Failed to release device: %v", err)
+		logActivation(licenseKey, hwid, "deactivate", r, false, "Failed to release device")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	devices, _ := countDevices(licenseKey)
+
+	log.Printf("[Deactivate] SUCCESS: Device released, hwid=%s (%d devices remaining)", truncate(hwid, 16), devices)
+	logActivation(licenseKey, hwid, "deactivate", r, true, "")
+
+	respondJSON(w, DeactivateResponse{
+		Status:        "success",
+		Devices:       devices,
+		TransfersLeft: maxTransfers - used - 1,
+	}, http.StatusOK)
+}
+
+// HandleHealth 健康检查（供 Docker / Nginx 使用，无需认证）
+func HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := database.DB.Ping(); err != nil {
+		respondJSON(w, map[string]string{"status": "unhealthy"}, http.StatusServiceUnavailable)
+		return
+	}
+	respondJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// HandleJWKS 返回令牌验证公钥（JWKS 格式）
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, utils.PublicJWKS(), http.StatusOK)
 }
 
 // 辅助函数
 
+// bearerToken 从Authorization头中提取Bearer令牌
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
+		return "", false
+	}
+	return authHeader[7:], true
+}
+
 func respondJSON(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
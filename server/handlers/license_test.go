@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Lazywords2006/web/server/database"
+)
+
+// activate 调用激活接口
+func activate(t *testing.T, req ActivateRequest) (int, map[string]interface{}) {
+	t.Helper()
+	return callHandler(t, HandleActivate, req, false)
+}
+
+// transferCount 返回许可证成功的换绑记录数
+func transferCount(t *testing.T, licenseKey string) int {
+	t.Helper()
+	var count int
+	if err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM activation_logs WHERE license_key = ? AND action = 'transfer' AND success = 1
+	`, licenseKey).Scan(&count); err != nil {
+		t.Fatalf("count transfers: %v", err)
+	}
+	return count
+}
+
+func TestActivateDeviceLimit(t *testing.T) {
+	setupTestDB(t)
+	execSQL(t, `INSERT INTO licenses (license_key, product_name, max_devices) VALUES ('SEATS-1', 'Test', 2)`)
+
+	tests := []struct {
+		name        string
+		hwid        string
+		wantCode    int
+		wantDevices float64
+	}{
+		{"first device", "device-a", http.StatusOK, 1},
+		{"same device again", "device-a", http.StatusOK, 1},
+		{"second device", "device-b", http.StatusOK, 2},
+		{"over the limit", "device-c", http.StatusForbidden, 0},
+		{"bound device still allowed", "device-b", http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		code, resp := activate(t, ActivateRequest{Key: "SEATS-1", HWID: tt.hwid})
+		if code != tt.wantCode {
+			t.Fatalf("%s: %d %v, want %d", tt.name, code, resp, tt.wantCode)
+		}
+		if code != http.StatusOK {
+			if resp["code"] != CodeDeviceLimit {
+				t.Fatalf("%s: code %v, want %s", tt.name, resp["code"], CodeDeviceLimit)
+			}
+			continue
+		}
+		if resp["devices"] != tt.wantDevices || resp["max_devices"] != float64(2) {
+			t.Fatalf("%s: devices %v/%v, want %v/2", tt.name, resp["devices"], resp["max_devices"], tt.wantDevices)
+		}
+	}
+
+	// 每台设备记录首次和最近在线时间，hwid 列保留首台设备
+	devices, err := getLicenseDevices("SEATS-1")
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("getLicenseDevices: %v %v", devices, err)
+	}
+	for _, d := range devices {
+		if d.FirstSeen.IsZero() || d.LastSeen.Before(d.FirstSeen) {
+			t.Fatalf("device %s: first_seen %s, last_seen %s", d.HWID, d.FirstSeen, d.LastSeen)
+		}
+	}
+	var hwid string
+	database.DB.QueryRow(`SELECT hwid FROM licenses WHERE license_key = 'SEATS-1'`).Scan(&hwid)
+	if hwid != "device-a" {
+		t.Fatalf("licenses.hwid = %q, want device-a", hwid)
+	}
+}
+
+func TestActivatePreviousHWIDMigration(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T)
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:     "legacy device migrates",
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "device with a fingerprint",
+			setup: func(t *testing.T) {
+				execSQL(t, `UPDATE license_devices SET fingerprint = '{"board":"b"}' WHERE hwid = 'victim'`)
+			},
+			wantCode: http.StatusForbidden,
+			wantErr:  CodeDeviceLimit,
+		},
+		{
+			name: "device already rebound",
+			setup: func(t *testing.T) {
+				execSQL(t, `UPDATE license_devices SET rebound_at = CURRENT_TIMESTAMP WHERE hwid = 'victim'`)
+			},
+			wantCode: http.StatusForbidden,
+			wantErr:  CodeDeviceLimit,
+		},
+		{
+			name: "transfer quota exhausted",
+			setup: func(t *testing.T) {
+				execSQL(t, `UPDATE licenses SET max_transfers = 0`)
+			},
+			wantCode: http.StatusForbidden,
+			wantErr:  CodeTransferLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			createActiveLicense(t, "MIGRATE-1", "victim")
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			// previous_hwid 是请求中的普通字段，知道他人硬件ID即可声称自己是升级后的该设备
+			code, resp := activate(t, ActivateRequest{Key: "MIGRATE-1", HWID: "new-hwid", PreviousHWID: "victim"})
+			if code != tt.wantCode || (tt.wantErr != "" && resp["code"] != tt.wantErr) {
+				t.Fatalf("activate: %d %v, want %d %s", code, resp, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				if registered, _ := isDeviceRegistered("MIGRATE-1", "victim"); !registered {
+					t.Fatal("refused migration still removed the original device")
+				}
+				return
+			}
+
+			if transferCount(t, "MIGRATE-1") != 1 {
+				t.Fatal("migration not logged as a transfer")
+			}
+
+			// 同一设备不能再次迁移
+			code, resp = activate(t, ActivateRequest{Key: "MIGRATE-1", HWID: "third-hwid", PreviousHWID: "new-hwid"})
+			if code != http.StatusForbidden || resp["code"] != CodeDeviceLimit {
+				t.Fatalf("second migration: %d %v, want 403 %s", code, resp, CodeDeviceLimit)
+			}
+		})
+	}
+}
+
+func TestActivateFingerprintRebindCountsAsTransfer(t *testing.T) {
+	setupTestDB(t)
+	createActiveLicense(t, "DRIFT-1", "hwid-1")
+	execSQL(t, `UPDATE licenses SET max_transfers = 2, transfer_cooldown_hours = 24`)
+
+	fingerprint := map[string]string{"board": "b", "disk": "d", "machine_id": "m", "cpu": "c"}
+	if code, resp := activate(t, ActivateRequest{Key: "DRIFT-1", HWID: "hwid-1", Fingerprint: fingerprint}); code != http.StatusOK {
+		t.Fatalf("activate: %d %v", code, resp)
+	}
+
+	// 更换 CPU：指纹匹配，换绑并计入转移次数
+	fingerprint["cpu"] = "c2"
+	if code, resp := activate(t, ActivateRequest{Key: "DRIFT-1", HWID: "hwid-2", Fingerprint: fingerprint}); code != http.StatusOK {
+		t.Fatalf("rebind: %d %v", code, resp)
+	}
+	if transferCount(t, "DRIFT-1") != 1 {
+		t.Fatal("fingerprint rebind not logged as a transfer")
+	}
+	if registered, _ := isDeviceRegistered("DRIFT-1", "hwid-2"); !registered {
+		t.Fatal("device not rebound to the new hardware ID")
+	}
+
+	// 冷却期内再次换绑被拒绝，原设备保持绑定
+	fingerprint["disk"] = "d2"
+	code, resp := activate(t, ActivateRequest{Key: "DRIFT-1", HWID: "hwid-3", Fingerprint: fingerprint})
+	if code != http.StatusTooManyRequests || resp["code"] != CodeRateLimited {
+		t.Fatalf("rebind during cooldown: %d %v, want 429 %s", code, resp, CodeRateLimited)
+	}
+
+	// 冷却结束后继续换绑，直到转移次数用完
+	execSQL(t, `UPDATE licenses SET transfer_cooldown_hours = 0`)
+	if code, resp := activate(t, ActivateRequest{Key: "DRIFT-1", HWID: "hwid-3", Fingerprint: fingerprint}); code != http.StatusOK {
+		t.Fatalf("rebind after cooldown: %d %v", code, resp)
+	}
+	fingerprint["cpu"] = "c3"
+	code, resp = activate(t, ActivateRequest{Key: "DRIFT-1", HWID: "hwid-4", Fingerprint: fingerprint})
+	if code != http.StatusForbidden || resp["code"] != CodeTransferLimit {
+		t.Fatalf("rebind over quota: %d %v, want 403 %s", code, resp, CodeTransferLimit)
+	}
+	if registered, _ := isDeviceRegistered("DRIFT-1", "hwid-3"); !registered {
+		t.Fatal("refused rebind removed the bound device")
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// OfflineRequest 客户端生成的离线激活请求文件
+type OfflineRequest struct {
+	LicenseKey string `json:"license_key"`
+	HWID       string `json:"hwid"`
+	CreatedAt  int64  `json:"created_at"`
+	Signature  string `json:"signature"`
+}
+
+// OfflineLicenseRequest 生成离线许可证请求
+type OfflineLicenseRequest struct {
+	Request  OfflineRequest `json:"request"`
+	Features []string       `json:"features"` // 为空时使用许可证生效的授权内容中开启的功能
+}
+
+// OfflineLicenseResponse 生成离线许可证响应
+type OfflineLicenseResponse struct {
+	License    string           `json:"license"` // 许可证文件内容，原样保存为 .lic 文件交给客户
+	LicenseKey string           `json:"license_key"`
+	HWID       string           `json:"hwid"`
+	Product    string           `json:"product"`
+	Features   []string         `json:"features"`
+	Limits     map[string]int64 `json:"limits,omitempty"`
+	ExpiresAt  time.Time        `json:"expires_at"`
+}
+
+// HandleOfflineLicense 将离线激活请求转换为签名的许可证文件
+// 与在线激活一样占用设备槽位，首次使用时开始计算有效期
+func HandleOfflineLicense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body OfflineLicenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	req := body.Request
+
+	if req.LicenseKey == "" || req.HWID == "" {
+		respondError(w, "License key and hardware ID are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.VerifyOfflineRequest(req.LicenseKey, req.HWID, req.CreatedAt, req.Signature); err != nil {
+		log.Printf("[Offline] REJECTED: %v", err)
+		logActivation(req.LicenseKey, req.HWID, "offline_activate", r, false, "Invalid request signature")
+		respondError(w, "Invalid offline request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[Offline] Request: key=%s, hwid=%s...", req.LicenseKey, truncate(req.HWID, 16))
+
+	var licenseID int64
+	var product, status, licenseType string
+	var maxDevices, validityDays int
+	var expiresAt sql.NullTime
+
+	err := database.DB.QueryRow(`
+		SELECT id, product_name, status, max_devices, validity_days, expires_at, COALESCE(license_type, 'node_locked')
+		FROM licenses WHERE license_key = ?
+	`, req.LicenseKey).Scan(&licenseID, &product, &status, &maxDevices, &validityDays, &expiresAt, &licenseType)
+
+	if err == sql.ErrNoRows {
+		logActivation(req.LicenseKey, req.HWID, "offline_activate", r, false, "License not found")
+		respondError(w, "License not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("[Offline] ERROR: Database error: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if status == "banned" || status == "expired" || (expiresAt.Valid && time.Now().After(expiresAt.Time)) {
+		logActivation(req.LicenseKey, req.HWID, "offline_activate", r, false, "License not usable: "+status)
+		respondError(w, fmt.Sprintf("License is %s", status), http.StatusForbidden)
+		return
+	}
+
+	// 浮动许可证的席位需要心跳续期，无法离线使用
+	if licenseType == utils.LicenseFloating {
+		logActivation(req.LicenseKey, req.HWID, "offline_activate", r, false, "Floating license")
+		respondError(w, "Floating licenses cannot be activated offline", http.StatusForbidden)
+		return
+	}
+
+	registered, err := isDeviceRegistered(req.LicenseKey, req.HWID)
+	if err != nil {
+		log.Printf("[Offline] ERROR: Failed to query devices: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !registered {
+		added, err := registerDevice(req.LicenseKey, req.HWID, maxDevices)
+		if err != nil {
+			log.Printf("[Offline] ERROR: Failed to register device: %v", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !added {
+			logActivation(req.LicenseKey, req.HWID, "offline_activate", r, false, "Device limit reached")
+			respondError(w, fmt.Sprintf("Device limit reached (max %d devices)", maxDevices), http.StatusForbidden)
+			return
+		}
+	}
+
+	// 首次激活：与在线激活一致，从现在开始计算有效期
+	expiry := expiresAt.Time
+	if status == "unused" {
+		now := time.Now()
+		expiry = now.AddDate(0, 0, validityDays)
+
+		_, err = database.DB.Exec(`
+			UPDATE licenses
+			SET hwid = ?, status = 'active', activated_at = ?, expires_at = ?, updated_at = ?
+			WHERE id = ?
+		`, req.HWID, now, expiry, now, licenseID)
+		if err != nil {
+			log.Printf("[Offline] ERROR: Failed to update license: %v", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	entitlements, err := licenseEntitlements(req.LicenseKey)
+	if err != nil {
+		log.Printf("[Offline] ERROR: Failed to load entitlements: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	features := body.Features
+	if features == nil {
+		features = entitlements.EnabledFeatures()
+	}
+
+	licenseFile, err := utils.GenerateLicenseFile(req.LicenseKey, req.HWID, product, features, entitlements.Limits, expiry)
+	if err != nil {
+		log.Printf("[Offline] ERROR: Failed to generate license file: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user := AdminFromContext(r.Context()); user != nil {
+		log.Printf("[Offline] SUCCESS: License file issued by %s, expires_at=%s", user.Email, expiry.Format("2006-01-02"))
+	}
+	logActivation(req.LicenseKey, req.HWID, "offline_activate", r, true, "")
+
+	respondJSON(w, OfflineLicenseResponse{
+		License:    licenseFile,
+		LicenseKey: req.LicenseKey,
+		HWID:       req.HWID,
+		Product:    product,
+		Features:   features,
+		Limits:     entitlements.Limits,
+		ExpiresAt:  expiry,
+	}, http.StatusOK)
+}
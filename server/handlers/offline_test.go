@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// offlineRequest 按客户端的格式签名离线激活请求
+func offlineRequest(licenseKey, hwid string) OfflineRequest {
+	createdAt := time.Now().Unix()
+	mac := hmac.New(sha256.New, []byte(licenseKey))
+	fmt.Fprintf(mac, "%s\n%s\n%d", licenseKey, hwid, createdAt)
+	return OfflineRequest{
+		LicenseKey: licenseKey,
+		HWID:       hwid,
+		CreatedAt:  createdAt,
+		Signature:  base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+func TestVerifyOfflineRequestVector(t *testing.T) {
+	// 与 auth 包测试中的签名向量相同，保证客户端和服务器的签名格式一致
+	if err := utils.VerifyOfflineRequest("KEY-1", "hwid-a", 1700000000, "HSICwerB7+wB9OaIHn9HCWY5wzDee/dzhO0/VlER3Io="); err != nil {
+		t.Fatalf("VerifyOfflineRequest: %v", err)
+	}
+}
+
+func TestOfflineLicense(t *testing.T) {
+	setupTestDB(t)
+	execSQL(t, `INSERT INTO licenses (license_key, product_name, max_devices, validity_days) VALUES ('OFFLINE-1', 'Pro', 1, 30)`)
+
+	code, resp := callHandler(t, HandleOfflineLicense, OfflineLicenseRequest{Request: offlineRequest("OFFLINE-1", "hwid-a")}, true)
+	if code != http.StatusOK {
+		t.Fatalf("offline license: %d %v", code, resp)
+	}
+
+	// 许可证文件使用在线令牌的签名密钥，但 typ 不同，不能当作访问令牌
+	licenseFile := resp["license"].(string)
+	token, err := jwt.Parse(licenseFile, func(*jwt.Token) (interface{}, error) { return utils.SigningPublicKey(), nil })
+	if err != nil || token.Header["typ"] != utils.LicenseFileType {
+		t.Fatalf("license file: %v %v", err, token.Header)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["hwid"] != "hwid-a" || claims["product"] != "Pro" {
+		t.Fatalf("claims = %v", claims)
+	}
+	if _, err := utils.ValidateJWT(licenseFile); err == nil {
+		t.Fatal("license file accepted as an access token")
+	}
+
+	// 与在线激活一样开始计算有效期并占用设备槽位
+	var status string
+	var expiresAt time.Time
+	database.DB.QueryRow(`SELECT status, expires_at FROM licenses WHERE license_key = 'OFFLINE-1'`).Scan(&status, &expiresAt)
+	if status != "active" || expiresAt.Before(time.Now().AddDate(0, 0, 29)) {
+		t.Fatalf("license status %s, expires_at %s", status, expiresAt)
+	}
+	if registered, _ := isDeviceRegistered("OFFLINE-1", "hwid-a"); !registered {
+		t.Fatal("offline device not registered")
+	}
+}
+
+func TestOfflineLicenseRejections(t *testing.T) {
+	tampered := offlineRequest("OFFLINE-2", "hwid-a")
+	tampered.HWID = "hwid-b"
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T)
+		req      OfflineRequest
+		wantCode int
+	}{
+		{"tampered request", nil, tampered, http.StatusBadRequest},
+		{"signed with another key", nil, func() OfflineRequest {
+			req := offlineRequest("OTHER-KEY", "hwid-a")
+			req.LicenseKey = "OFFLINE-2"
+			return req
+		}(), http.StatusBadRequest},
+		{"unknown license", nil, offlineRequest("MISSING", "hwid-a"), http.StatusNotFound},
+		{
+			name:     "banned",
+			setup:    func(t *testing.T) { execSQL(t, `UPDATE licenses SET status = 'banned'`) },
+			req:      offlineRequest("OFFLINE-2", "hwid-a"),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "floating license",
+			setup:    func(t *testing.T) { execSQL(t, `UPDATE licenses SET license_type = 'floating'`) },
+			req:      offlineRequest("OFFLINE-2", "hwid-a"),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "device limit",
+			setup: func(t *testing.T) {
+				registerDevice("OFFLINE-2", "hwid-other", 1)
+			},
+			req:      offlineRequest("OFFLINE-2", "hwid-a"),
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			execSQL(t, `INSERT INTO licenses (license_key, product_name, max_devices) VALUES ('OFFLINE-2', 'Pro', 1)`)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			code, resp := callHandler(t, HandleOfflineLicense, OfflineLicenseRequest{Request: tt.req}, true)
+			if code != tt.wantCode || resp["license"] != nil {
+				t.Fatalf("offline license: %d %v, want %d", code, resp, tt.wantCode)
+			}
+		})
+	}
+}
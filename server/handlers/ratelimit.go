@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// RateLimit 按客户端 IP 限制请求频率，超出时返回 429 rate_limited 并附带 Retry-After
+// limiter 为 nil 时不限制
+func RateLimit(limiter *utils.RateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		if ok, retryAfter := limiter.Allow(ip); !ok {
+			log.Printf("[RateLimit] REJECTED: Too many requests on %s from %s", r.URL.Path, ip)
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+			respondErrorCode(w, CodeRateLimited, "Too many requests, please try again later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
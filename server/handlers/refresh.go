@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshResponse 刷新令牌响应
+type RefreshResponse struct {
+	Status       string `json:"status"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // 访问令牌剩余秒数
+	Error        string `json:"error,omitempty"`
+	Code         string `json:"code,omitempty"` // 失败原因（错误码）
+}
+
+// issueRefreshToken 签发刷新令牌
+// familyID 为空时开始新的令牌族（激活），否则延续原令牌族（轮换）
+// 有效期不超过许可证过期时间
+func issueRefreshToken(licenseKey, hwid, familyID string, licenseExpiry time.Time) (string, error) {
+	if familyID == "" {
+		bytes := make([]byte, 16)
+		if _, err := rand.Read(bytes); err != nil {
+			return "", err
+		}
+		familyID = hex.EncodeToString(bytes)
+	}
+
+	token, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(utils.RefreshTokenTTL)
+	if !licenseExpiry.IsZero() && licenseExpiry.Before(expiresAt) {
+		expiresAt = licenseExpiry
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO refresh_tokens (token_hash, family_id, license_key, hwid, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, utils.HashToken(token), familyID, licenseKey, hwid, now, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// revokeRefreshFamily 吊销整个令牌族
+func revokeRefreshFamily(familyID string) error {
+	_, err := database.DB.Exec("UPDATE refresh_tokens SET revoked = 1 WHERE family_id = ?", familyID)
+	return err
+}
+
+// deleteDeviceRefreshTokens 删除设备的所有刷新令牌（解绑设备时调用）
+func deleteDeviceRefreshTokens(licenseKey, hwid string) error {
+	_, err := database.DB.Exec(`
+		DELETE FROM refresh_tokens WHERE license_key = ? AND hwid = ?
+	`, licenseKey, hwid)
+	return err
+}
+
+// cleanupRefreshTokens 清理过期的刷新令牌
+func cleanupRefreshTokens() {
+	database.DB.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now())
+}
+
+// HandleRefresh 使用刷新令牌换取新的访问令牌
+// 每次刷新都轮换刷新令牌；已使用过的刷新令牌再次出现说明令牌泄露，吊销整个令牌族
+func HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondErrorCode(w, CodeInvalidRequest, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondErrorCode(w, CodeInvalidRequest, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := utils.HashToken(req.RefreshToken)
+
+	var familyID, licenseKey, hwid string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	var revoked bool
+	err := database.DB.QueryRow(`
+		SELECT family_id, license_key, hwid, expires_at, used_at, revoked
+		FROM refresh_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&familyID, &licenseKey, &hwid, &expiresAt, &usedAt, &revoked)
+
+	if err == sql.ErrNoRows {
+		log.Printf("[Refresh] REJECTED: Unknown refresh token")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "Invalid refresh token", Code: CodeRefreshInvalid}, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		log.Printf("[Refresh] ERROR: Database error: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if revoked {
+		log.Printf("[Refresh] REJECTED: Refresh token revoked, key=%s", licenseKey)
+		logActivation(licenseKey, hwid, "refresh", r, false, "Refresh token revoked")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "Refresh token revoked", Code: CodeRefreshInvalid}, http.StatusUnauthorized)
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		log.Printf("[Refresh] REJECTED: Refresh token expired, key=%s", licenseKey)
+		logActivation(licenseKey, hwid, "refresh", r, false, "Refresh token expired")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "Refresh token expired", Code: CodeRefreshInvalid}, http.StatusUnauthorized)
+		return
+	}
+
+	// 标记为已使用；并发请求中只有一个能成功，其余视为重用
+	reused := usedAt.Valid
+	if !reused {
+		result, err := database.DB.Exec(`
+			UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL
+		`, time.Now(), tokenHash)
+		if err != nil {
+			log.Printf("[Refresh] ERROR: Failed to mark token used: %v", err)
+			respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		reused = rowsAffected == 0
+	}
+
+	if reused {
+		revokeRefreshFamily(familyID)
+		log.Printf("[Refresh] REUSE DETECTED: key=%s, hwid=%s..., token family revoked", licenseKey, truncate(hwid, 16))
+		logActivation(licenseKey, hwid, "refresh", r, false, "Refresh token reuse detected")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "Refresh token reuse detected", Code: CodeRefreshReused}, http.StatusUnauthorized)
+		return
+	}
+
+	// 许可证和设备必须仍然有效
+	var status string
+	var licenseExpiry sql.NullTime
+	err = database.DB.QueryRow(`
+		SELECT status, expires_at FROM licenses WHERE license_key = ?
+	`, licenseKey).Scan(&status, &licenseExpiry)
+
+	if err != nil || status != "active" || (licenseExpiry.Valid && time.Now().After(licenseExpiry.Time)) {
+		revokeRefreshFamily(familyID)
+		log.Printf("[Refresh] REJECTED: License not active, key=%s", licenseKey)
+		logActivation(licenseKey, hwid, "refresh", r, false, "License not active")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "License is not active", Code: CodeInactive}, http.StatusForbidden)
+		return
+	}
+
+	registered, err := isDeviceRegistered(licenseKey, hwid)
+	if err != nil || !registered {
+		revokeRefreshFamily(familyID)
+		log.Printf("[Refresh] REJECTED: Device not registered, key=%s", licenseKey)
+		logActivation(licenseKey, hwid, "refresh", r, false, "Device not registered")
+		respondJSON(w, RefreshResponse{Status: "dead", Error: "Device is not registered", Code: CodeHWIDMismatch}, http.StatusForbidden)
+		return
+	}
+
+	// 每次刷新重新读取授权内容，管理员的修改在下次刷新时生效
+	entitlements, err := licenseEntitlements(licenseKey)
+	if err != nil {
+		log.Printf("[Refresh] ERROR: Failed to load entitlements: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	accessExpiry := utils.AccessTokenExpiry(licenseExpiry.Time)
+	token, err := utils.GenerateJWT(licenseKey, hwid, entitlements, accessExpiry)
+	if err != nil {
+		log.Printf("[Refresh] ERROR: Failed to generate token: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := issueRefreshToken(licenseKey, hwid, familyID, licenseExpiry.Time)
+	if err != nil {
+		log.Printf("[Refresh] ERROR: Failed to issue refresh token: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	touchDevice(licenseKey, hwid)
+	logActivation(licenseKey, hwid, "refresh", r, true, "")
+
+	respondJSON(w, RefreshResponse{
+		Status:       "success",
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(time.Until(accessExpiry).Seconds()),
+	}, http.StatusOK)
+}
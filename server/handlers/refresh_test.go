@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+func refresh(t *testing.T, refreshToken string) (int, map[string]interface{}) {
+	t.Helper()
+	return callHandler(t, HandleRefresh, RefreshRequest{RefreshToken: refreshToken}, false)
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	setupTestDB(t)
+	session := createActiveLicense(t, "REFRESH-1", "device-a")["device-a"]
+
+	code, resp := refresh(t, session.RefreshToken)
+	if code != http.StatusOK || resp["status"] != "success" {
+		t.Fatalf("refresh: %d %v", code, resp)
+	}
+	rotated, _ := resp["refresh_token"].(string)
+	if rotated == "" || rotated == session.RefreshToken {
+		t.Fatalf("refresh token not rotated: %q", rotated)
+	}
+	if token, _ := resp["token"].(string); token == "" {
+		t.Fatal("no access token issued")
+	}
+
+	// 轮换后的令牌可以继续使用
+	if code, resp := refresh(t, rotated); code != http.StatusOK {
+		t.Fatalf("refresh with rotated token: %d %v", code, resp)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "REFRESH-2", "device-a", "device-b")
+
+	_, resp := refresh(t, sessions["device-a"].RefreshToken)
+	rotated, _ := resp["refresh_token"].(string)
+
+	// 已使用的刷新令牌再次出现：判定为泄露
+	code, resp := refresh(t, sessions["device-a"].RefreshToken)
+	if code != http.StatusUnauthorized || resp["code"] != CodeRefreshReused {
+		t.Fatalf("reuse: %d %v, want 401 %s", code, resp, CodeRefreshReused)
+	}
+
+	// 同一令牌族中合法客户端持有的新令牌也被吊销
+	code, resp = refresh(t, rotated)
+	if code != http.StatusUnauthorized || resp["code"] != CodeRefreshInvalid {
+		t.Fatalf("rotated token after reuse: %d %v, want 401 %s", code, resp, CodeRefreshInvalid)
+	}
+
+	// 其他设备的令牌族不受影响
+	if code, resp := refresh(t, sessions["device-b"].RefreshToken); code != http.StatusOK {
+		t.Fatalf("other device: %d %v", code, resp)
+	}
+}
+
+func TestRefreshRejections(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "REFRESH-3", "device-a", "device-b")
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T)
+		token    string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:     "unknown token",
+			setup:    func(t *testing.T) {},
+			token:    "rt_unknown",
+			wantCode: http.StatusUnauthorized,
+			wantErr:  CodeRefreshInvalid,
+		},
+		{
+			name: "banned license",
+			setup: func(t *testing.T) {
+				execSQL(t, "UPDATE licenses SET status = 'banned' WHERE license_key = 'REFRESH-3'")
+			},
+			token:    sessions["device-a"].RefreshToken,
+			wantCode: http.StatusForbidden,
+			wantErr:  CodeInactive,
+		},
+		{
+			name: "device released",
+			setup: func(t *testing.T) {
+				execSQL(t, "UPDATE licenses SET status = 'active' WHERE license_key = 'REFRESH-3'")
+				execSQL(t, "DELETE FROM license_devices WHERE hwid = 'device-b'")
+			},
+			token:    sessions["device-b"].RefreshToken,
+			wantCode: http.StatusForbidden,
+			wantErr:  CodeHWIDMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			code, resp := refresh(t, tt.token)
+			if code != tt.wantCode || resp["code"] != tt.wantErr {
+				t.Fatalf("got %d %v, want %d %s", code, resp, tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signedRefresh 经过签名校验中间件发送刷新请求，secret 为空时不签名
+func signedRefresh(t *testing.T, refreshToken, secret string) (int, map[string]interface{}) {
+	t.Helper()
+
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: refreshToken})
+	r := httptest.NewRequest(http.MethodPost, "/api/refresh", bytes.NewReader(body))
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		nonce := hex.EncodeToString([]byte(refreshToken + strconv.FormatInt(time.Now().UnixNano(), 10)))
+		r.Header.Set(utils.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		r.Header.Set(utils.HeaderNonce, nonce)
+		r.Header.Set(utils.HeaderSignature, utils.SignRequest(secret, r.Method, r.URL.Path, timestamp, nonce, body))
+	}
+	w := httptest.NewRecorder()
+	RequireRefreshSignature(HandleRefresh)(w, r)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestRefreshRequiresDeviceSignature(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "REFRESH-4", "device-a", "device-b")
+	session := sessions["device-a"]
+
+	tests := []struct {
+		name     string
+		secret   string
+		wantCode int
+		wantErr  string
+	}{
+		{"unsigned", "", http.StatusBadRequest, CodeSignatureMissing},
+		{"signed with another device's secret", sessions["device-b"].RequestSecret, http.StatusBadRequest, CodeSignatureInvalid},
+		{"signed with the license key", "REFRESH-4", http.StatusBadRequest, CodeSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := signedRefresh(t, session.RefreshToken, tt.secret)
+			if code != tt.wantCode || resp["code"] != tt.wantErr {
+				t.Fatalf("got %d %v, want %d %s", code, resp, tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+
+	// 被拒绝的请求不消耗刷新令牌，设备用自己的密钥签名后仍可刷新
+	if code, resp := signedRefresh(t, session.RefreshToken, session.RequestSecret); code != http.StatusOK {
+		t.Fatalf("signed refresh: %d %v", code, resp)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RevokeRequest 吊销令牌请求
+// 按令牌吊销时提供 token 或 jti；按设备吊销时提供 license_key 和 hwid；按许可证吊销时只提供 license_key
+type RevokeRequest struct {
+	Token      string `json:"token,omitempty"`
+	JTI        string `json:"jti,omitempty"`
+	LicenseKey string `json:"license_key,omitempty"`
+	HWID       string `json:"hwid,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// tokenClaims 从已验证的令牌中提取吊销检查所需的声明，签发时间为 Unix 毫秒
+// 没有 iat_ms 的旧令牌按 iat 整秒计算
+func tokenClaims(claims *jwt.MapClaims) (jti, licenseKey, hwid string, issuedAtMs int64) {
+	jti, _ = (*claims)["jti"].(string)
+	licenseKey, _ = (*claims)["license_key"].(string)
+	hwid, _ = (*claims)["hwid"].(string)
+	if iatMs, ok := (*claims)["iat_ms"].(float64); ok {
+		issuedAtMs = int64(iatMs)
+	} else if iat, ok := (*claims)["iat"].(float64); ok {
+		issuedAtMs = int64(iat) * 1000
+	}
+	return
+}
+
+// isTokenRevoked 检查令牌是否被吊销
+// 命中 jti，或签发时间早于设备/许可证的吊销时间点，均视为已吊销；吊销之后签发的令牌不受影响
+func isTokenRevoked(claims *jwt.MapClaims) (bool, error) {
+	jti, licenseKey, hwid, issuedAtMs := tokenClaims(claims)
+
+	var id int64
+	err := database.DB.QueryRow(`
+		SELECT id FROM revoked_tokens
+		WHERE expires_at > ? AND (
+			(jti IS NOT NULL AND jti = ?)
+			OR (jti IS NULL AND license_key = ? AND (hwid IS NULL OR hwid = ?) AND revoked_before > ?)
+		)
+		LIMIT 1
+	`, time.Now(), jti, licenseKey, hwid, issuedAtMs).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revocationExpiry 吊销记录的保留期限，不早于受影响的访问令牌中最晚的过期时间
+// 访问令牌的过期时间不超过签发时的许可证过期时间，但 ACCESS_TOKEN_TTL 调小后旧令牌可能晚于 now+AccessTokenTTL 过期，
+// 因此取许可证过期时间和 now+AccessTokenTTL 中较晚的一个；licenseKey 为空（只知道 jti）时按所有许可证中最晚的过期时间
+func revocationExpiry(licenseKey string) (time.Time, error) {
+	expiry := time.Now().Add(utils.AccessTokenTTL)
+
+	var licenseExpiry sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT expires_at FROM licenses
+		WHERE expires_at IS NOT NULL AND (? = '' OR license_key = ?)
+		ORDER BY expires_at DESC LIMIT 1
+	`, licenseKey, licenseKey).Scan(&licenseExpiry)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	if licenseExpiry.Valid && licenseExpiry.Time.After(expiry) {
+		expiry = licenseExpiry.Time
+	}
+	return expiry, nil
+}
+
+// cleanupRevokedTokens 清理已失去意义的吊销记录（相关令牌均已自然过期）
+func cleanupRevokedTokens() {
+	database.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now())
+}
+
+// HandleRevokeToken 吊销单个访问令牌
+// 只影响该令牌，客户端仍可使用刷新令牌获取新的访问令牌
+func HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	jti := req.JTI
+	var licenseKey, hwid string
+	var expiresAt time.Time
+
+	if req.Token != "" {
+		claims, err := utils.ValidateJWT(req.Token)
+		if err != nil {
+			respondError(w, "Invalid or already expired token", http.StatusBadRequest)
+			return
+		}
+		jti, licenseKey, hwid, _ = tokenClaims(claims)
+		if exp, ok := (*claims)["exp"].(float64); ok {
+			expiresAt = time.Unix(int64(exp), 0)
+		}
+	}
+
+	if jti == "" {
+		respondError(w, "Token or jti is required (tokens issued before jti support cannot be revoked individually)", http.StatusBadRequest)
+		return
+	}
+
+	// 只提供 jti 时不知道令牌的过期时间，按可能的最晚过期时间保留记录
+	if expiresAt.IsZero() {
+		var err error
+		if expiresAt, err = revocationExpiry(licenseKey); err != nil {
+			log.Printf("[Revoke] ERROR: Failed to query license expiry: %v", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	cleanupRevokedTokens()
+
+	_, err := database.DB.Exec(`
+		INSERT INTO revoked_tokens (jti, license_key, hwid, reason, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, jti, nullIfEmpty(licenseKey), nullIfEmpty(hwid), req.Reason, time.Now(), expiresAt)
+	if err != nil {
+		log.Printf("[Revoke] ERROR: Failed to revoke token: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Revoke] Token %s revoked by %s", jti, AdminFromContext(r.Context()).Email)
+
+	respondJSON(w, map[string]string{
+		"message": "Token revoked",
+		"jti":     jti,
+	}, http.StatusOK)
+}
+
+// HandleRevokeDevice 吊销设备的所有现有令牌和刷新令牌，设备需重新激活
+func HandleRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	handleRevokeSessions(w, r, true)
+}
+
+// HandleRevokeLicense 吊销许可证下所有设备的现有令牌和刷新令牌
+func HandleRevokeLicense(w http.ResponseWriter, r *http.Request) {
+	handleRevokeSessions(w, r, false)
+}
+
+// handleRevokeSessions 记录吊销时间点，此前签发的令牌全部失效
+func handleRevokeSessions(w http.ResponseWriter, r *http.Request, byDevice bool) {
+	if r.Method != http.MethodPost {
+		respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.LicenseKey == "" || (byDevice && req.HWID == "") {
+		if byDevice {
+			respondError(w, "license_key and hwid are required", http.StatusBadRequest)
+		} else {
+			respondError(w, "license_key is required", http.StatusBadRequest)
+		}
+		return
+	}
+
+	hwid := req.HWID
+	if !byDevice {
+		hwid = ""
+	}
+
+	cleanupRevokedTokens()
+
+	expiresAt, err := revocationExpiry(req.LicenseKey)
+	if err != nil {
+		log.Printf("[Revoke] ERROR: Failed to query license expiry: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 吊销时间点精确到毫秒，吊销之后（同一秒内）签发的令牌不受影响
+	now := time.Now()
+	_, err = database.DB.Exec(`
+		INSERT INTO revoked_tokens (license_key, hwid, revoked_before, reason, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.LicenseKey, nullIfEmpty(hwid), now.UnixMilli(), req.Reason, now, expiresAt)
+	if err != nil {
+		log.Printf("[Revoke] ERROR: Failed to record revocation: %v", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 刷新令牌同时作废，否则客户端可以立即换取新令牌
+	if byDevice {
+		database.DB.Exec(`
+			UPDATE refresh_tokens SET revoked = 1 WHERE license_key = ? AND hwid = ?
+		`, req.LicenseKey, hwid)
+		log.Printf("[Revoke] Device %s... of %s revoked by %s", truncate(hwid, 16), req.LicenseKey, AdminFromContext(r.Context()).Email)
+	} else {
+		database.DB.Exec("UPDATE refresh_tokens SET revoked = 1 WHERE license_key = ?", req.LicenseKey)
+		log.Printf("[Revoke] All sessions of %s revoked by %s", req.LicenseKey, AdminFromContext(r.Context()).Email)
+	}
+
+	respondJSON(w, map[string]string{
+		"message": "Sessions revoked",
+	}, http.StatusOK)
+}
+
+// nullIfEmpty 空字符串存为 NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenRevoked 验证访问令牌并检查是否已吊销
+func tokenRevoked(t *testing.T, token string) bool {
+	t.Helper()
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	revoked, err := isTokenRevoked(claims)
+	if err != nil {
+		t.Fatalf("isTokenRevoked: %v", err)
+	}
+	return revoked
+}
+
+func TestRevokeSingleToken(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "REVOKE-1", "device-a", "device-b")
+
+	code, resp := callHandler(t, HandleRevokeToken, RevokeRequest{Token: sessions["device-a"].Token, Reason: "test"}, true)
+	if code != http.StatusOK {
+		t.Fatalf("revoke token: %d %v", code, resp)
+	}
+
+	if !tokenRevoked(t, sessions["device-a"].Token) {
+		t.Fatal("revoked token still accepted")
+	}
+	if tokenRevoked(t, sessions["device-b"].Token) {
+		t.Fatal("other device's token revoked")
+	}
+
+	// 只吊销访问令牌：刷新令牌仍可换取新令牌，新令牌不受影响
+	code, resp = refresh(t, sessions["device-a"].RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh after token revocation: %d %v", code, resp)
+	}
+	if tokenRevoked(t, resp["token"].(string)) {
+		t.Fatal("token issued after revocation is revoked")
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		req         RevokeRequest
+		wantRevoked map[string]bool
+	}{
+		{
+			name:        "device",
+			handler:     HandleRevokeDevice,
+			req:         RevokeRequest{LicenseKey: "REVOKE-2", HWID: "device-a"},
+			wantRevoked: map[string]bool{"device-a": true, "device-b": false},
+		},
+		{
+			name:        "license",
+			handler:     HandleRevokeLicense,
+			req:         RevokeRequest{LicenseKey: "REVOKE-2"},
+			wantRevoked: map[string]bool{"device-a": true, "device-b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			sessions := createActiveLicense(t, "REVOKE-2", "device-a", "device-b")
+
+			code, resp := callHandler(t, tt.handler, tt.req, true)
+			if code != http.StatusOK {
+				t.Fatalf("revoke: %d %v", code, resp)
+			}
+
+			for hwid, want := range tt.wantRevoked {
+				if got := tokenRevoked(t, sessions[hwid].Token); got != want {
+					t.Errorf("%s access token revoked = %v, want %v", hwid, got, want)
+				}
+
+				// 吊销会话时刷新令牌同时作废，设备不能自行换取新令牌
+				code, resp := refresh(t, sessions[hwid].RefreshToken)
+				if want && (code != http.StatusUnauthorized || resp["code"] != CodeRefreshInvalid) {
+					t.Errorf("%s refresh after revocation: %d %v", hwid, code, resp)
+				}
+				if !want && code != http.StatusOK {
+					t.Errorf("%s refresh of unaffected device: %d %v", hwid, code, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeSessionsAllowsReactivation(t *testing.T) {
+	setupTestDB(t)
+	createActiveLicense(t, "REVOKE-3", "device-a")
+
+	if code, resp := callHandler(t, HandleRevokeLicense, RevokeRequest{LicenseKey: "REVOKE-3"}, true); code != http.StatusOK {
+		t.Fatalf("revoke: %d %v", code, resp)
+	}
+
+	// 吊销时间点精确到毫秒，同一秒内之后签发的令牌（重新激活）不受影响
+	time.Sleep(2 * time.Millisecond)
+	session, err := issueDeviceSession("REVOKE-3", "device-a", time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("issueDeviceSession: %v", err)
+	}
+	if tokenRevoked(t, session.Token) {
+		t.Fatal("token issued after revocation is revoked")
+	}
+}
+
+func TestRevokeTokenRequiresTokenOrJTI(t *testing.T) {
+	setupTestDB(t)
+
+	code, _ := callHandler(t, HandleRevokeToken, RevokeRequest{}, true)
+	if code != http.StatusBadRequest {
+		t.Fatalf("empty request: %d, want 400", code)
+	}
+
+	code, _ = callHandler(t, HandleRevokeToken, RevokeRequest{Token: "not-a-token"}, true)
+	if code != http.StatusBadRequest {
+		t.Fatalf("invalid token: %d, want 400", code)
+	}
+}
+
+func TestRevocationOutlivesTokens(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "REVOKE-4", "device-a")
+
+	var licenseExpiry time.Time
+	database.DB.QueryRow(`SELECT expires_at FROM licenses WHERE license_key = 'REVOKE-4'`).Scan(&licenseExpiry)
+
+	// ACCESS_TOKEN_TTL 调小后，之前按较长有效期签发的令牌仍然有效，吊销记录不能只保留新的 TTL
+	ttl := utils.AccessTokenTTL
+	utils.AccessTokenTTL = time.Minute
+	t.Cleanup(func() { utils.AccessTokenTTL = ttl })
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     RevokeRequest
+	}{
+		{"license", HandleRevokeLicense, RevokeRequest{LicenseKey: "REVOKE-4"}},
+		{"jti only", HandleRevokeToken, RevokeRequest{JTI: "0123456789abcdef"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execSQL(t, `DELETE FROM revoked_tokens`)
+			if code, resp := callHandler(t, tt.handler, tt.req, true); code != http.StatusOK {
+				t.Fatalf("revoke: %d %v", code, resp)
+			}
+
+			var expiresAt time.Time
+			if err := database.DB.QueryRow(`SELECT expires_at FROM revoked_tokens`).Scan(&expiresAt); err != nil {
+				t.Fatalf("query revocation: %v", err)
+			}
+			if expiresAt.Before(licenseExpiry) {
+				t.Fatalf("revocation expires at %s, before the license expiry %s", expiresAt, licenseExpiry)
+			}
+		})
+	}
+
+	// 记录到期清理之前令牌仍被拒绝
+	callHandler(t, HandleRevokeLicense, RevokeRequest{LicenseKey: "REVOKE-4"}, true)
+	cleanupRevokedTokens()
+	if !tokenRevoked(t, sessions["device-a"].Token) {
+		t.Fatal("revocation dropped before the token expired")
+	}
+}
+
+func TestRevocationPrecisionMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := database.InitDB(path); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	// 旧版按秒记录吊销时间点：该秒内（含）签发的令牌均已吊销
+	revokedAt := time.Now().Truncate(time.Second)
+	execSQL(t, `
+		INSERT INTO revoked_tokens (license_key, revoked_before, expires_at) VALUES ('REVOKE-5', ?, ?)
+	`, revokedAt.Unix(), time.Now().Add(time.Hour))
+	database.Close()
+
+	if err := database.InitDB(path); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		wantRevoked bool
+	}{
+		{"old token in the same second", jwt.MapClaims{"license_key": "REVOKE-5", "iat": float64(revokedAt.Unix())}, true},
+		{"old token issued earlier", jwt.MapClaims{"license_key": "REVOKE-5", "iat": float64(revokedAt.Unix() - 60)}, true},
+		{"new token in the same second", jwt.MapClaims{"license_key": "REVOKE-5", "iat": float64(revokedAt.Unix()), "iat_ms": float64(revokedAt.UnixMilli() + 500)}, true},
+		{"new token in the next second", jwt.MapClaims{"license_key": "REVOKE-5", "iat": float64(revokedAt.Unix() + 1), "iat_ms": float64(revokedAt.UnixMilli() + 1000)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := isTokenRevoked(&tt.claims)
+			if err != nil {
+				t.Fatalf("isTokenRevoked: %v", err)
+			}
+			if revoked != tt.wantRevoked {
+				t.Fatalf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// releaseExpiredSeats 释放浮动许可证中心跳已停止（租约过期）的席位
+func releaseExpiredSeats(licenseKey string) error {
+	rows, err := database.DB.Query(`
+		SELECT hwid FROM license_devices
+		WHERE license_key = ? AND lease_expires_at IS NOT NULL AND lease_expires_at <= ?
+	`, licenseKey, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var expired []string
+	for rows.Next() {
+		var hwid string
+		if err := rows.Scan(&hwid); err == nil {
+			expired = append(expired, hwid)
+		}
+	}
+	rows.Close()
+
+	for _, hwid := range expired {
+		if err := releaseDevice(licenseKey, hwid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutSeat 为设备借出浮动许可证席位，设备已持有席位时续期
+// 计数和插入在同一条语句中完成，避免并发借出超出 maxSeats
+// 返回 false 表示席位已满
+func checkoutSeat(licenseKey, hwid string, maxSeats int) (bool, time.Time, error) {
+	if err := releaseExpiredSeats(licenseKey); err != nil {
+		return false, time.Time{}, err
+	}
+
+	if leaseExpiry, ok, err := renewSeat(licenseKey, hwid); err != nil || ok {
+		return ok, leaseExpiry, err
+	}
+
+	now := time.Now()
+	leaseExpiry := now.Add(utils.SeatLeaseTTL)
+	result, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO license_devices (license_key, hwid, first_seen, last_seen, lease_expires_at)
+		SELECT ?, ?, ?, ?, ?
+		WHERE (
+			SELECT COUNT(*) FROM license_devices WHERE license_key = ? AND lease_expires_at > ?
+		) < ?
+	`, licenseKey, hwid, now, now, leaseExpiry, licenseKey, now, maxSeats)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, leaseExpiry, nil
+}
+
+// renewSeat 延长设备持有的席位租约，租约已过期（席位可能已被其他设备占用）时返回 false
+func renewSeat(licenseKey, hwid string) (time.Time, bool, error) {
+	now := time.Now()
+	leaseExpiry := now.Add(utils.SeatLeaseTTL)
+	result, err := database.DB.Exec(`
+		UPDATE license_devices SET lease_expires_at = ?, last_seen = ?
+		WHERE license_key = ? AND hwid = ? AND lease_expires_at > ?
+	`, leaseExpiry, now, licenseKey, hwid, now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return leaseExpiry, rowsAffected > 0, nil
+}
+
+// convertDeviceLeases 许可证类型变更时转换已有的设备记录
+// 改为浮动许可证时已绑定设备的租约立即到期，需重新借出席位；改为节点锁定时当前持有席位的设备转为永久绑定
+func convertDeviceLeases(licenseKey, licenseType string) error {
+	var err error
+	if licenseType == utils.LicenseFloating {
+		_, err = database.DB.Exec(`
+			UPDATE license_devices SET lease_expires_at = ? WHERE license_key = ? AND lease_expires_at IS NULL
+		`, time.Now(), licenseKey)
+	} else {
+		if err = releaseExpiredSeats(licenseKey); err != nil {
+			return err
+		}
+		_, err = database.DB.Exec(`
+			UPDATE license_devices SET lease_expires_at = NULL WHERE license_key = ?
+		`, licenseKey)
+	}
+	return err
+}
+
+// respondNoSeats 返回席位已满的错误响应，附带当前占用的席位数
+func respondNoSeats(w http.ResponseWriter, seatsInUse, maxSeats int) {
+	respondJSON(w, map[string]interface{}{
+		"error":        "No seats available",
+		"code":         CodeNoSeats,
+		"seats_in_use": seatsInUse,
+		"max_seats":    maxSeats,
+	}, http.StatusForbidden)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// maxSignedBody 签名请求体的最大长度
+const maxSignedBody = 1 << 20
+
+// secretFunc 根据请求确定签名密钥
+// 返回 ok=false 表示无法确定密钥，交由后续处理器按原逻辑拒绝（例如令牌无效）
+// 返回 ok=true 但密钥为空表示设备尚未分配密钥
+type secretFunc func(r *http.Request, body []byte) (secret string, ok bool)
+
+// RequireActivationSignature 激活请求签名校验
+// 激活前设备还没有专属密钥，使用许可证密钥本身作为 HMAC 密钥
+func RequireActivationSignature(next http.HandlerFunc) http.HandlerFunc {
+	return requireSignature(next, activationSecret)
+}
+
+// RequireDeviceSignature 已激活设备的请求签名校验（心跳、解绑）
+// 使用激活时下发给该设备的 request_secret
+func RequireDeviceSignature(next http.HandlerFunc) http.HandlerFunc {
+	return requireSignature(next, deviceSecret)
+}
+
+// RequireRefreshSignature 刷新请求签名校验
+// 按刷新令牌找到设备，使用该设备的 request_secret，只截获刷新令牌无法换取新令牌
+func RequireRefreshSignature(next http.HandlerFunc) http.HandlerFunc {
+	return requireSignature(next, refreshSecret)
+}
+
+func requireSignature(next http.HandlerFunc, getSecret secretFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody))
+		if err != nil {
+			respondErrorCode(w, CodeInvalidRequest, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		timestampHeader := r.Header.Get(utils.HeaderTimestamp)
+		nonce := r.Header.Get(utils.HeaderNonce)
+		signature := r.Header.Get(utils.HeaderSignature)
+
+		if timestampHeader == "" || nonce == "" || signature == "" {
+			if !utils.RequireRequestSignature {
+				next(w, r)
+				return
+			}
+			log.Printf("[Signature] REJECTED: Missing signature headers on %s", r.URL.Path)
+			respondErrorCode(w, CodeSignatureMissing, "Request signature required", http.StatusBadRequest)
+			return
+		}
+
+		timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+		if err != nil {
+			respondErrorCode(w, CodeRequestStale, "Invalid request timestamp", http.StatusBadRequest)
+			return
+		}
+
+		skew := time.Since(time.Unix(timestamp, 0))
+		if skew > utils.RequestMaxSkew || skew < -utils.RequestMaxSkew {
+			log.Printf("[Signature] REJECTED: Stale request on %s (skew %s)", r.URL.Path, skew.Round(time.Second))
+			respondErrorCode(w, CodeRequestStale, "Request timestamp outside allowed window, check system clock", http.StatusBadRequest)
+			return
+		}
+
+		secret, ok := getSecret(r, body)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		if secret == "" {
+			if !utils.RequireRequestSignature {
+				next(w, r)
+				return
+			}
+			respondErrorCode(w, CodeSignatureInvalid, "Device has no request secret, please re-activate", http.StatusBadRequest)
+			return
+		}
+
+		if !utils.VerifyRequestSignature(secret, r.Method, r.URL.Path, timestamp, nonce, body, signature) {
+			log.Printf("[Signature] REJECTED: Invalid signature on %s from %s", r.URL.Path, r.RemoteAddr)
+			respondErrorCode(w, CodeSignatureInvalid, "Request signature verification failed", http.StatusBadRequest)
+			return
+		}
+
+		// 签名有效后再记录随机数，避免伪造请求占用随机数
+		if !useNonce(nonce) {
+			log.Printf("[Signature] REJECTED: Replayed request on %s from %s", r.URL.Path, r.RemoteAddr)
+			respondErrorCode(w, CodeRequestReplayed, "Request has already been processed", http.StatusConflict)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// SignResponses 使用服务器签名密钥签名响应（包括错误响应）
+// 客户端据此拒绝伪造的许可证服务器，签名包含请求的 X-Nonce 因此无法重放
+func SignResponses(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buffer := &responseBuffer{ResponseWriter: w, statusCode: http.StatusOK}
+		next(buffer, r)
+
+		timestamp := time.Now().Unix()
+		kid, signature, err := utils.SignResponse(buffer.statusCode, r.URL.Path, r.Header.Get(utils.HeaderNonce), timestamp, buffer.body.Bytes())
+		if err != nil {
+			log.Printf("[Signature] ERROR: Failed to sign response on %s: %v", r.URL.Path, err)
+		} else {
+			w.Header().Set(utils.HeaderServerTimestamp, strconv.FormatInt(timestamp, 10))
+			w.Header().Set(utils.HeaderServerKeyID, kid)
+			w.Header().Set(utils.HeaderServerSignature, signature)
+		}
+
+		w.WriteHeader(buffer.statusCode)
+		w.Write(buffer.body.Bytes())
+	}
+}
+
+// responseBuffer 缓存处理器写出的状态码和响应体，签名后再发送
+type responseBuffer struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (b *responseBuffer) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// activationSecret 激活请求以许可证密钥作为签名密钥
+func activationSecret(r *http.Request, body []byte) (string, bool) {
+	var req ActivateRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Key == "" {
+		return "", false
+	}
+	return req.Key, true
+}
+
+// deviceSecret 从访问令牌确定设备，读取其请求签名密钥
+// 旧版本激活的设备没有密钥，需要重新激活
+func deviceSecret(r *http.Request, body []byte) (string, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", false
+	}
+
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return "", false
+	}
+
+	_, licenseKey, hwid, _ := tokenClaims(claims)
+
+	var secret sql.NullString
+	err = database.DB.QueryRow(`
+		SELECT request_secret FROM license_devices WHERE license_key = ? AND hwid = ?
+	`, licenseKey, hwid).Scan(&secret)
+	if err != nil {
+		return "", false
+	}
+
+	return secret.String, true
+}
+
+// refreshSecret 从刷新令牌确定设备，读取其请求签名密钥
+// 已轮换的刷新令牌仍保留记录，重用检测同样要求设备签名
+func refreshSecret(r *http.Request, body []byte) (string, bool) {
+	var req RefreshRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.RefreshToken == "" {
+		return "", false
+	}
+
+	var secret sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT d.request_secret FROM refresh_tokens t
+		JOIN license_devices d ON d.license_key = t.license_key AND d.hwid = t.hwid
+		WHERE t.token_hash = ?
+	`, utils.HashToken(req.RefreshToken)).Scan(&secret)
+	if err != nil {
+		return "", false
+	}
+
+	return secret.String, true
+}
+
+// useNonce 记录随机数，已存在时返回 false（重放）
+// 顺便清理超出时间窗口的旧随机数
+func useNonce(nonce string) bool {
+	now := time.Now()
+	database.DB.Exec("DELETE FROM request_nonces WHERE created_at < ?", now.Add(-2*utils.RequestMaxSkew))
+
+	result, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO request_nonces (nonce, created_at) VALUES (?, ?)
+	`, nonce, now)
+	if err != nil {
+		log.Printf("[Signature] ERROR: Failed to record nonce: %v", err)
+		return false
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0
+}
+
+// setRequestSecret 为设备生成新的请求签名密钥（每次激活轮换）
+func setRequestSecret(licenseKey, hwid string) (string, error) {
+	secret, err := utils.GenerateRequestSecret()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE license_devices SET request_secret = ? WHERE license_key = ? AND hwid = ?
+	`, secret, licenseKey, hwid)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
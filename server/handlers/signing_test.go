@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// signedRequest 要发送的签名请求，body 与 signedBody 不同时模拟请求体被篡改
+type signedRequest struct {
+	path       string
+	token      string
+	secret     string // 为空时不签名
+	body       []byte
+	signedBody []byte
+	timestamp  time.Time
+	nonce      string
+}
+
+// send 经过签名校验中间件发送请求，通过校验时处理函数返回 200
+func (s signedRequest) send(t *testing.T, middleware func(http.HandlerFunc) http.HandlerFunc) (int, map[string]interface{}) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, s.path, bytes.NewReader(s.body))
+	if s.token != "" {
+		r.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if s.secret != "" {
+		signedBody := s.signedBody
+		if signedBody == nil {
+			signedBody = s.body
+		}
+		r.Header.Set(utils.HeaderTimestamp, strconv.FormatInt(s.timestamp.Unix(), 10))
+		r.Header.Set(utils.HeaderNonce, s.nonce)
+		r.Header.Set(utils.HeaderSignature, utils.SignRequest(s.secret, r.Method, s.path, s.timestamp.Unix(), s.nonce, signedBody))
+	}
+
+	w := httptest.NewRecorder()
+	middleware(func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+	})(w, r)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestSignRequestVector(t *testing.T) {
+	// 与 auth 包测试中的签名向量相同，保证客户端和服务器的签名格式一致
+	const want = "aebad7e23f0444f1f21d4d1dbc0576cdd55d48fab21546066c816536fd6479fe"
+	if got := utils.SignRequest("secret", http.MethodPost, "/api/heartbeat", 1700000000, "nonce-1", []byte(`{"a":1}`)); got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestRequireDeviceSignature(t *testing.T) {
+	setupTestDB(t)
+	sessions := createActiveLicense(t, "SIGN-1", "device-a", "device-b")
+	session := sessions["device-a"]
+	body := []byte(`{"hwid":"device-a"}`)
+
+	request := func(nonce string) signedRequest {
+		return signedRequest{
+			path:      "/api/heartbeat",
+			token:     session.Token,
+			secret:    session.RequestSecret,
+			body:      body,
+			timestamp: time.Now(),
+			nonce:     nonce,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(r *signedRequest)
+		wantCode int
+		wantErr  string
+	}{
+		{"valid", nil, http.StatusOK, ""},
+		{"unsigned", func(r *signedRequest) { r.secret = "" }, http.StatusBadRequest, CodeSignatureMissing},
+		{"stale", func(r *signedRequest) { r.timestamp = time.Now().Add(-utils.RequestMaxSkew - time.Minute) }, http.StatusBadRequest, CodeRequestStale},
+		{"from the future", func(r *signedRequest) { r.timestamp = time.Now().Add(utils.RequestMaxSkew + time.Minute) }, http.StatusBadRequest, CodeRequestStale},
+		{"tampered body", func(r *signedRequest) { r.signedBody = []byte(`{"hwid":"device-b"}`) }, http.StatusBadRequest, CodeSignatureInvalid},
+		{"another device's secret", func(r *signedRequest) { r.secret = sessions["device-b"].RequestSecret }, http.StatusBadRequest, CodeSignatureInvalid},
+		{"license key as secret", func(r *signedRequest) { r.secret = "SIGN-1" }, http.StatusBadRequest, CodeSignatureInvalid},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request("nonce-" + strconv.Itoa(i))
+			if tt.modify != nil {
+				tt.modify(&req)
+			}
+			code, resp := req.send(t, RequireDeviceSignature)
+			if code != tt.wantCode || (tt.wantErr != "" && resp["code"] != tt.wantErr) {
+				t.Fatalf("got %d %v, want %d %s", code, resp, tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+
+	// 签名覆盖路径：为一个接口签名的请求不能发往另一个接口
+	req := request("nonce-path")
+	r := httptest.NewRequest(http.MethodPost, "/api/deactivate", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+session.Token)
+	r.Header.Set(utils.HeaderTimestamp, strconv.FormatInt(req.timestamp.Unix(), 10))
+	r.Header.Set(utils.HeaderNonce, req.nonce)
+	r.Header.Set(utils.HeaderSignature, utils.SignRequest(req.secret, http.MethodPost, "/api/heartbeat", req.timestamp.Unix(), req.nonce, body))
+	w := httptest.NewRecorder()
+	RequireDeviceSignature(func(w http.ResponseWriter, r *http.Request) {})(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("request signed for another path: %d, want 400", w.Code)
+	}
+}
+
+func TestRequireSignatureRejectsReplay(t *testing.T) {
+	setupTestDB(t)
+	session := createActiveLicense(t, "SIGN-2", "device-a")["device-a"]
+
+	req := signedRequest{
+		path:      "/api/heartbeat",
+		token:     session.Token,
+		secret:    session.RequestSecret,
+		body:      []byte(`{}`),
+		timestamp: time.Now(),
+		nonce:     "nonce-replay",
+	}
+	if code, resp := req.send(t, RequireDeviceSignature); code != http.StatusOK {
+		t.Fatalf("first request: %d %v", code, resp)
+	}
+	code, resp := req.send(t, RequireDeviceSignature)
+	if code != http.StatusConflict || resp["code"] != CodeRequestReplayed {
+		t.Fatalf("replayed request: %d %v, want 409 %s", code, resp, CodeRequestReplayed)
+	}
+
+	// 签名无效的请求不占用随机数，伪造请求不能阻止合法请求
+	forged := req
+	forged.nonce = "nonce-forged"
+	forged.secret = "wrong-secret"
+	forged.send(t, RequireDeviceSignature)
+	valid := req
+	valid.nonce = "nonce-forged"
+	if code, resp := valid.send(t, RequireDeviceSignature); code != http.StatusOK {
+		t.Fatalf("request after forged nonce: %d %v", code, resp)
+	}
+}
+
+func TestRequireActivationSignature(t *testing.T) {
+	setupTestDB(t)
+	body, _ := json.Marshal(ActivateRequest{Key: "SIGN-3", HWID: "device-a"})
+
+	tests := []struct {
+		name     string
+		secret   string
+		wantCode int
+	}{
+		{"signed with the license key", "SIGN-3", http.StatusOK},
+		{"signed with another key", "OTHER-KEY", http.StatusBadRequest},
+		{"unsigned", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest{path: "/api/activate", secret: tt.secret, body: body, timestamp: time.Now(), nonce: "nonce-" + tt.name}
+			if code, resp := req.send(t, RequireActivationSignature); code != tt.wantCode {
+				t.Fatalf("got %d %v, want %d", code, resp, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestOptionalRequestSigning(t *testing.T) {
+	setupTestDB(t)
+	session := createActiveLicense(t, "SIGN-4", "device-a")["device-a"]
+
+	utils.RequireRequestSignature = false
+	t.Cleanup(func() { utils.RequireRequestSignature = true })
+
+	// 兼容模式允许旧版客户端不签名，但已签名的请求仍会验证
+	unsigned := signedRequest{path: "/api/heartbeat", token: session.Token, body: []byte(`{}`)}
+	if code, resp := unsigned.send(t, RequireDeviceSignature); code != http.StatusOK {
+		t.Fatalf("unsigned request in optional mode: %d %v", code, resp)
+	}
+	forged := signedRequest{path: "/api/heartbeat", token: session.Token, secret: "wrong", body: []byte(`{}`), timestamp: time.Now(), nonce: "nonce-optional"}
+	if code, resp := forged.send(t, RequireDeviceSignature); code != http.StatusBadRequest || resp["code"] != CodeSignatureInvalid {
+		t.Fatalf("forged request in optional mode: %d %v", code, resp)
+	}
+}
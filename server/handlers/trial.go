@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazywords2006/web/server/database"
+	"github.com/Lazywords2006/web/server/utils"
+)
+
+// maxProductName 产品名称的最大长度
+const maxProductName = 128
+
+// TrialRequest 试用请求
+type TrialRequest struct {
+	ProductName string             `json:"product_name"`
+	HWID        string             `json:"hwid"`
+	Fingerprint map[string]string  `json:"fingerprint,omitempty"` // 用于识别重装系统后硬件ID变化的设备
+	Environment *ClientEnvironment `json:"environment,omitempty"`
+}
+
+// TrialResponse 试用响应
+type TrialResponse struct {
+	Status        string    `json:"status"`
+	LicenseKey    string    `json:"license_key,omitempty"` // 试用许可证密钥，购买后激活正式许可证时作为 upgrade_from 发送
+	TrialExpires  time.Time `json:"trial_expires,omitempty"`
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	RequestSecret string    `json:"request_secret,omitempty"`
+	ExpiresIn     int64     `json:"expires_in,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// trialRecord 设备已有的试用记录
+type trialRecord struct {
+	LicenseKey string
+	HWID       string
+	UpgradedTo sql.NullString
+}
+
+// HandleTrial 为设备签发试用许可证，无需许可证密钥
+// 每台设备每个产品只能试用一次；试用期内重复请求（如重装软件）返回同一个试用许可证
+func HandleTrial(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondErrorCode(w, CodeInvalidRequest, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TrialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondErrorCode(w, CodeInvalidRequest, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProductName == "" || len(req.ProductName) > maxProductName || req.HWID == "" {
+		respondErrorCode(w, CodeInvalidRequest, "product_name and hwid are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.ValidateFingerprint(req.Fingerprint); err != nil {
+		respondErrorCode(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 没有指纹就无法识别重装后硬件ID变化的设备，省略指纹即可反复领取试用
+	if len(req.Fingerprint) < utils.MinMatchedComponents {
+		respondErrorCode(w, CodeInvalidRequest,
+			fmt.Sprintf("fingerprint with at least %d components is required", utils.MinMatchedComponents), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateEnvironment(req.Environment); err != nil {
+		respondErrorCode(w, CodeInvalidRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[Trial] Request: product=%q, hwid=%s... (len=%d)", req.ProductName, truncate(req.HWID, 16), len(req.HWID))
+
+	// 只有在产品策略中设置了试用天数的产品提供试用
+	trialDays, err := productTrialDays(req.ProductName)
+	if err != nil {
+		log.Printf("[Trial] ERROR: Failed to load product policy: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if trialDays <= 0 {
+		log.Printf("[Trial] REJECTED: No trial for product %q", req.ProductName)
+		respondErrorCode(w, CodeTrialUnavailable, "No trial is available for this product", http.StatusForbidden)
+		return
+	}
+
+	// 试用同样遵循产品的虚拟化策略，避免通过克隆虚拟机反复试用
+	reject, flagged, err := checkEnvironment(req.ProductName, req.Environment)
+	if err != nil {
+		log.Printf("[Trial] ERROR: Failed to load product policy: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if reject {
+		log.Printf("[Trial] REJECTED: Virtualized environment %s", req.Environment)
+		respondErrorCode(w, CodeVirtualizationDenied, "Trials are not available in a virtual machine or container", http.StatusForbidden)
+		return
+	}
+	if flagged {
+		log.Printf("[Trial] FLAGGED: Environment %s", req.Environment)
+	}
+
+	trial, err := findTrial(req.ProductName, req.HWID, req.Fingerprint)
+	if err != nil {
+		log.Printf("[Trial] ERROR: Failed to query trials: %v", err)
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var licenseKey string
+	var expiresAt time.Time
+	if trial != nil {
+		licenseKey, expiresAt, err = resumeTrial(trial, req)
+	} else {
+		licenseKey, expiresAt, err = createTrial(req, trialDays)
+	}
+	if errors.Is(err, errTrialUsed) {
+		log.Printf("[Trial] REJECTED: Trial already used on this device")
+		logActivation(licenseKey, req.HWID, "trial", r, false, "Trial already used")
+		respondErrorCode(w, CodeTrialUsed, "The trial for this product has already been used on this device", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("[Trial] ERROR: Failed to issue trial: %v", err)
+		logActivation(licenseKey, req.HWID, "trial", r, false, "Failed to issue trial")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := saveDeviceEnvironment(licenseKey, req.HWID, req.Environment, flagged); err != nil {
+		log.Printf("[Trial] WARNING: Failed to save environment: %v", err)
+	}
+
+	session, err := issueDeviceSession(licenseKey, req.HWID, expiresAt)
+	if err != nil {
+		log.Printf("[Trial] ERROR: Failed to issue session: %v", err)
+		logActivation(licenseKey, req.HWID, "trial", r, false, "Failed to issue session")
+		respondErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Trial] SUCCESS: license=%s, expires_at=%s", licenseKey, expiresAt.Format("2006-01-02"))
+	logActivation(licenseKey, req.HWID, "trial", r, true, "")
+
+	respondJSON(w, TrialResponse{
+		Status:        "success",
+		LicenseKey:    licenseKey,
+		TrialExpires:  expiresAt,
+		Token:         session.Token,
+		RefreshToken:  session.RefreshToken,
+		RequestSecret: session.RequestSecret,
+		ExpiresIn:     session.ExpiresIn(),
+	}, http.StatusOK)
+}
+
+// errTrialUsed 设备的试用已结束（过期、被封禁或已升级为正式许可证）
+var errTrialUsed = errors.New("trial already used")
+
+// productTrialDays 返回产品的试用天数，未配置时为0（不提供试用）
+func productTrialDays(productName string) (int, error) {
+	var days int
+	err := database.DB.QueryRow(`
+		SELECT COALESCE(trial_days, 0) FROM product_policies WHERE product_name = ?
+	`, productName).Scan(&days)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return days, err
+}
+
+// isTrialLicense 检查许可证是否为 /api/trial 签发的试用许可证
+func isTrialLicense(licenseKey string) (bool, error) {
+	var count int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM trials WHERE license_key = ?`, licenseKey).Scan(&count)
+	return count > 0, err
+}
+
+// findTrial 查找设备在该产品上的试用记录，先按 HWID 精确匹配，再按硬件指纹匹配
+// 重装系统会重新生成 machine-id 等信息导致 HWID 变化，但主板、磁盘等组件不变
+// 试用请求必须带指纹，因此更换 HWID 无法绕过指纹匹配
+func findTrial(productName, hwid string, fingerprint map[string]string) (*trialRecord, error) {
+	var trial trialRecord
+	err := database.DB.QueryRow(`
+		SELECT license_key, hwid, upgraded_to FROM trials WHERE product_name = ? AND hwid = ?
+	`, productName, hwid).Scan(&trial.LicenseKey, &trial.HWID, &trial.UpgradedTo)
+	if err == nil {
+		return &trial, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT license_key, hwid, upgraded_to, fingerprint FROM trials
+		WHERE product_name = ? AND fingerprint IS NOT NULL
+	`, productName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *trialRecord
+	var bestScore float64
+	for rows.Next() {
+		var candidate trialRecord
+		var data string
+		if err := rows.Scan(&candidate.LicenseKey, &candidate.HWID, &candidate.UpgradedTo, &data); err != nil {
+			continue
+		}
+
+		var stored map[string]string
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			continue
+		}
+
+		if score, ok := utils.MatchFingerprint(stored, fingerprint); ok && score > bestScore {
+			best, bestScore = &candidate, score
+		}
+	}
+
+	return best, rows.Err()
+}
+
+// createTrial 创建试用许可证并绑定到设备，试用期从现在开始计算
+// 试用记录、许可证和设备绑定在同一事务中写入，失败时不会留下没有设备的试用许可证
+func createTrial(req TrialRequest, trialDays int) (string, time.Time, error) {
+	key, err := utils.GenerateLicenseKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	licenseKey := "TRIAL-" + key
+
+	fingerprint, err := json.Marshal(req.Fingerprint)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	// 先写入试用记录，唯一约束保证并发请求只能创建一个试用
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO trials (product_name, hwid, fingerprint, license_key, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.ProductName, req.HWID, string(fingerprint), licenseKey, now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return "", time.Time{}, errTrialUsed
+	}
+
+	// 试用许可证只能用于一台设备，不允许自助转移
+	expiresAt := now.AddDate(0, 0, trialDays)
+	if _, err := tx.Exec(`
+		INSERT INTO licenses (license_key, product_name, hwid, status, max_devices, validity_days,
+		                      expires_at, activated_at, note, max_transfers, license_type)
+		VALUES (?, ?, ?, 'active', 1, ?, ?, ?, 'Trial', 0, ?)
+	`, licenseKey, req.ProductName, req.HWID, trialDays, expiresAt, now, utils.LicenseNodeLocked); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO license_devices (license_key, hwid, first_seen, last_seen, fingerprint)
+		VALUES (?, ?, ?, ?, ?)
+	`, licenseKey, req.HWID, now, now, string(fingerprint)); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", time.Time{}, err
+	}
+	return licenseKey, expiresAt, nil
+}
+
+// resumeTrial 试用期内的设备再次请求试用时返回原试用许可证
+// HWID 因重装系统变化时，将试用许可证的设备绑定和试用记录更新为新的 HWID
+func resumeTrial(trial *trialRecord, req TrialRequest) (string, time.Time, error) {
+	if trial.UpgradedTo.Valid {
+		return trial.LicenseKey, time.Time{}, errTrialUsed
+	}
+
+	var status string
+	var expiresAt time.Time
+	err := database.DB.QueryRow(`
+		SELECT status, expires_at FROM licenses WHERE license_key = ?
+	`, trial.LicenseKey).Scan(&status, &expiresAt)
+	if err == sql.ErrNoRows {
+		// 试用许可证已被管理员删除，试用记录仍然有效
+		return trial.LicenseKey, time.Time{}, errTrialUsed
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if status != "active" || time.Now().After(expiresAt) {
+		return trial.LicenseKey, time.Time{}, errTrialUsed
+	}
+
+	// 设备已被管理员移除时不再签发会话，试用记录仍然占用该设备的试用机会
+	registered, err := isDeviceRegistered(trial.LicenseKey, trial.HWID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !registered {
+		return trial.LicenseKey, time.Time{}, errTrialUsed
+	}
+
+	if trial.HWID != req.HWID {
+		if err := rebindDevice(trial.LicenseKey, trial.HWID, req.HWID, req.Fingerprint); err != nil {
+			return "", time.Time{}, err
+		}
+		fingerprint, err := json.Marshal(req.Fingerprint)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if _, err := database.DB.Exec(`
+			UPDATE trials SET hwid = ?, fingerprint = ? WHERE license_key = ?
+		`, req.HWID, string(fingerprint), trial.LicenseKey); err != nil {
+			return "", time.Time{}, err
+		}
+		log.Printf("[Trial] Device reinstalled: hwid=%s replaces %s", truncate(req.HWID, 16), truncate(trial.HWID, 16))
+	} else if err := saveDeviceFingerprint(trial.LicenseKey, req.HWID, req.Fingerprint); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return trial.LicenseKey, expiresAt, nil
+}
+
+// upgradeTrial 设备激活同一产品的正式许可证后结束其试用
+// 试用许可证设为过期并释放设备，试用记录保留，该设备不能再次试用
+func upgradeTrial(trialKey, hwid, productName, licenseKey string) error {
+	now := time.Now()
+	result, err := database.DB.Exec(`
+		UPDATE trials SET upgraded_to = ?, upgraded_at = ?
+		WHERE license_key = ? AND hwid = ? AND product_name = ? AND upgraded_to IS NULL
+	`, licenseKey, now, trialKey, hwid, productName)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("no active trial %s for this device and product", trialKey)
+	}
+
+	if _, err := database.DB.Exec(`
+		UPDATE licenses SET status = 'expired', updated_at = ? WHERE license_key = ?
+	`, now, trialKey); err != nil {
+		return err
+	}
+	return releaseDevice(trialKey, hwid)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Lazywords2006/web/server/database"
 	"github.com/Lazywords2006/web/server/handlers"
+	"github.com/Lazywords2006/web/server/utils"
 )
 
 func main() {
@@ -23,6 +24,44 @@ func main() {
 	}
 	defer database.Close()
 
+	// 加载令牌签名密钥
+	if err := utils.InitSigningKey(database.KeyStore{}); err != nil {
+		log.Fatalf("Failed to initialize signing key: %v", err)
+	}
+
+	// 加载令牌有效期配置
+	if err := utils.InitTokenTTL(); err != nil {
+		log.Fatalf("Failed to load token config: %v", err)
+	}
+
+	// 加载请求签名模式
+	if err := utils.InitRequestSigning(); err != nil {
+		log.Fatalf("Failed to load request signing config: %v", err)
+	}
+
+	// 加载硬件指纹匹配阈值
+	if err := utils.InitFingerprintMatching(); err != nil {
+		log.Fatalf("Failed to load fingerprint matching config: %v", err)
+	}
+
+	// 加载默认虚拟化策略
+	if err := utils.InitVMPolicy(); err != nil {
+		log.Fatalf("Failed to load VM policy config: %v", err)
+	}
+
+	// 加载浮动许可证席位租约时长
+	if err := utils.InitSeatLeases(); err != nil {
+		log.Fatalf("Failed to load seat lease config: %v", err)
+	}
+
+	// 加载试用请求频率限制
+	if err := utils.InitTrialRateLimit(); err != nil {
+		log.Fatalf("Failed to load trial rate limit config: %v", err)
+	}
+
+	// 预先计算登录用的占位哈希，避免首次登录失败明显变慢
+	utils.DummyPasswordHash()
+
 	// 注册路由
 	setupRoutes()
 
@@ -35,13 +74,37 @@ func main() {
 	log.Printf("[Server] Listening on http://0.0.0.0:%s", port)
 	log.Println("[Server] API Endpoints:")
 	log.Println("  POST   /api/activate        - License activation")
-	log.Println("  POST   /api/heartbeat       - Heartbeat validation")
+	log.Println("  POST   /api/trial           - Start a trial (no license key)")
+	log.Println("  POST   /api/heartbeat       - Heartbeat validation (renews floating seat lease)")
+	log.Println("  POST   /api/refresh         - Rotate access/refresh tokens")
+	log.Println("  POST   /api/deactivate      - Release device binding or floating seat")
+	log.Println("  GET    /api/health          - Health check")
+	log.Println("  GET    /.well-known/jwks.json - Token verification keys")
+	log.Println("  POST   /api/admin/login     - Admin login")
+	log.Println("  POST   /api/admin/logout    - Admin logout")
+	log.Println("  GET    /api/admin/me        - Current admin")
+	log.Println("  POST   /api/admin/password  - Change admin password")
 	log.Println("  POST   /api/admin/license   - Generate license")
 	log.Println("  GET    /api/admin/licenses  - List licenses")
 	log.Println("  GET    /api/admin/license   - Get license details")
 	log.Println("  PUT    /api/admin/license   - Update license")
 	log.Println("  DELETE /api/admin/license   - Delete license")
 	log.Println("  GET    /api/admin/stats     - Get statistics")
+	log.Println("  POST   /api/admin/offline-license - Issue offline license file")
+	log.Println("  POST   /api/admin/revoke/token   - Revoke a single access token")
+	log.Println("  POST   /api/admin/revoke/device  - Revoke all tokens of a device")
+	log.Println("  POST   /api/admin/revoke/license - Revoke all tokens of a license")
+	log.Println("  GET    /api/admin/keys      - List signing keys")
+	log.Println("  POST   /api/admin/keys      - Generate pending signing key")
+	log.Println("  POST   /api/admin/keys/promote - Promote signing key")
+	log.Println("  POST   /api/admin/keys/retire  - Retire signing key")
+	log.Println("  GET    /api/admin/products/policy - List product policies")
+	log.Println("  PUT    /api/admin/products/policy - Set product VM policy and trial days")
+	log.Println("  GET    /api/admin/products/entitlements - List product entitlements")
+	log.Println("  PUT    /api/admin/products/entitlements - Set product features and limits")
+	log.Println("  (all /api/admin/* except login require Authorization: Bearer <session token>)")
+	log.Println("  (activate/heartbeat/refresh/deactivate require X-Timestamp, X-Nonce, X-Signature)")
+	log.Println("  (activate/trial/heartbeat/refresh/deactivate responses are signed: X-Server-Timestamp, X-Server-Key-ID, X-Server-Signature)")
 	log.Println("========================================")
 
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
@@ -51,14 +114,35 @@ func main() {
 
 func setupRoutes() {
 	// 客户端API（许可证验证）
-	http.HandleFunc("/api/activate", corsMiddleware(handlers.HandleActivate))
-	http.HandleFunc("/api/heartbeat", corsMiddleware(handlers.HandleHeartbeat))
-
-	// 管理API
-	http.HandleFunc("/api/admin/license", corsMiddleware(adminRouteHandler))
-	http.HandleFunc("/api/admin/licenses", corsMiddleware(handlers.HandleListLicenses))
-	http.HandleFunc("/api/admin/licenses/batch", corsMiddleware(handlers.HandleBatchGenerateLicense))
-	http.HandleFunc("/api/admin/stats", corsMiddleware(handlers.HandleGetStats))
+	http.HandleFunc("/api/activate", corsMiddleware(handlers.SignResponses(handlers.RequireActivationSignature(handlers.HandleActivate))))
+	http.HandleFunc("/api/trial", corsMiddleware(handlers.SignResponses(handlers.RateLimit(utils.TrialLimiter, handlers.HandleTrial))))
+	http.HandleFunc("/api/heartbeat", corsMiddleware(handlers.SignResponses(handlers.RequireDeviceSignature(handlers.HandleHeartbeat))))
+	http.HandleFunc("/api/refresh", corsMiddleware(handlers.SignResponses(handlers.RequireRefreshSignature(handlers.HandleRefresh))))
+	http.HandleFunc("/api/deactivate", corsMiddleware(handlers.SignResponses(handlers.RequireDeviceSignature(handlers.HandleDeactivate))))
+
+	http.HandleFunc("/api/health", corsMiddleware(handlers.HandleHealth))
+	http.HandleFunc("/.well-known/jwks.json", corsMiddleware(handlers.HandleJWKS))
+
+	// 管理员登录（无需认证）
+	http.HandleFunc("/api/admin/login", corsMiddleware(handlers.HandleAdminLogin))
+
+	// 管理API（需要管理员会话）
+	http.HandleFunc("/api/admin/logout", corsMiddleware(handlers.RequireAdminSession(handlers.HandleAdminLogout)))
+	http.HandleFunc("/api/admin/me", corsMiddleware(handlers.RequireAdminSession(handlers.HandleAdminMe)))
+	http.HandleFunc("/api/admin/password", corsMiddleware(handlers.RequireAdminSession(handlers.HandleChangePassword)))
+	http.HandleFunc("/api/admin/license", corsMiddleware(handlers.RequireAdmin(adminRouteHandler)))
+	http.HandleFunc("/api/admin/licenses", corsMiddleware(handlers.RequireAdmin(handlers.HandleListLicenses)))
+	http.HandleFunc("/api/admin/licenses/batch", corsMiddleware(handlers.RequireAdmin(handlers.HandleBatchGenerateLicense)))
+	http.HandleFunc("/api/admin/stats", corsMiddleware(handlers.RequireAdmin(handlers.HandleGetStats)))
+	http.HandleFunc("/api/admin/offline-license", corsMiddleware(handlers.RequireAdmin(handlers.HandleOfflineLicense)))
+	http.HandleFunc("/api/admin/revoke/token", corsMiddleware(handlers.RequireAdmin(handlers.HandleRevokeToken)))
+	http.HandleFunc("/api/admin/revoke/device", corsMiddleware(handlers.RequireAdmin(handlers.HandleRevokeDevice)))
+	http.HandleFunc("/api/admin/revoke/license", corsMiddleware(handlers.RequireAdmin(handlers.HandleRevokeLicense)))
+	http.HandleFunc("/api/admin/keys", corsMiddleware(handlers.RequireAdmin(handlers.HandleSigningKeys)))
+	http.HandleFunc("/api/admin/keys/promote", corsMiddleware(handlers.RequireAdmin(handlers.HandlePromoteSigningKey)))
+	http.HandleFunc("/api/admin/keys/retire", corsMiddleware(handlers.RequireAdmin(handlers.HandleRetireSigningKey)))
+	http.HandleFunc("/api/admin/products/policy", corsMiddleware(handlers.RequireAdmin(handlers.HandleProductPolicies)))
+	http.HandleFunc("/api/admin/products/entitlements", corsMiddleware(handlers.RequireAdmin(handlers.HandleProductEntitlements)))
 
 	// 静态文件服务（前端界面）
 	fs := http.FileServer(http.Dir("./frontend"))
@@ -86,7 +170,8 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Timestamp, X-Nonce, X-Signature")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Server-Timestamp, X-Server-Key-ID, X-Server-Signature")
 
 		// 处理预检请求
 		if r.Method == http.MethodOptions {
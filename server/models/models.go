@@ -6,19 +6,41 @@ import (
 
 // License 许可证模型
 type License struct {
-	ID           int64     `json:"id" db:"id"`
-	LicenseKey   string    `json:"license_key" db:"license_key"`
-	ProductName  string    `json:"product_name" db:"product_name"`
-	HWID         string    `json:"hwid,omitempty" db:"hwid"`
-	Status       string    `json:"status" db:"status"` // active, expired, banned, unused
-	MaxDevices   int       `json:"max_devices" db:"max_devices"`
-	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
-	ActivatedAt  time.Time `json:"activated_at,omitempty" db:"activated_at"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	UserID       int64     `json:"user_id,omitempty" db:"user_id"`
-	OrderID      string    `json:"order_id,omitempty" db:"order_id"`
+	ID            int64     `json:"id" db:"id"`
+	LicenseKey    string    `json:"license_key" db:"license_key"`
+	ProductName   string    `json:"product_name" db:"product_name"`
+	HWID          string    `json:"hwid,omitempty" db:"hwid"`
+	Status        string    `json:"status" db:"status"` // active, expired, banned, unused
+	MaxDevices    int       `json:"max_devices" db:"max_devices"`
+	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
+	ActivatedAt   time.Time `json:"activated_at,omitempty" db:"activated_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	UserID        int64     `json:"user_id,omitempty" db:"user_id"`
+	OrderID       string    `json:"order_id,omitempty" db:"order_id"`
 	LastHeartbeat time.Time `json:"last_heartbeat,omitempty" db:"last_heartbeat"`
+
+	MaxTransfers          int `json:"max_transfers" db:"max_transfers"`                     // 允许自助转移次数
+	TransferCooldownHours int `json:"transfer_cooldown_hours" db:"transfer_cooldown_hours"` // 两次转移间隔（小时）
+
+	LicenseType string `json:"license_type" db:"license_type"` // node_locked 或 floating
+}
+
+// LicenseDevice 许可证绑定的设备
+type LicenseDevice struct {
+	ID         int64     `json:"id" db:"id"`
+	LicenseKey string    `json:"license_key" db:"license_key"`
+	HWID       string    `json:"hwid" db:"hwid"`
+	FirstSeen  time.Time `json:"first_seen" db:"first_seen"`
+	LastSeen   time.Time `json:"last_seen" db:"last_seen"`
+
+	// 客户端上报的运行环境（physical、vm、container），旧版客户端为空
+	Environment       string `json:"environment,omitempty" db:"environment"`
+	EnvironmentVendor string `json:"environment_vendor,omitempty" db:"environment_vendor"`
+	Flagged           bool   `json:"flagged" db:"flagged"` // 按产品策略标记为待审查
+
+	// 浮动许可证的席位租约到期时间，节点锁定许可证为空
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
 }
 
 // User 用户模型
@@ -30,6 +52,8 @@ type User struct {
 	IsAdmin   bool      `json:"is_admin" db:"is_admin"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	MustChangePassword bool `json:"must_change_password" db:"must_change_password"` // 首次登录需修改密码
 }
 
 // Order 订单模型
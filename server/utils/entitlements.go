@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// maxEntitlementNameLength 功能和限制名称的最大长度
+const maxEntitlementNameLength = 64
+
+// Entitlements 产品或许可证的授权内容：功能开关和数值限制（如 max_projects）
+// 产品上配置默认值，许可证上的同名项覆盖产品的设置，功能设为 false 可关闭产品默认开启的功能
+type Entitlements struct {
+	Features map[string]bool  `json:"features,omitempty"`
+	Limits   map[string]int64 `json:"limits,omitempty"`
+}
+
+// ParseEntitlements 解析数据库中保存的授权内容，空字符串表示没有配置
+func ParseEntitlements(value string) (Entitlements, error) {
+	var e Entitlements
+	if value == "" {
+		return e, nil
+	}
+	if err := json.Unmarshal([]byte(value), &e); err != nil {
+		return Entitlements{}, fmt.Errorf("invalid entitlements: %w", err)
+	}
+	return e, nil
+}
+
+// Encode 序列化为数据库中保存的格式，没有任何配置时返回空字符串
+func (e Entitlements) Encode() (string, error) {
+	if e.IsEmpty() {
+		return "", nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// IsEmpty 是否没有任何功能和限制
+func (e Entitlements) IsEmpty() bool {
+	return len(e.Features) == 0 && len(e.Limits) == 0
+}
+
+// Validate 检查功能和限制名称
+func (e Entitlements) Validate() error {
+	for name := range e.Features {
+		if name == "" || len(name) > maxEntitlementNameLength {
+			return fmt.Errorf("feature names must be 1-%d characters", maxEntitlementNameLength)
+		}
+	}
+	for name := range e.Limits {
+		if name == "" || len(name) > maxEntitlementNameLength {
+			return fmt.Errorf("limit names must be 1-%d characters", maxEntitlementNameLength)
+		}
+	}
+	return nil
+}
+
+// Merge 返回以 override 覆盖 e 后的授权内容，不修改原值
+func (e Entitlements) Merge(override Entitlements) Entitlements {
+	merged := Entitlements{}
+	for _, src := range []Entitlements{e, override} {
+		for name, enabled := range src.Features {
+			if merged.Features == nil {
+				merged.Features = map[string]bool{}
+			}
+			merged.Features[name] = enabled
+		}
+		for name, limit := range src.Limits {
+			if merged.Limits == nil {
+				merged.Limits = map[string]int64{}
+			}
+			merged.Limits[name] = limit
+		}
+	}
+	return merged
+}
+
+// EnabledFeatures 返回已开启的功能名称（排序），写入令牌和离线许可证文件
+func (e Entitlements) EnabledFeatures() []string {
+	features := []string{}
+	for name, enabled := range e.Features {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntitlementsMerge(t *testing.T) {
+	product := Entitlements{
+		Features: map[string]bool{"export": true, "sync": true},
+		Limits:   map[string]int64{"max_projects": 10, "max_users": 5},
+	}
+
+	tests := []struct {
+		name     string
+		product  Entitlements
+		override Entitlements
+		want     Entitlements
+	}{
+		{
+			name:    "no override",
+			product: product,
+			want:    product,
+		},
+		{
+			name:     "override adds a feature and a limit",
+			product:  product,
+			override: Entitlements{Features: map[string]bool{"beta": true}, Limits: map[string]int64{"max_storage_gb": 100}},
+			want: Entitlements{
+				Features: map[string]bool{"export": true, "sync": true, "beta": true},
+				Limits:   map[string]int64{"max_projects": 10, "max_users": 5, "max_storage_gb": 100},
+			},
+		},
+		{
+			name:     "override disables a product feature",
+			product:  product,
+			override: Entitlements{Features: map[string]bool{"sync": false}},
+			want: Entitlements{
+				Features: map[string]bool{"export": true, "sync": false},
+				Limits:   product.Limits,
+			},
+		},
+		{
+			name:     "override replaces limits, including with zero",
+			product:  product,
+			override: Entitlements{Limits: map[string]int64{"max_projects": 50, "max_users": 0}},
+			want: Entitlements{
+				Features: product.Features,
+				Limits:   map[string]int64{"max_projects": 50, "max_users": 0},
+			},
+		},
+		{
+			name:     "product without entitlements",
+			override: Entitlements{Features: map[string]bool{"export": true}},
+			want:     Entitlements{Features: map[string]bool{"export": true}},
+		},
+		{
+			name: "both empty",
+			want: Entitlements{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.product.Merge(tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Merge = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Merge 不修改产品的默认值
+	product.Merge(Entitlements{Features: map[string]bool{"export": false}, Limits: map[string]int64{"max_projects": 1}})
+	if !product.Features["export"] || product.Limits["max_projects"] != 10 {
+		t.Fatalf("Merge modified the product entitlements: %+v", product)
+	}
+}
+
+func TestEntitlementsEncode(t *testing.T) {
+	if value, err := (Entitlements{}).Encode(); err != nil || value != "" {
+		t.Fatalf("empty entitlements encoded as %q, %v", value, err)
+	}
+	if e, err := ParseEntitlements(""); err != nil || !e.IsEmpty() {
+		t.Fatalf("ParseEntitlements(\"\") = %+v, %v", e, err)
+	}
+
+	e := Entitlements{Features: map[string]bool{"export": true, "beta": false}, Limits: map[string]int64{"max_projects": 3}}
+	value, err := e.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := ParseEntitlements(value)
+	if err != nil || !reflect.DeepEqual(decoded, e) {
+		t.Fatalf("round trip = %+v, %v", decoded, err)
+	}
+
+	if _, err := ParseEntitlements("not json"); err == nil {
+		t.Fatal("invalid entitlements accepted")
+	}
+}
+
+func TestEnabledFeatures(t *testing.T) {
+	e := Entitlements{Features: map[string]bool{"sync": true, "beta": false, "export": true}}
+	if got := e.EnabledFeatures(); !reflect.DeepEqual(got, []string{"export", "sync"}) {
+		t.Fatalf("EnabledFeatures = %v", got)
+	}
+	if got := (Entitlements{}).EnabledFeatures(); got == nil || len(got) != 0 {
+		t.Fatalf("EnabledFeatures of empty entitlements = %#v, want empty slice", got)
+	}
+}
+
+func TestEntitlementsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		e       Entitlements
+		wantErr bool
+	}{
+		{"valid", Entitlements{Features: map[string]bool{"export": true}, Limits: map[string]int64{"max_projects": 1}}, false},
+		{"empty feature name", Entitlements{Features: map[string]bool{"": true}}, true},
+		{"empty limit name", Entitlements{Limits: map[string]int64{"": 1}}, true},
+		{"name too long", Entitlements{Features: map[string]bool{strings.Repeat("a", maxEntitlementNameLength+1): true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.e.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// 虚拟化策略：客户端上报运行在虚拟机或容器中时的处理方式
+const (
+	VMPolicyAllow  = "allow"  // 允许，只记录运行环境
+	VMPolicyFlag   = "flag"   // 允许，但将设备标记为待审查
+	VMPolicyReject = "reject" // 拒绝激活
+)
+
+// DefaultVMPolicy 未单独配置的产品使用的虚拟化策略，可通过 VM_POLICY 环境变量修改
+var DefaultVMPolicy = VMPolicyAllow
+
+// ValidVMPolicy 检查策略名称
+func ValidVMPolicy(policy string) bool {
+	switch policy {
+	case VMPolicyAllow, VMPolicyFlag, VMPolicyReject:
+		return true
+	}
+	return false
+}
+
+// InitVMPolicy 从环境变量加载默认虚拟化策略
+func InitVMPolicy() error {
+	policy := os.Getenv("VM_POLICY")
+	if policy == "" {
+		return nil
+	}
+	if !ValidVMPolicy(policy) {
+		return fmt.Errorf("invalid VM_POLICY: %q (expected allow, flag or reject)", policy)
+	}
+	DefaultVMPolicy = policy
+	return nil
+}
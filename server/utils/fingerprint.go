@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FingerprintWeights 硬件组件权重，组件名必须与客户端 hwid 包保持一致
+// 主板、平台UUID、整机序列号很少单独更换，权重最高；CPU 型号在同型号机器间相同，权重最低
+var FingerprintWeights = map[string]int{
+	"board":         3,
+	"platform_uuid": 3,
+	"serial":        3,
+	"machine_id":    2,
+	"disk":          2,
+	"cpu":           1,
+}
+
+// defaultComponentWeight 未知组件（新版客户端新增）的权重
+const defaultComponentWeight = 1
+
+// FingerprintMatchThreshold 判定为同一台设备所需的匹配权重占比
+// 可通过 HWID_MATCH_THRESHOLD 修改（0-1），设为 0 关闭模糊匹配，只按 HWID 识别设备
+var FingerprintMatchThreshold = 0.6
+
+// MinMatchedComponents 至少匹配的组件数，避免只剩一个组件时单凭它就判定为同一台设备
+const MinMatchedComponents = 2
+
+// 客户端指纹的大小限制
+const (
+	maxFingerprintComponents = 16
+	maxFingerprintValueLen   = 128
+)
+
+// InitFingerprintMatching 从环境变量加载指纹匹配阈值
+func InitFingerprintMatching() error {
+	value := os.Getenv("HWID_MATCH_THRESHOLD")
+	if value == "" {
+		return nil
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return fmt.Errorf("invalid HWID_MATCH_THRESHOLD: %q (expected 0-1)", value)
+	}
+	FingerprintMatchThreshold = threshold
+	return nil
+}
+
+// ValidateFingerprint 检查客户端上报的指纹格式
+func ValidateFingerprint(fingerprint map[string]string) error {
+	if len(fingerprint) > maxFingerprintComponents {
+		return fmt.Errorf("too many fingerprint components (max %d)", maxFingerprintComponents)
+	}
+	for name, value := range fingerprint {
+		if name == "" || len(name) > maxFingerprintValueLen || len(value) > maxFingerprintValueLen {
+			return fmt.Errorf("invalid fingerprint component %q", name)
+		}
+	}
+	return nil
+}
+
+// MatchFingerprint 计算当前指纹与已保存指纹的匹配度
+// 以已保存的组件为准，当前缺少的组件视为不匹配；返回匹配权重占比以及是否达到阈值
+func MatchFingerprint(stored, current map[string]string) (float64, bool) {
+	if FingerprintMatchThreshold <= 0 || len(stored) == 0 {
+		return 0, false
+	}
+
+	var total, matched, count int
+	for name, value := range stored {
+		weight, ok := FingerprintWeights[name]
+		if !ok {
+			weight = defaultComponentWeight
+		}
+		total += weight
+
+		if value != "" && current[name] == value {
+			matched += weight
+			count++
+		}
+	}
+
+	score := float64(matched) / float64(total)
+	return score, count >= MinMatchedComponents && score >= FingerprintMatchThreshold
+}
@@ -0,0 +1,41 @@
+package utils
+
+import "testing"
+
+func TestMatchFingerprint(t *testing.T) {
+	// 总权重 10：board 3、disk 2、machine_id 2、cpu 1、mac 1（未知组件）、gpu 1（未知组件）
+	stored := map[string]string{
+		"board": "b", "disk": "d", "machine_id": "m", "cpu": "c", "mac": "n", "gpu": "g",
+	}
+
+	tests := []struct {
+		name      string
+		stored    map[string]string
+		current   map[string]string
+		threshold float64
+		wantScore float64
+		wantMatch bool
+	}{
+		{"identical", stored, stored, 0.6, 1, true},
+		{"exactly at threshold", stored, map[string]string{"board": "b", "disk": "d", "cpu": "c"}, 0.6, 0.6, true},
+		{"below threshold", stored, map[string]string{"board": "b", "disk": "d"}, 0.6, 0.5, false},
+		{"changed components do not count", stored, map[string]string{"board": "x", "disk": "d", "machine_id": "m", "cpu": "c"}, 0.6, 0.5, false},
+		{"higher threshold", stored, map[string]string{"board": "b", "disk": "d", "cpu": "c"}, 0.7, 0.6, false},
+		{"single component is not enough", map[string]string{"board": "b"}, map[string]string{"board": "b"}, 0.6, 1, false},
+		{"two components meet the minimum", map[string]string{"board": "b", "cpu": "c"}, map[string]string{"board": "b", "cpu": "c"}, 0.6, 1, true},
+		{"empty values never match", map[string]string{"board": "", "cpu": ""}, map[string]string{"board": "", "cpu": ""}, 0.6, 0, false},
+		{"nothing stored", nil, stored, 0.6, 0, false},
+		{"matching disabled", stored, stored, 0, 0, false},
+	}
+
+	defer func(threshold float64) { FingerprintMatchThreshold = threshold }(FingerprintMatchThreshold)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			FingerprintMatchThreshold = tt.threshold
+			score, match := MatchFingerprint(tt.stored, tt.current)
+			if score != tt.wantScore || match != tt.wantMatch {
+				t.Fatalf("MatchFingerprint = %v, %v, want %v, %v", score, match, tt.wantScore, tt.wantMatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 签名密钥状态
+const (
+	KeyStatusPending = "pending" // 已生成并发布公钥，尚未用于签名
+	KeyStatusActive  = "active"  // 当前签名密钥（唯一）
+	KeyStatusVerify  = "verify"  // 已轮换下来的旧密钥，仅用于验证未过期的令牌
+	KeyStatusRetired = "retired" // 已停用，不再验证
+)
+
+// DefaultMaxPreviousKeys 默认保留的旧验证密钥数量
+const DefaultMaxPreviousKeys = 3
+
+// DefaultKeyRollout 待启用密钥生成后至少等待多久才能提升
+// 已发布的客户端只信任编译时嵌入的公钥，提前提升会使尚未更新的客户端拒绝所有响应
+const DefaultKeyRollout = 7 * 24 * time.Hour
+
+// SigningKey 令牌签名密钥
+type SigningKey struct {
+	KID        string
+	PrivateKey ed25519.PrivateKey
+	Status     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// PublicKey 返回对应的公钥
+func (k *SigningKey) PublicKey() ed25519.PublicKey {
+	return k.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+// KeyStore 签名密钥持久化接口（由 database 包实现）
+type KeyStore interface {
+	LoadSigningKeys() ([]*SigningKey, error)
+	SaveSigningKeys(keys ...*SigningKey) error // 全部保存成功或全部不保存
+}
+
+// Keyring 签名密钥环
+// 保存一个签名密钥和最多 maxPrevious 个旧验证密钥，轮换时旧令牌仍可通过 kid 验证
+type Keyring struct {
+	mu          sync.RWMutex
+	keys        []*SigningKey
+	store       KeyStore
+	maxPrevious int
+	rollout     time.Duration // 待启用密钥提升前的最短发布时间
+}
+
+// keyring 全局密钥环
+var keyring = &Keyring{maxPrevious: DefaultMaxPreviousKeys, rollout: DefaultKeyRollout}
+
+// InitSigningKey 初始化令牌签名密钥环
+// 数据库中已有密钥时直接加载；否则从环境变量 SIGNING_KEY（PEM 或 base64 种子）
+// 或 SIGNING_KEY_PATH 指向的 PEM 文件（默认 ./signing_key.pem，不存在时自动生成）导入首个密钥
+// SIGNING_KEY_MAX_PREVIOUS 设置保留的旧验证密钥数量（默认3）
+// SIGNING_KEY_ROLLOUT 设置待启用密钥提升前的最短发布时间（默认168h）
+func InitSigningKey(store KeyStore) error {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	keyring.store = store
+	if env := os.Getenv("SIGNING_KEY_MAX_PREVIOUS"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid SIGNING_KEY_MAX_PREVIOUS: %q", env)
+		}
+		keyring.maxPrevious = n
+	}
+	if env := os.Getenv("SIGNING_KEY_ROLLOUT"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid SIGNING_KEY_ROLLOUT: %q", env)
+		}
+		keyring.rollout = d
+	}
+
+	keys, err := store.LoadSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	if len(keys) > 0 {
+		keyring.keys = keys
+		if keyring.activeLocked() == nil {
+			return fmt.Errorf("no active signing key in keyring")
+		}
+		log.Printf("[Keys] Loaded %d signing keys from database", len(keys))
+		logPublicKey(keyring.activeLocked())
+		return nil
+	}
+
+	// 首次启动：导入或生成首个密钥
+	privateKey, err := loadBootstrapKey()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key := &SigningKey{
+		KID:        KeyID(privateKey.Public().(ed25519.PublicKey)),
+		PrivateKey: privateKey,
+		Status:     KeyStatusActive,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := store.SaveSigningKeys(key); err != nil {
+		return fmt.Errorf("failed to save signing key: %w", err)
+	}
+
+	keyring.keys = []*SigningKey{key}
+	logPublicKey(key)
+	return nil
+}
+
+// loadBootstrapKey 从环境变量或文件读取首个签名密钥
+func loadBootstrapKey() (ed25519.PrivateKey, error) {
+	if env := os.Getenv("SIGNING_KEY"); env != "" {
+		key, err := ParsePrivateKey([]byte(env))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNING_KEY: %w", err)
+		}
+		log.Println("[Keys] Signing key loaded from SIGNING_KEY")
+		return key, nil
+	}
+
+	path := os.Getenv("SIGNING_KEY_PATH")
+	if path == "" {
+		path = "./signing_key.pem"
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key file %s: %w", path, err)
+		}
+		log.Printf("[Keys] Signing key loaded from %s", path)
+		return key, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read signing key file %s: %w", path, err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	pemData, err := EncodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, pemData, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key file %s: %w", path, err)
+	}
+
+	log.Printf("[Keys] Generated new signing key: %s", path)
+	return key, nil
+}
+
+// activeLocked 返回当前签名密钥（调用方需持有锁）
+func (k *Keyring) activeLocked() *SigningKey {
+	for _, key := range k.keys {
+		if key.Status == KeyStatusActive {
+			return key
+		}
+	}
+	return nil
+}
+
+// findLocked 按 kid 查找密钥（调用方需持有锁）
+func (k *Keyring) findLocked(kid string) *SigningKey {
+	for _, key := range k.keys {
+		if key.KID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// ActiveSigningKey 返回当前签名密钥
+func ActiveSigningKey() *SigningKey {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+	return keyring.activeLocked()
+}
+
+// VerificationKey 按 kid 返回可用于验证的公钥（active 或 verify 状态）
+func VerificationKey(kid string) (ed25519.PublicKey, bool) {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	key := keyring.findLocked(kid)
+	if key == nil || (key.Status != KeyStatusActive && key.Status != KeyStatusVerify) {
+		return nil, false
+	}
+	return key.PublicKey(), true
+}
+
+// SigningPublicKey 返回当前签名密钥对应的公钥
+func SigningPublicKey() ed25519.PublicKey {
+	key := ActiveSigningKey()
+	if key == nil {
+		return nil
+	}
+	return key.PublicKey()
+}
+
+// ListSigningKeys 返回密钥环中的所有密钥（按创建时间倒序）
+func ListSigningKeys() []*SigningKey {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	keys := make([]*SigningKey, len(keyring.keys))
+	copy(keys, keyring.keys)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// GenerateSigningKey 生成新的待启用密钥
+// 新公钥会立即出现在 JWKS 中，便于客户端在轮换前获取
+func GenerateSigningKey() (*SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	now := time.Now()
+	key := &SigningKey{
+		KID:        KeyID(privateKey.Public().(ed25519.PublicKey)),
+		PrivateKey: privateKey,
+		Status:     KeyStatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	if err := keyring.store.SaveSigningKeys(key); err != nil {
+		return nil, fmt.Errorf("failed to save signing key: %w", err)
+	}
+
+	keyring.keys = append(keyring.keys, key)
+	log.Printf("[Keys] Generated pending signing key %s", key.KID)
+	return key, nil
+}
+
+// ErrKeyRolloutPending 待启用密钥发布时间不足，尚未更新的客户端不信任该密钥
+var ErrKeyRolloutPending = errors.New("signing key has not been published long enough")
+
+// PromoteSigningKey 将待启用密钥设为签名密钥
+// 原签名密钥降级为验证密钥，超过保留数量的最旧验证密钥自动停用
+// 待启用密钥生成不足 SIGNING_KEY_ROLLOUT 时返回 ErrKeyRolloutPending，
+// 此时提升会使只嵌入旧公钥的客户端拒绝所有响应并在离线宽限期后停止运行；
+// force 跳过该检查，仅用于私钥泄露等必须立即轮换的情况
+func PromoteSigningKey(kid string, force bool) error {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	key := keyring.findLocked(kid)
+	if key == nil {
+		return fmt.Errorf("signing key %s not found", kid)
+	}
+	if key.Status == KeyStatusActive {
+		return nil
+	}
+	if key.Status == KeyStatusRetired {
+		return fmt.Errorf("signing key %s is retired", kid)
+	}
+	if key.Status == KeyStatusPending && !force {
+		if wait := key.CreatedAt.Add(keyring.rollout).Sub(time.Now()); wait > 0 {
+			return fmt.Errorf("%w: %s must be embedded in released clients first (promotable in %s)",
+				ErrKeyRolloutPending, kid, wait.Round(time.Minute))
+		}
+	}
+
+	// 先计算各密钥的新状态并持久化，保存成功后才修改内存中的密钥环
+	// 否则保存失败时服务器会使用重启后不会加载的密钥签名
+	now := time.Now()
+	newStatus := map[*SigningKey]string{key: KeyStatusActive}
+
+	// 按降级时间从新到旧保留 maxPrevious 个验证密钥，刚降级的原签名密钥最新
+	var previous, verifying []*SigningKey
+	if current := keyring.activeLocked(); current != nil {
+		newStatus[current] = KeyStatusVerify
+		previous = append(previous, current)
+	}
+	for _, k := range keyring.keys {
+		if k.Status == KeyStatusVerify {
+			verifying = append(verifying, k)
+		}
+	}
+	sort.Slice(verifying, func(i, j int) bool {
+		return verifying[i].UpdatedAt.After(verifying[j].UpdatedAt)
+	})
+	previous = append(previous, verifying...)
+	for i := keyring.maxPrevious; i < len(previous); i++ {
+		newStatus[previous[i]] = KeyStatusRetired
+	}
+
+	changed := make([]*SigningKey, 0, len(newStatus))
+	for k, status := range newStatus {
+		next := *k
+		next.Status = status
+		next.UpdatedAt = now
+		changed = append(changed, &next)
+	}
+	if err := keyring.store.SaveSigningKeys(changed...); err != nil {
+		return fmt.Errorf("failed to save signing keys: %w", err)
+	}
+
+	for k, status := range newStatus {
+		k.Status = status
+		k.UpdatedAt = now
+		if status == KeyStatusRetired {
+			log.Printf("[Keys] Retired signing key %s (keyring limit %d)", k.KID, keyring.maxPrevious)
+		}
+	}
+	log.Printf("[Keys] Promoted signing key %s", kid)
+	return nil
+}
+
+// RetireSigningKey 停用密钥，此后由该密钥签发的令牌将无法通过验证
+func RetireSigningKey(kid string) error {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	key := keyring.findLocked(kid)
+	if key == nil {
+		return fmt.Errorf("signing key %s not found", kid)
+	}
+	if key.Status == KeyStatusActive {
+		return fmt.Errorf("cannot retire the active signing key, promote another key first")
+	}
+	if key.Status == KeyStatusRetired {
+		return nil
+	}
+
+	next := *key
+	next.Status = KeyStatusRetired
+	next.UpdatedAt = time.Now()
+	if err := keyring.store.SaveSigningKeys(&next); err != nil {
+		return fmt.Errorf("failed to save signing key %s: %w", kid, err)
+	}
+	*key = next
+
+	log.Printf("[Keys] Retired signing key %s", kid)
+	return nil
+}
+
+// KeyID 计算公钥的 JWK 指纹（RFC 7638），作为 kid
+func KeyID(publicKey ed25519.PublicKey) string {
+	thumbprint := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(publicKey))
+	hash := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// ParsePrivateKey 解析 PKCS#8 PEM 或 base64 编码的32字节种子
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 key: %w", err)
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key is not an Ed25519 private key")
+		}
+		return key, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key is neither PEM nor base64: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// EncodePrivateKey 将私钥编码为 PKCS#8 PEM
+func EncodePrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK Ed25519 公钥的 JWK 表示（RFC 8037）
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKS 公钥集合
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS 返回待启用、签名和验证状态的公钥集合
+func PublicJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ListSigningKeys() {
+		if key.Status == KeyStatusRetired {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey()),
+			Kid: key.KID,
+			Alg: "EdDSA",
+			Use: "sig",
+		})
+	}
+	return jwks
+}
+
+// logPublicKey 输出 base64 公钥，便于嵌入客户端（auth.PublicKey）
+func logPublicKey(key *SigningKey) {
+	log.Printf("[Keys] Active key %s, public key (embed in client): %s",
+		key.KID, base64.StdEncoding.EncodeToString(key.PublicKey()))
+}
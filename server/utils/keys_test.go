@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memKeyStore 内存密钥存储，fail 为 true 时保存失败
+type memKeyStore struct {
+	saved map[string]string
+	fail  bool
+}
+
+func (s *memKeyStore) LoadSigningKeys() ([]*SigningKey, error) {
+	return nil, nil
+}
+
+func (s *memKeyStore) SaveSigningKeys(keys ...*SigningKey) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	for _, k := range keys {
+		s.saved[k.KID] = k.Status
+	}
+	return nil
+}
+
+func initTestKeyring(t *testing.T) *memKeyStore {
+	t.Helper()
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	t.Setenv("SIGNING_KEY", base64.StdEncoding.EncodeToString(privateKey.Seed()))
+	t.Setenv("SIGNING_KEY_MAX_PREVIOUS", "1")
+	t.Setenv("SIGNING_KEY_ROLLOUT", "0")
+
+	keyring = &Keyring{maxPrevious: DefaultMaxPreviousKeys, rollout: DefaultKeyRollout}
+	store := &memKeyStore{saved: map[string]string{}}
+	if err := InitSigningKey(store); err != nil {
+		t.Fatalf("InitSigningKey: %v", err)
+	}
+	return store
+}
+
+func TestPromoteSigningKeySaveFailureKeepsKeyring(t *testing.T) {
+	store := initTestKeyring(t)
+	original := ActiveSigningKey().KID
+
+	pending, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+
+	store.fail = true
+	if err := PromoteSigningKey(pending.KID, false); err == nil {
+		t.Fatal("PromoteSigningKey succeeded although the store failed")
+	}
+	if got := ActiveSigningKey().KID; got != original {
+		t.Fatalf("active key changed to %s after failed save", got)
+	}
+	if pending.Status != KeyStatusPending {
+		t.Fatalf("pending key status = %s after failed save", pending.Status)
+	}
+
+	store.fail = false
+	if err := PromoteSigningKey(pending.KID, false); err != nil {
+		t.Fatalf("PromoteSigningKey: %v", err)
+	}
+	if got := ActiveSigningKey().KID; got != pending.KID {
+		t.Fatalf("active key = %s, want %s", got, pending.KID)
+	}
+	if store.saved[pending.KID] != KeyStatusActive || store.saved[original] != KeyStatusVerify {
+		t.Fatalf("stored statuses = %v", store.saved)
+	}
+}
+
+func TestPromoteSigningKeyRetiresBeyondLimit(t *testing.T) {
+	store := initTestKeyring(t)
+	first := ActiveSigningKey().KID
+
+	for i := 0; i < 2; i++ {
+		key, err := GenerateSigningKey()
+		if err != nil {
+			t.Fatalf("GenerateSigningKey: %v", err)
+		}
+		if err := PromoteSigningKey(key.KID, false); err != nil {
+			t.Fatalf("PromoteSigningKey: %v", err)
+		}
+	}
+
+	// 保留1个验证密钥，最早的签名密钥应被停用
+	if store.saved[first] != KeyStatusRetired {
+		t.Fatalf("first key status = %s, want retired", store.saved[first])
+	}
+	if _, ok := VerificationKey(first); ok {
+		t.Fatal("retired key still usable for verification")
+	}
+}
+
+func TestPromoteSigningKeyWaitsForRollout(t *testing.T) {
+	initTestKeyring(t)
+	keyring.rollout = time.Hour
+	original := ActiveSigningKey().KID
+
+	pending, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+
+	// 刚发布的公钥还没有嵌入已发布的客户端，提升后这些客户端会拒绝所有响应
+	if err := PromoteSigningKey(pending.KID, false); !errors.Is(err, ErrKeyRolloutPending) {
+		t.Fatalf("PromoteSigningKey = %v, want ErrKeyRolloutPending", err)
+	}
+	if got := ActiveSigningKey().KID; got != original {
+		t.Fatalf("active key changed to %s during rollout", got)
+	}
+
+	pending.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := PromoteSigningKey(pending.KID, false); err != nil {
+		t.Fatalf("PromoteSigningKey after rollout: %v", err)
+	}
+
+	// 私钥泄露时可以强制立即轮换
+	emergency, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	if err := PromoteSigningKey(emergency.KID, true); err != nil {
+		t.Fatalf("forced PromoteSigningKey: %v", err)
+	}
+	if got := ActiveSigningKey().KID; got != emergency.KID {
+		t.Fatalf("active key = %s, want %s", got, emergency.KID)
+	}
+}
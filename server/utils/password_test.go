@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$2a$12$") {
+		t.Fatalf("hash %q does not encode the algorithm and cost", hash)
+	}
+	if !CheckPassword(hash, "correct horse") || CheckPassword(hash, "wrong") {
+		t.Fatal("CheckPassword does not match the hashed password")
+	}
+
+	// 相同密码每次使用不同的盐值
+	if again, _ := HashPassword("correct horse"); again == hash {
+		t.Fatal("hash is not salted")
+	}
+
+	// 明文不能作为哈希通过验证
+	if CheckPassword("correct horse", "correct horse") {
+		t.Fatal("plaintext stored password accepted")
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	current, _ := HashPassword("password")
+	weak, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	tests := []struct {
+		name       string
+		stored     string
+		wantHash   bool
+		wantRehash bool
+	}{
+		{"current cost", current, true, false},
+		{"old cost", string(weak), true, true},
+		{"plaintext", "admin123", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPasswordHash(tt.stored); got != tt.wantHash {
+				t.Errorf("IsPasswordHash = %v, want %v", got, tt.wantHash)
+			}
+			if got := PasswordNeedsRehash(tt.stored); got != tt.wantRehash {
+				t.Errorf("PasswordNeedsRehash = %v, want %v", got, tt.wantRehash)
+			}
+		})
+	}
+}
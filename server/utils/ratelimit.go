@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TrialRateLimit 每个 IP 每小时最多发起的试用请求数，可通过 TRIAL_RATE_LIMIT 修改，0 表示不限制
+// 试用接口无需密钥也无法签名，限制频率避免批量伪造硬件ID领取试用
+var TrialRateLimit = 10
+
+// TrialLimiter 试用接口的限流器，InitTrialRateLimit 之后可用；为 nil 时不限制
+var TrialLimiter *RateLimiter
+
+// InitTrialRateLimit 从环境变量加载试用请求频率限制
+func InitTrialRateLimit() error {
+	if value := os.Getenv("TRIAL_RATE_LIMIT"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid TRIAL_RATE_LIMIT: %q (expected requests per hour, 0 to disable)", value)
+		}
+		TrialRateLimit = n
+	}
+
+	TrialLimiter = nil
+	if TrialRateLimit > 0 {
+		TrialLimiter = NewRateLimiter(TrialRateLimit, time.Hour)
+	}
+	return nil
+}
+
+// RateLimiter 固定时间窗口的请求计数器，按键（如客户端 IP）分别计数
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	windows   map[string]*rateWindow
+	nextSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter 创建每个窗口最多允许 limit 次请求的限流器
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: map[string]*rateWindow{},
+	}
+}
+
+// Allow 记录一次请求，超出限制时返回 false 和距离窗口结束的时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweepLocked(now)
+
+	w := l.windows[key]
+	if w == nil || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// sweepLocked 每个窗口清理一次已结束的计数，避免内存随不同的键无限增长（调用方需持有锁）
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.nextSweep = now.Add(l.window)
+}
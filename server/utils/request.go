@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 请求签名头
+const (
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// RequestMaxSkew 请求时间戳允许的最大偏差，超出视为过期请求
+// 随机数只需保存同样长的时间即可防止重放
+const RequestMaxSkew = 5 * time.Minute
+
+// RequireRequestSignature 是否拒绝未签名的客户端请求
+// 通过 REQUEST_SIGNING=optional 临时允许旧版客户端（已签名的请求仍会验证）
+var RequireRequestSignature = true
+
+// InitRequestSigning 从环境变量加载请求签名模式
+func InitRequestSigning() error {
+	switch mode := os.Getenv("REQUEST_SIGNING"); mode {
+	case "", "required":
+		RequireRequestSignature = true
+	case "optional":
+		RequireRequestSignature = false
+	default:
+		return fmt.Errorf("invalid REQUEST_SIGNING: %q (expected required or optional)", mode)
+	}
+	return nil
+}
+
+// GenerateRequestSecret 生成激活时下发给设备的请求签名密钥
+func GenerateRequestSecret() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// SignRequest 计算请求签名
+// 签名内容为 "METHOD\nPATH\nTIMESTAMP\nNONCE\nSHA256(BODY)"，使用 HMAC-SHA256，必须与客户端保持一致
+func SignRequest(secret, method, path string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	message := method + "\n" + path + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature 使用常量时间比较验证请求签名
+func VerifyRequestSignature(secret, method, path string, timestamp int64, nonce string, body []byte, signature string) bool {
+	expected := SignRequest(secret, method, path, timestamp, nonce, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// 响应签名头
+const (
+	HeaderServerTimestamp = "X-Server-Timestamp"
+	HeaderServerKeyID     = "X-Server-Key-ID"
+	HeaderServerSignature = "X-Server-Signature"
+)
+
+// responseMessage 响应签名内容 "STATUS\nPATH\nNONCE\nTIMESTAMP\nSHA256(BODY)"，必须与客户端保持一致
+func responseMessage(statusCode int, path, nonce string, timestamp int64, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	message := strconv.Itoa(statusCode) + "\n" + path + "\n" + nonce + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + hex.EncodeToString(bodyHash[:])
+	return []byte(message)
+}
+
+// SignResponse 使用当前令牌签名密钥对响应签名
+// 签名包含客户端请求的随机数，客户端用嵌入的公钥验证，伪造的服务器既无法签名也无法重放旧响应
+func SignResponse(statusCode int, path, nonce string, timestamp int64, body []byte) (kid, signature string, err error) {
+	key := ActiveSigningKey()
+	if key == nil {
+		return "", "", errors.New("no active signing key")
+	}
+
+	sig := ed25519.Sign(key.PrivateKey, responseMessage(statusCode, path, nonce, timestamp, body))
+	return key.KID, base64.RawURLEncoding.EncodeToString(sig), nil
+}
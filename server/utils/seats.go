@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// 许可证类型
+const (
+	LicenseNodeLocked = "node_locked" // 绑定到具体设备，最多 max_devices 台
+	LicenseFloating   = "floating"    // 任意设备可用，同时最多 max_devices 台（席位租约）
+)
+
+// SeatLeaseTTL 浮动许可证席位租约时长，每次心跳续期，可通过 SEAT_LEASE_TTL 环境变量修改（如 "5m"）
+// 应大于客户端心跳间隔的数倍，避免偶尔的网络故障导致席位被释放
+var SeatLeaseTTL = 5 * time.Minute
+
+// ValidLicenseType 检查许可证类型名称
+func ValidLicenseType(licenseType string) bool {
+	switch licenseType {
+	case LicenseNodeLocked, LicenseFloating:
+		return true
+	}
+	return false
+}
+
+// InitSeatLeases 从环境变量加载席位租约时长
+func InitSeatLeases() error {
+	value := os.Getenv("SEAT_LEASE_TTL")
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Minute {
+		return fmt.Errorf("invalid SEAT_LEASE_TTL: %q (expected a duration of at least 1m)", value)
+	}
+	SeatLeaseTTL = d
+	return nil
+}
@@ -1,17 +1,19 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-)
-
-const (
-	JWTSecret = "your-secret-key-change-in-production" // 生产环境必须更换
+	"golang.org/x/crypto/bcrypt"
 )
 
 // GenerateLicenseKey 生成许可证密钥
@@ -47,17 +49,84 @@ func GenerateOrderID() (string, error) {
 	return "ORD-" + strings.ToUpper(hex.EncodeToString(bytes)), nil
 }
 
+// AccessTokenTTL 访问令牌有效期，可通过 ACCESS_TOKEN_TTL 环境变量修改（如 "15m"）
+var AccessTokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL 刷新令牌有效期，每次刷新重新计算，可通过 REFRESH_TOKEN_TTL 修改（如 "720h"）
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+// InitTokenTTL 从环境变量加载令牌有效期
+func InitTokenTTL() error {
+	for env, ttl := range map[string]*time.Duration{
+		"ACCESS_TOKEN_TTL":  &AccessTokenTTL,
+		"REFRESH_TOKEN_TTL": &RefreshTokenTTL,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s: %q", env, value)
+		}
+		*ttl = d
+	}
+	return nil
+}
+
+// AccessTokenExpiry 返回访问令牌过期时间，不超过许可证过期时间
+func AccessTokenExpiry(licenseExpiry time.Time) time.Time {
+	expiry := time.Now().Add(AccessTokenTTL)
+	if !licenseExpiry.IsZero() && licenseExpiry.Before(expiry) {
+		return licenseExpiry
+	}
+	return expiry
+}
+
+// GenerateRefreshToken 生成刷新令牌，数据库中只保存其哈希
+func GenerateRefreshToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "rt_" + hex.EncodeToString(bytes), nil
+}
+
 // GenerateJWT 生成JWT令牌
-func GenerateJWT(licenseKey, hwid string, expiresAt time.Time) (string, error) {
+// 使用密钥环中的签名密钥（Ed25519/EdDSA）签名，并在头部写入 kid 以支持密钥轮换
+// entitlements 为许可证生效的授权内容，写入 features / limits 声明，客户端据此开关功能
+func GenerateJWT(licenseKey, hwid string, entitlements Entitlements, expiresAt time.Time) (string, error) {
+	key := ActiveSigningKey()
+	if key == nil {
+		return "", fmt.Errorf("signing key not initialized")
+	}
+
+	// jti 唯一标识每个令牌，用于单独吊销
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	// iat 按标准为整秒，iat_ms 记录毫秒精度的签发时间，供吊销时区分同一秒内吊销前后签发的令牌
+	now := time.Now()
 	claims := jwt.MapClaims{
+		"jti":         hex.EncodeToString(jti),
 		"license_key": licenseKey,
 		"hwid":        hwid,
 		"exp":         expiresAt.Unix(),
-		"iat":         time.Now().Unix(),
+		"iat":         now.Unix(),
+		"iat_ms":      now.UnixMilli(),
+	}
+	if features := entitlements.EnabledFeatures(); len(features) > 0 {
+		claims["features"] = features
+	}
+	if len(entitlements.Limits) > 0 {
+		claims["limits"] = entitlements.Limits
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(JWTSecret))
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	tokenString, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -66,13 +135,29 @@ func GenerateJWT(licenseKey, hwid string, expiresAt time.Time) (string, error) {
 }
 
 // ValidateJWT 验证JWT令牌
+// 按头部 kid 在密钥环中查找验证密钥；没有 kid 的旧令牌使用当前签名密钥验证
 func ValidateJWT(tokenString string) (*jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// 验证签名方法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(JWTSecret), nil
+
+		// 离线许可证文件使用同一密钥签名，不能当作在线令牌使用
+		if typ, _ := token.Header["typ"].(string); typ != "JWT" {
+			return nil, fmt.Errorf("unexpected token type: %v", token.Header["typ"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return SigningPublicKey(), nil
+		}
+
+		publicKey, ok := VerificationKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown or retired signing key: %s", kid)
+		}
+		return publicKey, nil
 	})
 
 	if err != nil {
@@ -86,16 +171,124 @@ func ValidateJWT(tokenString string) (*jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
-// HashPassword 密码加密（简化版，生产环境应使用bcrypt）
-func HashPassword(password string) string {
-	// TODO: 生产环境使用 bcrypt.GenerateFromPassword
-	return password // 临时实现
+// LicenseFileType 离线许可证文件的 JWT 头部 typ
+const LicenseFileType = "license"
+
+// GenerateLicenseFile 生成离线许可证文件（EdDSA 签名的 JWT，typ 为 license）
+// 客户端使用嵌入的公钥在本地验证，无需联网
+func GenerateLicenseFile(licenseKey, hwid, product string, features []string, limits map[string]int64, expiresAt time.Time) (string, error) {
+	key := ActiveSigningKey()
+	if key == nil {
+		return "", fmt.Errorf("signing key not initialized")
+	}
+
+	if features == nil {
+		features = []string{}
+	}
+
+	claims := jwt.MapClaims{
+		"license_key": licenseKey,
+		"hwid":        hwid,
+		"product":     product,
+		"features":    features,
+		"exp":         expiresAt.Unix(),
+		"iat":         time.Now().Unix(),
+	}
+	if len(limits) > 0 {
+		claims["limits"] = limits
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["typ"] = LicenseFileType
+	token.Header["kid"] = key.KID
+	tokenString, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign license file: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// VerifyOfflineRequest 验证客户端离线激活请求的签名
+// 签名为 HMAC-SHA256(license_key, "license_key\nhwid\ncreated_at")，必须与客户端保持一致
+// 不知道许可证密钥的人无法在修改请求（如替换 HWID）后重新签名
+func VerifyOfflineRequest(licenseKey, hwid string, createdAt int64, signature string) error {
+	rawSig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid request signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(licenseKey))
+	fmt.Fprintf(mac, "%s\n%s\n%d", licenseKey, hwid, createdAt)
+	if !hmac.Equal(mac.Sum(nil), rawSig) {
+		return fmt.Errorf("request signature verification failed")
+	}
+
+	return nil
+}
+
+// PasswordCost bcrypt 计算成本
+// 修改后，旧哈希会在用户下次登录时自动按新成本重新计算
+const PasswordCost = 12
+
+// HashPassword 使用 bcrypt 加密密码
+// 返回的哈希自带算法版本、成本和盐值，例如 $2a$12$...
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
 }
 
 // CheckPassword 验证密码
 func CheckPassword(hashedPassword, password string) bool {
-	// TODO: 生产环境使用 bcrypt.CompareHashAndPassword
-	return hashedPassword == password // 临时实现
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// DummyPasswordHash 返回与真实密码相同成本的占位哈希
+// 用户不存在时仍与其比较一次，使登录响应时间不暴露用户名是否存在
+func DummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		if hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)), PasswordCost); err == nil {
+			dummyHash = string(hash)
+		}
+	})
+	return dummyHash
+}
+
+// IsPasswordHash 判断存储的密码是否为 bcrypt 哈希（用于识别旧版明文密码）
+func IsPasswordHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// PasswordNeedsRehash 判断哈希参数是否与当前配置不一致
+func PasswordNeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != PasswordCost
+}
+
+// GenerateSessionToken 生成管理员会话令牌
+func GenerateSessionToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "sess_" + hex.EncodeToString(bytes), nil
+}
+
+// HashToken 计算令牌的SHA256哈希（数据库中只保存哈希值）
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
 
 // GenerateAPIKey 生成API密钥
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGenerateJWT(t *testing.T) {
+	initTestKeyring(t)
+
+	entitlements := Entitlements{Features: map[string]bool{"export": true, "beta": false}, Limits: map[string]int64{"max_projects": 5}}
+	token, err := GenerateJWT("KEY-1", "hwid-a", entitlements, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if parsed.Method != jwt.SigningMethodEdDSA || parsed.Header["kid"] != ActiveSigningKey().KID {
+		t.Fatalf("header = %v, want EdDSA with the active kid", parsed.Header)
+	}
+
+	claims, err := ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	if (*claims)["license_key"] != "KEY-1" || (*claims)["hwid"] != "hwid-a" || (*claims)["jti"] == "" {
+		t.Fatalf("claims = %v", *claims)
+	}
+	if features, _ := (*claims)["features"].([]interface{}); len(features) != 1 || features[0] != "export" {
+		t.Fatalf("features = %v, want only enabled features", (*claims)["features"])
+	}
+}
+
+func TestValidateJWTRejects(t *testing.T) {
+	initTestKeyring(t)
+	kid := ActiveSigningKey().KID
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{"license_key": "KEY-1", "hwid": "hwid-a", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	sign := func(method jwt.SigningMethod, header map[string]interface{}, claims jwt.MapClaims, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	expired := claims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"HMAC with the public key", sign(jwt.SigningMethodHS256, map[string]interface{}{"kid": kid}, claims(), []byte(SigningPublicKey()))},
+		{"alg none", sign(jwt.SigningMethodNone, nil, claims(), jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown key", sign(jwt.SigningMethodEdDSA, map[string]interface{}{"kid": "unknown"}, claims(), otherKey)},
+		{"forged kid", sign(jwt.SigningMethodEdDSA, map[string]interface{}{"kid": kid}, claims(), otherKey)},
+		{"offline license file", sign(jwt.SigningMethodEdDSA, map[string]interface{}{"kid": kid, "typ": LicenseFileType}, claims(), ActiveSigningKey().PrivateKey)},
+		{"expired", sign(jwt.SigningMethodEdDSA, map[string]interface{}{"kid": kid}, expired, ActiveSigningKey().PrivateKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, err := ValidateJWT(tt.token); err == nil {
+				t.Fatalf("ValidateJWT accepted the token: %v", *claims)
+			}
+		})
+	}
+}
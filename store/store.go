@@ -0,0 +1,218 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 文件格式：magic(4) | salt(16) | nonce(12) | AES-256-GCM 密文
+// magic 和 salt 作为附加数据参与认证，任何字节被修改都会导致解密失败
+var magic = []byte("LZS1")
+
+const (
+	saltSize = 16
+	keyLabel = "license-session-store/v1"
+)
+
+var (
+	// ErrNoSession 没有保存的会话
+	ErrNoSession = errors.New("no saved session")
+
+	// ErrTampered 会话文件损坏、被篡改，或来自另一台机器（HWID 不同导致密钥不同）
+	ErrTampered = errors.New("session file is corrupted, tampered with, or belongs to another machine")
+)
+
+// Session 客户端会话，保存后下次启动可直接恢复而无需重新激活
+type Session struct {
+	LicenseKey    string    `json:"license_key"`
+	Trial         bool      `json:"trial,omitempty"` // LicenseKey 为试用许可证
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	RequestSecret string    `json:"request_secret,omitempty"`
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Store 加密的会话存储
+// 密钥由 HWID 派生，文件复制到其他机器后无法解密
+type Store struct {
+	mu   sync.Mutex
+	path string
+	hwid string
+}
+
+// New 创建会话存储
+func New(path, hwid string) *Store {
+	return &Store{path: path, hwid: hwid}
+}
+
+// Load 读取并解密会话
+// 文件不存在返回 ErrNoSession，无法解密或校验失败返回 ErrTampered
+func (s *Store) Load() (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Save 加密保存会话（先写临时文件再重命名，避免写入中断损坏原文件）
+func (s *Store) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(session)
+}
+
+// Update 读取会话、修改后保存，整个过程持有锁
+// 没有保存的会话时从空会话开始；文件被篡改时返回 ErrTampered 且不覆盖
+func (s *Store) Update(fn func(session *Session)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.load()
+	if errors.Is(err, ErrNoSession) {
+		session = &Session{}
+	} else if err != nil {
+		return err
+	}
+
+	fn(session)
+	return s.save(session)
+}
+
+// Clear 删除保存的会话（例如解绑设备或许可证被拒绝后）
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// LoadLastSuccess 实现 heartbeat.StateStore，读取最后一次成功心跳时间
+func (s *Store) LoadLastSuccess() (time.Time, error) {
+	session, err := s.Load()
+	if errors.Is(err, ErrNoSession) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return session.LastHeartbeat, nil
+}
+
+// SaveLastSuccess 实现 heartbeat.StateStore，记录最后一次成功心跳时间
+func (s *Store) SaveLastSuccess(t time.Time) error {
+	return s.Update(func(session *Session) {
+		session.LastHeartbeat = t
+	})
+}
+
+func (s *Store) load() (*Session, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	header := len(magic) + saltSize
+	if len(data) < header || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrTampered
+	}
+
+	aead, err := s.cipher(data[len(magic):header])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < header+aead.NonceSize() {
+		return nil, ErrTampered
+	}
+	nonce := data[header : header+aead.NonceSize()]
+	ciphertext := data[header+aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, data[:header])
+	if err != nil {
+		return nil, ErrTampered
+	}
+
+	var session Session
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return nil, ErrTampered
+	}
+	return &session, nil
+}
+
+func (s *Store) save(session *Session) error {
+	session.UpdatedAt = time.Now()
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	// 每次保存使用新的盐值和随机数
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := append(append([]byte{}, magic...), salt...)
+	data := append(append(header, nonce...), aead.Seal(nil, nonce, plaintext, header)...)
+
+	// CreateTemp 创建的文件权限为 0600
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+// cipher 由 HWID 和盐值派生 AES-256-GCM 密钥
+func (s *Store) cipher(salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(keyLabel))
+	mac.Write([]byte{0})
+	mac.Write([]byte(s.hwid))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
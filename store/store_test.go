@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, hwid string) *Store {
+	t.Helper()
+	return New(filepath.Join(t.TempDir(), "session.dat"), hwid)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := newTestStore(t, "hwid-a")
+
+	if _, err := s.Load(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("Load on empty store: %v, want ErrNoSession", err)
+	}
+
+	want := &Session{
+		LicenseKey:    "KEY-1",
+		Token:         "access",
+		RefreshToken:  "rt_1",
+		RequestSecret: "secret",
+		LastHeartbeat: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.LicenseKey != want.LicenseKey || got.RefreshToken != want.RefreshToken ||
+		got.RequestSecret != want.RequestSecret || !got.LastHeartbeat.Equal(want.LastHeartbeat) {
+		t.Fatalf("Load = %+v, want %+v", got, want)
+	}
+
+	// 文件中不应出现明文
+	data, _ := os.ReadFile(s.path)
+	for _, secret := range []string{"KEY-1", "rt_1", "secret"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Fatalf("session file contains plaintext %q", secret)
+		}
+	}
+}
+
+func TestStoreRejectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+	}{
+		{"flipped ciphertext byte", func(data []byte) []byte { data[len(data)-1] ^= 0x01; return data }},
+		{"flipped salt byte", func(data []byte) []byte { data[len(magic)] ^= 0x01; return data }},
+		{"wrong magic", func(data []byte) []byte { data[0] = 'X'; return data }},
+		{"truncated", func(data []byte) []byte { return data[:len(magic)+saltSize+4] }},
+		{"empty", func(data []byte) []byte { return nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t, "hwid-a")
+			if err := s.Save(&Session{LicenseKey: "KEY-1"}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			data, _ := os.ReadFile(s.path)
+			if err := os.WriteFile(s.path, tt.modify(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Load(); !errors.Is(err, ErrTampered) {
+				t.Fatalf("Load: %v, want ErrTampered", err)
+			}
+
+			// Update 不得覆盖被篡改的文件
+			if err := s.Update(func(*Session) {}); !errors.Is(err, ErrTampered) {
+				t.Fatalf("Update: %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestStoreBoundToHWID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.dat")
+	if err := New(path, "hwid-a").Save(&Session{LicenseKey: "KEY-1"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 复制到另一台机器（HWID 不同）后无法解密
+	if _, err := New(path, "hwid-b").Load(); !errors.Is(err, ErrTampered) {
+		t.Fatalf("Load with other HWID: %v, want ErrTampered", err)
+	}
+}
+
+func TestStoreLastSuccess(t *testing.T) {
+	s := newTestStore(t, "hwid-a")
+
+	if last, err := s.LoadLastSuccess(); err != nil || !last.IsZero() {
+		t.Fatalf("LoadLastSuccess on empty store = %s, %v", last, err)
+	}
+
+	if err := s.Save(&Session{LicenseKey: "KEY-1", RefreshToken: "rt_1"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	if err := s.SaveLastSuccess(now); err != nil {
+		t.Fatalf("SaveLastSuccess: %v", err)
+	}
+
+	last, err := s.LoadLastSuccess()
+	if err != nil || !last.Equal(now) {
+		t.Fatalf("LoadLastSuccess = %s, %v, want %s", last, err, now)
+	}
+
+	// 保存心跳时间不影响会话中的其他字段
+	session, _ := s.Load()
+	if session.LicenseKey != "KEY-1" || session.RefreshToken != "rt_1" {
+		t.Fatalf("session fields lost: %+v", session)
+	}
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	s := newTestStore(t, "hwid-a")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				s.SaveLastSuccess(time.Now())
+			} else {
+				s.Update(func(session *Session) { session.RefreshToken = "rt_latest" })
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	session, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load after concurrent updates: %v", err)
+	}
+	if session.RefreshToken != "rt_latest" || session.LastHeartbeat.IsZero() {
+		t.Fatalf("lost update: %+v", session)
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	s := newTestStore(t, "hwid-a")
+	if err := s.Save(&Session{LicenseKey: "KEY-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if _, err := s.Load(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("Load after Clear: %v, want ErrNoSession", err)
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatalf("Clear twice: %v", err)
+	}
+}
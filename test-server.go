@@ -45,6 +45,7 @@ func main() {
 	log.Println("\nAPI Endpoints:")
 	log.Println("  POST /api/activate   - License activation")
 	log.Println("  POST /api/heartbeat  - Heartbeat validation")
+	log.Println("\nNOTE: responses are unsigned, only clients built with make build INSECURE=1 accept them")
 	log.Println("========================================\n")
 
 	http.HandleFunc("/api/activate", handleActivate)